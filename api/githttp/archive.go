@@ -0,0 +1,407 @@
+package githttp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	gopath "path"
+	"sort"
+	"strings"
+	"time"
+
+	"git.sr.ht/~sircmpwn/core-go/auth"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Archives of tags with the default prefix are cached in this directory of the
+// repository, named by the commit, prefix and format, so that moving a tag
+// does not invalidate them.
+const archiveCacheDir = "archive-cache"
+
+// The archives cached for each repository are limited to this many bytes in
+// total. The least recently used archives are removed first.
+const maxArchiveCacheSize = 256 * 1024 * 1024
+
+var archiveTypes = map[string]string{
+	"tar":    "application/x-tar",
+	"tar.gz": "application/gzip",
+	"zip":    "application/zip",
+}
+
+// Serves an archive of the tree at /~owner/repo/archive/<revspec>.<format>,
+// where the format is tar, tar.gz or zip. Each path in the archive is
+// prefixed with the prefix query parameter, or "<repo>-<revspec>/" by
+// default, as with git archive --prefix.
+//
+// The archives are not byte-for-byte identical to those made by git archive,
+// so signatures of those, which the web UI serves, do not apply to them.
+func archive(w http.ResponseWriter, r *http.Request, user *auth.AuthContext) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	revspec := strings.TrimPrefix(parts[2], "archive/")
+	var format string
+	// tar.gz must be checked before tar
+	for _, ext := range []string{"tar.gz", "tar", "zip"} {
+		if strings.HasSuffix(revspec, "."+ext) {
+			revspec = strings.TrimSuffix(revspec, "."+ext)
+			format = ext
+			break
+		}
+	}
+	if format == "" || revspec == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	repo := authorize(w, r, user, "")
+	if repo == nil {
+		return
+	}
+
+	defaultPrefix := repo.Name + "-" + revspec + "/"
+	prefix := defaultPrefix
+	if values, ok := r.URL.Query()["prefix"]; ok {
+		prefix = values[0]
+	}
+	if gopath.IsAbs(prefix) {
+		http.Error(w, "Invalid prefix", http.StatusBadRequest)
+		return
+	}
+	for _, elem := range strings.Split(prefix, "/") {
+		if elem == ".." {
+			http.Error(w, "Invalid prefix", http.StatusBadRequest)
+			return
+		}
+	}
+
+	gitRepo, err := git.PlainOpen(repo.Path)
+	if err != nil {
+		panic(err)
+	}
+	hash, err := gitRepo.ResolveRevision(plumbing.Revision(revspec))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	commit, err := gitRepo.CommitObject(*hash)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := fmt.Sprintf("%s-%x.%s", commit.Hash,
+		sha256.Sum256([]byte(prefix)), format)
+	filename := fmt.Sprintf("%s-%s.%s", repo.Name,
+		strings.ReplaceAll(revspec, "/", "-"), format)
+	w.Header().Set("Content-Type", archiveTypes[format])
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment",
+		map[string]string{"filename": filename}))
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, key))
+	if revspec == commit.Hash.String() {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	// Other prefixes are streamed, so that they cannot be used to fill the
+	// cache
+	if _, err := gitRepo.Reference(plumbing.NewTagReferenceName(revspec),
+		false); err == nil && prefix == defaultPrefix {
+		f, err := cachedArchive(repo.Path, key, commit, format, prefix)
+		if err != nil {
+			log.Printf("Error writing archive of %s: %v", repo.Path, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		http.ServeContent(w, r, "", commit.Committer.When, f)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == w.Header().Get("ETag") {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if err := writeArchive(w, commit, format, prefix); err != nil {
+		log.Printf("Error streaming archive of %s: %v", repo.Path, err)
+	}
+}
+
+// Opens the cached archive with the given key, writing it first if necessary.
+// The file remains readable if it is removed from the cache while it is open.
+func cachedArchive(repoPath, key string, commit *object.Commit,
+	format, prefix string) (*os.File, error) {
+	dir := gopath.Join(repoPath, archiveCacheDir)
+	path := gopath.Join(dir, key)
+	if f, err := os.Open(path); err == nil {
+		// Marks the archive as recently used
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return f, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	// Written to a temporary file first so that readers never see a partial
+	// archive
+	f, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	err = writeArchive(f, commit, format, prefix)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := pruneArchiveCache(dir, maxArchiveCacheSize); err != nil {
+		log.Printf("Error pruning archive cache of %s: %v", repoPath, err)
+	}
+	return f, nil
+}
+
+// Removes the least recently used archives from the cache until they add up
+// to at most limit bytes, along with temporary files left behind by failed
+// writes.
+func pruneArchiveCache(dir string, limit int64) error {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var (
+		archives []os.FileInfo
+		size     int64
+	)
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), "tmp-") {
+			if time.Since(info.ModTime()) > time.Hour {
+				os.Remove(gopath.Join(dir, info.Name()))
+			}
+			continue
+		}
+		archives = append(archives, info)
+		size += info.Size()
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ModTime().Before(archives[j].ModTime())
+	})
+	for _, info := range archives {
+		if size <= limit {
+			break
+		}
+		err := os.Remove(gopath.Join(dir, info.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		size -= info.Size()
+	}
+	return nil
+}
+
+func writeArchive(w io.Writer, commit *object.Commit,
+	format, prefix string) error {
+	switch format {
+	case "tar":
+		return writeTar(w, commit, prefix)
+	case "tar.gz":
+		gz := gzip.NewWriter(w)
+		if err := writeTar(gz, commit, prefix); err != nil {
+			return err
+		}
+		return gz.Close()
+	case "zip":
+		return writeZip(w, commit, prefix)
+	}
+	panic(fmt.Errorf("unknown archive format %q", format))
+}
+
+// Calls fn for each entry of the commit's tree, recursively, in the order
+// they appear in the archive. blob is nil for directories and submodules,
+// which are archived as empty directories.
+func walkArchive(commit *object.Commit, prefix string,
+	fn func(name string, mode filemode.FileMode, blob *object.Blob) error) error {
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(prefix, "/") {
+		if err := fn(prefix, filemode.Dir, nil); err != nil {
+			return err
+		}
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name = prefix + name
+
+		if entry.Mode == filemode.Dir || entry.Mode == filemode.Submodule {
+			if err := fn(name+"/", filemode.Dir, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		file, err := tree.TreeEntryFile(&entry)
+		if err != nil {
+			return err
+		}
+		if err := fn(name, entry.Mode, &file.Blob); err != nil {
+			return err
+		}
+	}
+}
+
+func readLink(blob *object.Blob) (string, error) {
+	reader, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	target, err := ioutil.ReadAll(reader)
+	return string(target), err
+}
+
+// Writes a tar archive of the commit's tree, like git archive.
+func writeTar(w io.Writer, commit *object.Commit, prefix string) error {
+	tw := tar.NewWriter(w)
+	// Allows the commit to be recovered with git get-tar-commit-id
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeXGlobalHeader,
+		Name:       "pax_global_header",
+		PAXRecords: map[string]string{"comment": commit.Hash.String()},
+	}); err != nil {
+		return err
+	}
+
+	mtime := commit.Committer.When
+	if err := walkArchive(commit, prefix, func(name string,
+		mode filemode.FileMode, blob *object.Blob) error {
+		hdr := &tar.Header{
+			Name:    name,
+			ModTime: mtime,
+			Uname:   "root",
+			Gname:   "root",
+		}
+		switch mode {
+		case filemode.Dir:
+			hdr.Typeflag = tar.TypeDir
+			hdr.Mode = 0775
+			return tw.WriteHeader(hdr)
+		case filemode.Symlink:
+			target, err := readLink(blob)
+			if err != nil {
+				return err
+			}
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = target
+			hdr.Mode = 0777
+			return tw.WriteHeader(hdr)
+		case filemode.Executable:
+			hdr.Mode = 0775
+		default:
+			hdr.Mode = 0664
+		}
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = blob.Size
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		reader, err := blob.Reader()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(tw, reader)
+		return err
+	}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// Writes a zip archive of the commit's tree, like git archive.
+func writeZip(w io.Writer, commit *object.Commit, prefix string) error {
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(commit.Hash.String()); err != nil {
+		return err
+	}
+
+	mtime := commit.Committer.When
+	if err := walkArchive(commit, prefix, func(name string,
+		mode filemode.FileMode, blob *object.Blob) error {
+		hdr := &zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: mtime,
+		}
+		switch mode {
+		case filemode.Dir:
+			hdr.Method = zip.Store
+			hdr.SetMode(os.ModeDir | 0775)
+			_, err := zw.CreateHeader(hdr)
+			return err
+		case filemode.Symlink:
+			target, err := readLink(blob)
+			if err != nil {
+				return err
+			}
+			hdr.SetMode(os.ModeSymlink | 0777)
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(fw, target)
+			return err
+		case filemode.Executable:
+			hdr.SetMode(0775)
+		default:
+			hdr.SetMode(0664)
+		}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		reader, err := blob.Reader()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(fw, reader)
+		return err
+	}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,188 @@
+package githttp
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	gopath "path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gitsrht-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// Creates a repository with a single commit, and returns its path and the
+// commit.
+func testCommit(t *testing.T) (string, *object.Commit) {
+	t.Helper()
+	dir := tempDir(t)
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Example", "GIT_AUTHOR_EMAIL=example@example.org",
+			"GIT_COMMITTER_NAME=Example", "GIT_COMMITTER_EMAIL=example@example.org",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+	}
+	run("init", "--quiet")
+	if err := os.Mkdir(gopath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"README":      "Hello, world\n",
+		"src/main.sh": "#!/bin/sh\n",
+	} {
+		if err := ioutil.WriteFile(gopath.Join(dir, name),
+			[]byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("README", gopath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "--all")
+	run("update-index", "--chmod=+x", "src/main.sh")
+	run("commit", "--quiet", "-m", "Commit")
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, commit
+}
+
+func TestWriteTar(t *testing.T) {
+	_, commit := testCommit(t)
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, commit, "tar", "repo-1.0/"); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeXGlobalHeader:
+			if hdr.PAXRecords["comment"] != commit.Hash.String() {
+				t.Errorf("expected the commit ID in the global header")
+			}
+			continue
+		case tar.TypeSymlink:
+			entries = append(entries, hdr.Name+" -> "+hdr.Linkname)
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, hdr.Name+" "+
+			os.FileMode(hdr.Mode).String()+" "+string(content))
+	}
+	want := []string{
+		"repo-1.0/ -rwxrwxr-x ",
+		"repo-1.0/README -rw-rw-r-- Hello, world\n",
+		"repo-1.0/link -> README",
+		"repo-1.0/src/ -rwxrwxr-x ",
+		"repo-1.0/src/main.sh -rwxrwxr-x #!/bin/sh\n",
+	}
+	if strings.Join(entries, "|") != strings.Join(want, "|") {
+		t.Errorf("got entries:\n%s\nwant:\n%s",
+			strings.Join(entries, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCachedArchive(t *testing.T) {
+	dir, commit := testCommit(t)
+	read := func() []byte {
+		t.Helper()
+		f, err := cachedArchive(dir, "key.tar", commit, "tar", "repo/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	first := read()
+	infos, err := ioutil.ReadDir(gopath.Join(dir, archiveCacheDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Name() != "key.tar" ||
+		infos[0].Mode().Perm() != 0644 {
+		t.Fatalf("expected only key.tar in the cache")
+	}
+	if second := read(); !bytes.Equal(first, second) {
+		t.Error("the cached archive differs")
+	}
+}
+
+func TestPruneArchiveCache(t *testing.T) {
+	dir := tempDir(t)
+	now := time.Now()
+	for i, name := range []string{"a.tar", "b.tar", "c.tar", "tmp-1", "tmp-2"} {
+		p := gopath.Join(dir, name)
+		if err := ioutil.WriteFile(p, make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// a.tar is the least recently used, and tmp-1 is stale
+		mtime := now.Add(time.Duration(i-5) * time.Minute)
+		if name == "tmp-1" {
+			mtime = now.Add(-2 * time.Hour)
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneArchiveCache(dir, 250); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if got := strings.Join(names, " "); got != "b.tar c.tar tmp-2" {
+		t.Errorf("got %q, want %q", got, "b.tar c.tar tmp-2")
+	}
+}
@@ -0,0 +1,76 @@
+package githttp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	gopath "path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~sircmpwn/core-go/auth"
+)
+
+var objectIDRE = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Streams the raw contents of a blob, without buffering it in memory.
+func blob(w http.ResponseWriter, r *http.Request, user *auth.AuthContext) {
+	id := gopath.Base(r.URL.Path)
+	if !objectIDRE.MatchString(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	repo := authorize(w, r, user, "")
+	if repo == nil {
+		return
+	}
+
+	cmd := exec.Command("git", "cat-file",
+		"--batch=%(objectname) %(objecttype) %(objectsize)")
+	cmd.Dir = repo.Path
+	cmd.Stdin = strings.NewReader(id + "\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		panic(err)
+	}
+	if err := cmd.Start(); err != nil {
+		panic(err)
+	}
+	defer cmd.Wait()
+	// Stops git if the client goes away
+	defer cmd.Process.Kill()
+
+	out := bufio.NewReader(stdout)
+	header, err := out.ReadString('\n')
+	if err != nil {
+		log.Printf("git cat-file: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// "<id> missing" if there is no such object
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != "blob" {
+		http.NotFound(w, r)
+		return
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		log.Printf("git cat-file: unexpected output %q", header)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Blobs are immutable, but may be private
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, id))
+	if _, err := io.CopyN(w, out, size); err != nil {
+		log.Printf("Error streaming blob %s: %v", id, err)
+	}
+}
@@ -0,0 +1,279 @@
+package githttp
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha512"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	gopath "path"
+	"strings"
+
+	"git.sr.ht/~sircmpwn/core-go/auth"
+	"git.sr.ht/~sircmpwn/core-go/config"
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"github.com/google/uuid"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/repos"
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/access"
+)
+
+type Router interface {
+	Get(pattern string, h http.HandlerFunc)
+	Post(pattern string, h http.HandlerFunc)
+}
+
+// Registers handlers for the git smart HTTP protocol, such that repositories
+// may be cloned from, fetched from, and pushed to at /~owner/repo. Raw blobs
+// may also be downloaded from /~owner/repo/blob/<id>, and archives of any
+// revision from /~owner/repo/archive/<revspec>.<format>.
+func Routes(r Router) {
+	r.Get("/{owner}/{repo}/info/refs", withAuth(infoRefs))
+	r.Post("/{owner}/{repo}/git-upload-pack", withAuth(serviceRPC("upload-pack")))
+	r.Post("/{owner}/{repo}/git-receive-pack", withAuth(serviceRPC("receive-pack")))
+	r.Get("/{owner}/{repo}/blob/{id}", withAuth(blob))
+	r.Get("/{owner}/{repo}/archive/*", withAuth(archive))
+}
+
+// Authenticates the request with a personal access token, provided as the
+// password for HTTP basic authentication, if present. Anonymous requests are
+// passed through with a nil user, as public repositories may be cloned
+// without authentication.
+func withAuth(next func(w http.ResponseWriter, r *http.Request,
+	user *auth.AuthContext)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, token, ok := r.BasicAuth()
+		if !ok {
+			next(w, r, nil)
+			return
+		}
+		hash := sha512.Sum512([]byte(token))
+		auth.OAuth2(token, hash, w, r, http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				next(w, r, auth.ForContext(r.Context()))
+			}))
+	}
+}
+
+// Looks up the repository at the given path on disk. See access.LookupRepo.
+func lookupRepo(ctx context.Context, userID int,
+	path string) (*access.Repo, error) {
+	var repo *access.Repo
+	err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		var err error
+		repo, err = access.LookupRepo(ctx, tx, userID, path)
+		return err
+	})
+	return repo, err
+}
+
+// Looks up the repository for this request and checks that the user has the
+// necessary access to it. If not, an error response is written and nil is
+// returned.
+func authorize(w http.ResponseWriter, r *http.Request,
+	user *auth.AuthContext, service string) *access.Repo {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[0], "~") {
+		http.NotFound(w, r)
+		return nil
+	}
+	owner, name := parts[0], strings.TrimSuffix(parts[1], ".git")
+
+	conf := config.ForContext(r.Context())
+	repos, ok := conf.Get("git.sr.ht", "repos")
+	if !ok || repos == "" {
+		panic(fmt.Errorf("Configuration error: [git.sr.ht]repos is unset"))
+	}
+	path := gopath.Join(repos, gopath.Clean("/"+owner), gopath.Clean("/"+name))
+
+	needsAccess := access.READ
+	grant := auth.RO
+	if service == "receive-pack" {
+		needsAccess = access.WRITE
+		grant = auth.RW
+	}
+
+	var userID int
+	if user != nil {
+		if user.BearerToken == nil || user.BearerToken.ClientID != "" {
+			http.Error(w, "Only personal access tokens may be used for git over HTTP",
+				http.StatusForbidden)
+			return nil
+		}
+		if !user.Grants.Has("OBJECTS", grant) {
+			http.Error(w, fmt.Sprintf("Access token is missing the OBJECTS:%s grant",
+				grant), http.StatusForbidden)
+			return nil
+		}
+		userID = user.UserID
+	}
+
+	repo, err := lookupRepo(r.Context(), userID, path)
+	if err != nil {
+		panic(err)
+	}
+	if repo == nil || repo.Access(userID)&access.READ == 0 {
+		if user == nil {
+			challenge(w)
+			return nil
+		}
+		http.NotFound(w, r)
+		return nil
+	}
+
+	if repo.Redirected {
+		target := fmt.Sprintf("/~%s/%s/%s", repo.EntityName, repo.Name, parts[2])
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return nil
+	}
+
+	if repo.Access(userID)&needsAccess != needsAccess {
+		if user == nil {
+			challenge(w)
+			return nil
+		}
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return nil
+	}
+
+	if service == "receive-pack" && repo.MirrorURL != nil {
+		http.Error(w, "This repository is a mirror and does not accept pushes",
+			http.StatusForbidden)
+		return nil
+	}
+	return repo
+}
+
+func challenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="git.sr.ht"`)
+	http.Error(w, "Authentication required", http.StatusUnauthorized)
+}
+
+// Prepares the environment for a git service. Pushes are given the same push
+// context as gitsrht-shell provides, so that the update hooks work the same
+// for pushes received over HTTP.
+func serviceEnv(r *http.Request, user *auth.AuthContext,
+	repo *access.Repo, service string) []string {
+	env := os.Environ()
+	if proto := r.Header.Get("Git-Protocol"); proto != "" {
+		env = append(env, "GIT_PROTOCOL="+proto)
+	}
+	if service != "receive-pack" {
+		return env
+	}
+
+	pushContext, _ := json.Marshal(&repos.PushContext{
+		Repo: repos.PushRepo{
+			ID:           repo.ID,
+			Name:         repo.Name,
+			OwnerID:      repo.OwnerID,
+			OwnerName:    repo.EntityName,
+			OrgID:        repo.OrgID,
+			Path:         repo.Path,
+			AbsolutePath: repo.Path,
+			Visibility:   repo.Visibility,
+			Autocreated:  false,
+		},
+		User: repos.PushUser{
+			CanonicalName: "~" + user.Username,
+			Name:          user.Username,
+		},
+	})
+	pushUuid := uuid.New().String()
+	log.Printf("Receiving push %s to %s over HTTP", pushUuid, repo.Path)
+	return append(env,
+		fmt.Sprintf("SRHT_PUSH=%s", pushUuid),
+		fmt.Sprintf("SRHT_PUSH_CTX=%s", string(pushContext)))
+}
+
+func infoRefs(w http.ResponseWriter, r *http.Request, user *auth.AuthContext) {
+	service := strings.TrimPrefix(r.URL.Query().Get("service"), "git-")
+	if service != "upload-pack" && service != "receive-pack" {
+		http.Error(w, "Only the smart HTTP protocol is supported",
+			http.StatusForbidden)
+		return
+	}
+
+	repo := authorize(w, r, user, service)
+	if repo == nil {
+		return
+	}
+
+	// Note: git commands are not bound to the request context, which is
+	// cancelled after the API's max-duration.
+	cmd := exec.Command("git", service, "--stateless-rpc", "--advertise-refs", ".")
+	cmd.Dir = repo.Path
+	cmd.Env = serviceEnv(r, user, repo, "")
+	out, err := cmd.Output()
+	if err != nil {
+		log.Printf("git %s --advertise-refs: %v", service, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type",
+		fmt.Sprintf("application/x-git-%s-advertisement", service))
+	w.Header().Set("Cache-Control", "no-cache")
+	if !strings.Contains(r.Header.Get("Git-Protocol"), "version=2") {
+		writePacket(w, fmt.Sprintf("# service=git-%s\n", service))
+		io.WriteString(w, "0000")
+	}
+	w.Write(out)
+}
+
+func serviceRPC(service string) func(w http.ResponseWriter,
+	r *http.Request, user *auth.AuthContext) {
+	return func(w http.ResponseWriter, r *http.Request, user *auth.AuthContext) {
+		if r.Header.Get("Content-Type") !=
+			fmt.Sprintf("application/x-git-%s-request", service) {
+			http.Error(w, "Unexpected content type", http.StatusBadRequest)
+			return
+		}
+
+		repo := authorize(w, r, user, service)
+		if repo == nil {
+			return
+		}
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Invalid gzip request body", http.StatusBadRequest)
+				return
+			}
+			defer gz.Close()
+			body = gz
+		}
+
+		w.Header().Set("Content-Type",
+			fmt.Sprintf("application/x-git-%s-result", service))
+		w.Header().Set("Cache-Control", "no-cache")
+
+		cmd := exec.Command("git", service, "--stateless-rpc", ".")
+		cmd.Dir = repo.Path
+		cmd.Env = serviceEnv(r, user, repo, service)
+		cmd.Stdin = body
+		cmd.Stdout = w
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Printf("git %s: %v", service, err)
+		}
+	}
+}
+
+func writePacket(w io.Writer, data string) {
+	fmt.Fprintf(w, "%04x%s", len(data)+4, data)
+}
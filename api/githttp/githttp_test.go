@@ -0,0 +1,86 @@
+package githttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~sircmpwn/core-go/auth"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/repos"
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/access"
+)
+
+func TestServiceEnv(t *testing.T) {
+	org := 10
+	repo := &access.Repo{
+		ID:         1,
+		Name:       "example",
+		OwnerID:    2,
+		OrgID:      &org,
+		EntityName: "example-org",
+		Path:       "/var/lib/git/~example-org/example",
+		Visibility: "public",
+	}
+	user := &auth.AuthContext{UserID: 3, Username: "jdoe"}
+	lookup := func(env []string, key string) (string, bool) {
+		for _, kv := range env {
+			if strings.HasPrefix(kv, key+"=") {
+				return strings.TrimPrefix(kv, key+"="), true
+			}
+		}
+		return "", false
+	}
+
+	r := httptest.NewRequest("GET", "/~example-org/example/info/refs", nil)
+	r.Header.Set("Git-Protocol", "version=2")
+	env := serviceEnv(r, nil, repo, "upload-pack")
+	if proto, _ := lookup(env, "GIT_PROTOCOL"); proto != "version=2" {
+		t.Errorf("got GIT_PROTOCOL %q, want version=2", proto)
+	}
+	if _, ok := lookup(env, "SRHT_PUSH"); ok {
+		t.Errorf("expected no push for upload-pack")
+	}
+
+	r = httptest.NewRequest("POST", "/~example-org/example/git-receive-pack",
+		nil)
+	env = serviceEnv(r, user, repo, "receive-pack")
+	if push, ok := lookup(env, "SRHT_PUSH"); !ok || push == "" {
+		t.Errorf("expected SRHT_PUSH to be set")
+	}
+	pushContext, _ := lookup(env, "SRHT_PUSH_CTX")
+	var got repos.PushContext
+	if err := json.Unmarshal([]byte(pushContext), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := repos.PushContext{
+		Repo: repos.PushRepo{
+			ID:           1,
+			Name:         "example",
+			OwnerID:      2,
+			OwnerName:    "example-org",
+			OrgID:        &org,
+			Path:         repo.Path,
+			AbsolutePath: repo.Path,
+			Visibility:   "public",
+		},
+		User: repos.PushUser{CanonicalName: "~jdoe", Name: "jdoe"},
+	}
+	if got.Repo.OrgID == nil || *got.Repo.OrgID != org {
+		t.Errorf("got org ID %v, want %d", got.Repo.OrgID, org)
+	}
+	got.Repo.OrgID = want.Repo.OrgID
+	if got != want {
+		t.Errorf("got push context %+v, want %+v", got, want)
+	}
+}
+
+func TestWritePacket(t *testing.T) {
+	var buf bytes.Buffer
+	writePacket(&buf, "# service=git-upload-pack\n")
+	if want := "001e# service=git-upload-pack\n"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
@@ -5,6 +5,8 @@ go 1.14
 require (
 	git.sr.ht/~sircmpwn/core-go v0.0.0-20220217133755-ebf93be7318f
 	git.sr.ht/~sircmpwn/dowork v0.0.0-20210820133136-d3970e97def3
+	git.sr.ht/~sircmpwn/git.sr.ht/internal v0.0.0-00010101000000-000000000000
+	git.sr.ht/~turminal/go-fnmatch v0.0.0-20211021204744-1a55764af6de
 	github.com/99designs/gqlgen v0.14.0
 	github.com/Masterminds/squirrel v1.4.0
 	github.com/go-git/go-git/v5 v5.0.0
@@ -14,8 +16,11 @@ require (
 	github.com/minio/minio-go/v7 v7.0.5
 	github.com/mitchellh/mapstructure v1.3.2 // indirect
 	github.com/prometheus/common v0.30.0 // indirect
+	github.com/sergi/go-diff v1.1.0
 	github.com/smartystreets/goconvey v1.6.4 // indirect
 	github.com/vektah/gqlparser/v2 v2.2.0
 )
 
 replace github.com/go-git/go-git/v5 => git.sr.ht/~sircmpwn/go-git/v5 v5.0.0-20220207102101-70373b908e0a
+
+replace git.sr.ht/~sircmpwn/git.sr.ht/internal => ../internal
@@ -1,42 +1,180 @@
 package graph
 
 import (
-	"git.sr.ht/~sircmpwn/core-go/model"
+	coremodel "git.sr.ht/~sircmpwn/core-go/model"
 
 	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph/api"
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph/model"
 )
 
-func cursorComplexity(c int, cursor *model.Cursor) int {
+func cursorComplexity(c int, cursor *coremodel.Cursor) int {
 	if cursor != nil {
 		return c * cursor.Count
 	}
 	return c
 }
 
+// Returns the cost of reading the contents of a blob, which is proportional to
+// the size of the requested range. Without an end, as much as 16 MiB may be
+// read.
+func blobComplexity(c int, rangeArg *model.ByteRange) int {
+	mib := 16
+	if rangeArg != nil && rangeArg.End != nil {
+		n := (*rangeArg.End - rangeArg.Start + (1 << 20) - 1) >> 20
+		if n < 1 {
+			n = 1
+		}
+		if n < mib {
+			mib = n
+		}
+	}
+	return c + 2*mib
+}
+
+// Returns the cost of annotating the given number of lines of a file (100 by
+// default), which is priced like a page of results per 25 lines.
+func blameComplexity(c int, lines *int) int {
+	count := 100
+	if lines != nil {
+		count = *lines
+	}
+	return c * ((count + 24) / 25)
+}
+
+// The cost of computing a diff, which may have up to thousands of lines
+const diffComplexity = 50
+
+// The cost of reading the subtrees of a tree to list its entries recursively
+const recursiveTreeComplexity = 25
+
+// The cost of a page of code search results, which may read hundreds of files
+const searchComplexity = 100
+
+// The cost of counting the commits between a reference and HEAD, which walks
+// the history of a page of references at once
+const aheadBehindComplexity = 10
+
+// The cost of verifying a signature, which may look up keys on meta.sr.ht
+const signatureComplexity = 10
+
 func ApplyComplexity(conf *api.Config) {
-	conf.Complexity.Query.Repositories = func(c int, cursor *model.Cursor, filter *model.Filter) int {
+	conf.Complexity.Query.Repositories = func(c int, cursor *coremodel.Cursor, filter *coremodel.Filter) int {
+		c = cursorComplexity(c, cursor)
+		if filter != nil && filter.Count != nil {
+			c *= *filter.Count
+		}
+		return c
+	}
+	conf.Complexity.Query.Organizations = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Organization.Members = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Organization.Teams = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Organization.Repositories = func(c int, cursor *coremodel.Cursor, filter *coremodel.Filter) int {
+		c = cursorComplexity(c, cursor)
+		if filter != nil && filter.Count != nil {
+			c *= *filter.Count
+		}
+		return c
+	}
+	conf.Complexity.Commit.StructuredDiff = func(c int, base *string, context *int) int {
+		return c + diffComplexity
+	}
+	conf.Complexity.Comparison.Diff = func(c int, context *int) int {
+		return c + diffComplexity
+	}
+	conf.Complexity.Comparison.Commits = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Repository.Compare = func(c int, base string, head string) int {
+		// Finding the merge base may walk much of the history
+		return c + 10
+	}
+	conf.Complexity.Repository.AccessControlList = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Repository.TeamAccessControlList = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Repository.Log = func(c int, cursor *coremodel.Cursor, from *string, path *string, follow *bool, filter *coremodel.Filter) int {
 		c = cursorComplexity(c, cursor)
 		if filter != nil && filter.Count != nil {
 			c *= *filter.Count
 		}
 		return c
 	}
-	conf.Complexity.Repository.AccessControlList = func(c int, cursor *model.Cursor) int {
+	conf.Complexity.Repository.ProtectedRefs = func(c int, cursor *coremodel.Cursor) int {
 		return cursorComplexity(c, cursor)
 	}
-	conf.Complexity.Repository.Log = func(c int, cursor *model.Cursor, from *string) int {
+	conf.Complexity.Repository.Forks = func(c int, cursor *coremodel.Cursor) int {
 		return cursorComplexity(c, cursor)
 	}
+	conf.Complexity.Repository.PushMirrors = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.PushMirror.Attempts = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Repository.SecretFindings = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Repository.Blame = func(c int, revspec *string, path string, start *int, lines *int) int {
+		return blameComplexity(c, lines)
+	}
+	conf.Complexity.Repository.Search = func(c int, revspec *string, query string, regex *bool, path *string, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor) + searchComplexity
+	}
 	conf.Complexity.Repository.Objects = func(c int, ids []string) int {
 		return c * len(ids)
 	}
-	conf.Complexity.Repository.References = func(c int, cursor *model.Cursor) int {
+	conf.Complexity.Repository.References = func(c int, cursor *coremodel.Cursor) int {
 		return cursorComplexity(c, cursor)
 	}
-	conf.Complexity.Tree.Entries = func(c int, cursor *model.Cursor) int {
+	conf.Complexity.Repository.Branches = func(c int, cursor *coremodel.Cursor, prefix *string, orderBy *model.ReferenceOrder) int {
 		return cursorComplexity(c, cursor)
 	}
-	conf.Complexity.User.Repositories = func(c int, cursor *model.Cursor, filter *model.Filter) int {
+	conf.Complexity.Repository.Tags = func(c int, cursor *coremodel.Cursor, prefix *string, orderBy *model.ReferenceOrder) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.Branch.Ahead = func(c int) int {
+		return c + aheadBehindComplexity
+	}
+	conf.Complexity.Branch.Behind = func(c int) int {
+		return c + aheadBehindComplexity
+	}
+	conf.Complexity.TagReference.Ahead = func(c int) int {
+		return c + aheadBehindComplexity
+	}
+	conf.Complexity.TagReference.Behind = func(c int) int {
+		return c + aheadBehindComplexity
+	}
+	conf.Complexity.ObjectSignature.Status = func(c int) int {
+		return c + signatureComplexity
+	}
+	conf.Complexity.ObjectSignature.Signer = func(c int) int {
+		return c + signatureComplexity
+	}
+	conf.Complexity.Team.Members = func(c int, cursor *coremodel.Cursor) int {
+		return cursorComplexity(c, cursor)
+	}
+	conf.Complexity.TextBlob.Text = func(c int, rangeArg *model.ByteRange) int {
+		return blobComplexity(c, rangeArg)
+	}
+	conf.Complexity.BinaryBlob.Base64 = func(c int, rangeArg *model.ByteRange) int {
+		return blobComplexity(c, rangeArg)
+	}
+	conf.Complexity.Tree.Entries = func(c int, cursor *coremodel.Cursor, glob *string, recursive *bool) int {
+		c = cursorComplexity(c, cursor)
+		if recursive != nil && *recursive {
+			c += recursiveTreeComplexity
+		}
+		return c
+	}
+	conf.Complexity.User.Repositories = func(c int, cursor *coremodel.Cursor, filter *coremodel.Filter) int {
 		c = cursorComplexity(c, cursor)
 		if filter != nil && filter.Count != nil {
 			c *= *filter.Count
@@ -0,0 +1,43 @@
+package graph
+
+import (
+	"testing"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph/model"
+)
+
+func TestBlobComplexity(t *testing.T) {
+	end := func(n int) *int { return &n }
+	for _, tc := range []struct {
+		byteRange *model.ByteRange
+		want      int
+	}{
+		{nil, 1 + 32},
+		{&model.ByteRange{Start: 0, End: end(100)}, 1 + 2},
+		{&model.ByteRange{Start: 0, End: end(3 << 20)}, 1 + 6},
+		{&model.ByteRange{Start: 1 << 20, End: end(1 << 30)}, 1 + 32},
+		{&model.ByteRange{Start: 5 << 20}, 1 + 32},
+	} {
+		if got := blobComplexity(1, tc.byteRange); got != tc.want {
+			t.Errorf("range %+v: got %d, want %d", tc.byteRange, got, tc.want)
+		}
+	}
+}
+
+func TestBlameComplexity(t *testing.T) {
+	lines := func(n int) *int { return &n }
+	for _, tc := range []struct {
+		lines *int
+		want  int
+	}{
+		{nil, 2 * 4},
+		{lines(1), 2},
+		{lines(25), 2},
+		{lines(26), 2 * 2},
+		{lines(1000), 2 * 40},
+	} {
+		if got := blameComplexity(2, tc.lines); got != tc.want {
+			t.Errorf("%v lines: got %d, want %d", tc.lines, got, tc.want)
+		}
+	}
+}
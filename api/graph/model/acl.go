@@ -110,3 +110,100 @@ func (acl *ACL) QueryWithCursor(ctx context.Context,
 
 	return acls, cur
 }
+
+// An access control list entry which grants access to the members of a team.
+type TeamACL struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+
+	RawAccessMode string
+	RepoID        int
+	TeamID        int
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (acl *TeamACL) Mode() AccessMode {
+	mode := AccessMode(strings.ToUpper(acl.RawAccessMode))
+	if !mode.IsValid() {
+		panic(fmt.Errorf("Invalid access mode '%s'", acl.RawAccessMode)) // Invariant
+	}
+	return mode
+}
+
+func (acl *TeamACL) As(alias string) *TeamACL {
+	acl.alias = alias
+	return acl
+}
+
+func (acl *TeamACL) Alias() string {
+	return acl.alias
+}
+
+func (acl *TeamACL) Table() string {
+	return "team_access"
+}
+
+func (acl *TeamACL) Fields() *database.ModelFields {
+	if acl.fields != nil {
+		return acl.fields
+	}
+	acl.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &acl.ID},
+			{"created", "created", &acl.Created},
+			{"mode", "mode", &acl.RawAccessMode},
+
+			// Always fetch:
+			{"id", "", &acl.ID},
+			{"repo_id", "", &acl.RepoID},
+			{"team_id", "", &acl.TeamID},
+		},
+	}
+	return acl.fields
+}
+
+func (acl *TeamACL) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*TeamACL, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(acl.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(acl.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var acls []*TeamACL
+	for rows.Next() {
+		var acl TeamACL
+		if err := rows.Scan(database.Scan(ctx, &acl)...); err != nil {
+			panic(err)
+		}
+		acls = append(acls, &acl)
+	}
+
+	if len(acls) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(acls[len(acls)-1].ID),
+			Search: cur.Search,
+		}
+		acls = acls[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return acls, cur
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type Blame struct {
+	Ranges []*BlameRange `json:"ranges"`
+	Next   *int          `json:"next"`
+}
+
+type BlameRange struct {
+	StartLine         int        `json:"startLine"`
+	Lines             int        `json:"lines"`
+	OriginalStartLine int        `json:"originalStartLine"`
+	OriginalPath      string     `json:"originalPath"`
+	Author            *Signature `json:"author"`
+
+	hash plumbing.Hash
+	repo *RepoWrapper
+}
+
+func (r *BlameRange) Commit() *Commit {
+	obj, err := LookupObject(r.repo, r.hash)
+	if err != nil {
+		panic(err)
+	}
+	commit, _ := obj.(*Commit)
+	return commit
+}
+
+// Annotates up to count lines of the file at the given path and revspec,
+// starting from the given line (1-based), with the commits which last changed
+// them.
+func BlameContext(ctx context.Context, repo *Repository,
+	revspec, path string, start, count int) (*Blame, error) {
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	commit, err := gitRepo.ResolveCommit(revspec)
+	gitRepo.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra line is requested to find out if there are any more
+	blame := exec.CommandContext(ctx, "git", "-C", repo.Path,
+		"blame", "--porcelain", fmt.Sprintf("-L%d,+%d", start, count+1),
+		commit.Hash.String(), "--", path)
+	var stderr bytes.Buffer
+	blame.Stderr = &stderr
+	out, err := blame.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git blame: %s",
+			strings.TrimPrefix(strings.TrimSpace(stderr.String()), "fatal: "))
+	}
+
+	result, err := parseBlame(out, gitRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines int
+	for _, r := range result.Ranges {
+		lines += r.Lines
+	}
+	if lines > count {
+		last := result.Ranges[len(result.Ranges)-1]
+		if last.Lines--; last.Lines == 0 {
+			result.Ranges = result.Ranges[:len(result.Ranges)-1]
+		}
+		next := start + count
+		result.Next = &next
+	}
+	return result, nil
+}
+
+// Parses the output of git blame --porcelain. Each group of lines from the
+// same commit becomes one range.
+func parseBlame(out []byte, repo *RepoWrapper) (*Blame, error) {
+	result := &Blame{Ranges: []*BlameRange{}}
+	authors := make(map[plumbing.Hash]*Signature)
+	paths := make(map[plumbing.Hash]string)
+
+	var (
+		current *BlameRange
+		author  *Signature
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\t") {
+			// File contents
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		key, value := fields[0], ""
+		if len(fields) == 2 {
+			value = fields[1]
+		}
+
+		switch key {
+		case "author":
+			author.Name = value
+		case "author-mail":
+			author.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case "author-time":
+			sec, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("git blame: invalid author time %q", value)
+			}
+			author.Time = time.Unix(sec, 0)
+		case "author-tz":
+			tz, err := time.Parse("-0700", value)
+			if err != nil {
+				return nil, fmt.Errorf("git blame: invalid author tz %q", value)
+			}
+			author.Time = author.Time.In(tz.Location())
+		case "filename":
+			current.OriginalPath = value
+			paths[current.hash] = value
+		default:
+			if !plumbing.IsHash(key) {
+				// Other commit metadata
+				continue
+			}
+			// <hash> <original line> <final line> [<lines in group>]
+			hdr := strings.Split(value, " ")
+			if len(hdr) != 3 {
+				continue
+			}
+			hash := plumbing.NewHash(key)
+			orig, err1 := strconv.Atoi(hdr[0])
+			final, err2 := strconv.Atoi(hdr[1])
+			lines, err3 := strconv.Atoi(hdr[2])
+			if err1 != nil || err2 != nil || err3 != nil {
+				return nil, fmt.Errorf("git blame: invalid header %q", line)
+			}
+
+			var ok bool
+			if author, ok = authors[hash]; !ok {
+				author = &Signature{}
+				authors[hash] = author
+			}
+			current = &BlameRange{
+				StartLine:         final,
+				Lines:             lines,
+				OriginalStartLine: orig,
+				OriginalPath:      paths[hash],
+				Author:            author,
+				hash:              hash,
+				repo:              repo,
+			}
+			result.Ranges = append(result.Ranges, current)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
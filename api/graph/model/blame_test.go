@@ -0,0 +1,102 @@
+package model
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"testing"
+)
+
+func TestBlame(t *testing.T) {
+	dir, run := testRepo(t)
+	write := func(name, content string) {
+		t.Helper()
+		if err := ioutil.WriteFile(path.Join(dir, name),
+			[]byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("old.txt", "one\ntwo\nthree\n")
+	run("add", "old.txt")
+	run("commit", "--quiet", "--author", "Alice <alice@example.org>",
+		"--date", "2020-01-02T03:04:05+0100", "-m", "First")
+	first := run("rev-parse", "HEAD")
+	run("mv", "old.txt", "new.txt")
+	write("new.txt", "one\nTWO\nthree\nfour\n")
+	run("add", "new.txt")
+	run("commit", "--quiet", "-m", "Second")
+	second := run("rev-parse", "HEAD")
+
+	repo := &Repository{Path: dir}
+	ctx := context.Background()
+	blame, err := BlameContext(ctx, repo, "HEAD", "new.txt", 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blame.Next != nil {
+		t.Errorf("expected no more lines, got next %d", *blame.Next)
+	}
+	want := []struct {
+		start, lines, orig int
+		path, commit       string
+	}{
+		{1, 1, 1, "old.txt", first},
+		{2, 1, 2, "new.txt", second},
+		{3, 1, 3, "old.txt", first},
+		{4, 1, 4, "new.txt", second},
+	}
+	if len(blame.Ranges) != len(want) {
+		t.Fatalf("got %d ranges, want %d", len(blame.Ranges), len(want))
+	}
+	for i, w := range want {
+		r := blame.Ranges[i]
+		if r.StartLine != w.start || r.Lines != w.lines ||
+			r.OriginalStartLine != w.orig || r.OriginalPath != w.path ||
+			r.Commit().ID != w.commit {
+			t.Errorf("range %d: got lines %d+%d from %s:%d in %s, "+
+				"want %d+%d from %s:%d in %s", i, r.StartLine, r.Lines,
+				r.OriginalPath, r.OriginalStartLine, r.Commit().ID,
+				w.start, w.lines, w.path, w.orig, w.commit)
+		}
+	}
+	author := blame.Ranges[0].Author
+	if author.Name != "Alice" || author.Email != "alice@example.org" ||
+		author.Time.Format("2006-01-02T15:04:05-0700") !=
+			"2020-01-02T03:04:05+0100" {
+		t.Errorf("unexpected author %s <%s> at %s",
+			author.Name, author.Email, author.Time)
+	}
+
+	// Paging
+	blame, err = BlameContext(ctx, repo, "HEAD", "new.txt", 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blame.Ranges) != 2 || blame.Ranges[0].StartLine != 2 ||
+		blame.Ranges[1].StartLine != 3 {
+		t.Errorf("unexpected ranges %+v", blame.Ranges)
+	}
+	if blame.Next == nil || *blame.Next != 4 {
+		t.Errorf("expected next line 4, got %v", blame.Next)
+	}
+	blame, err = BlameContext(ctx, repo, "HEAD", "new.txt", 4, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blame.Ranges) != 1 || blame.Next != nil {
+		t.Errorf("expected the last line only, got %+v", blame.Ranges)
+	}
+
+	// Consecutive lines from one commit are grouped
+	blame, err = BlameContext(ctx, repo, first, "old.txt", 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blame.Ranges) != 1 || blame.Ranges[0].Lines != 3 {
+		t.Errorf("expected a single range of 3 lines, got %+v", blame.Ranges)
+	}
+
+	if _, err := BlameContext(ctx, repo, "HEAD", "missing.txt", 1, 100); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
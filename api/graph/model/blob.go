@@ -2,19 +2,27 @@ package model
 
 import (
 	"encoding/base64"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/codesearch"
 )
 
+// Blobs larger than this may only be read in ranges. They can be downloaded
+// in full over HTTP instead, which does not buffer them in memory.
+const maxBlobRead = 16 * 1024 * 1024
+
 type BinaryBlob struct {
 	Type    ObjectType `json:"type"`
 	ID      string     `json:"id"`
 	ShortID string     `json:"shortId"`
 	Raw     string     `json:"raw"`
-
-	Base64 string `json:"base64"`
+	Size    int        `json:"size"`
 
 	blob *object.Blob
 	repo *RepoWrapper
@@ -23,13 +31,25 @@ type BinaryBlob struct {
 func (BinaryBlob) IsObject() {}
 func (BinaryBlob) IsBlob()   {}
 
+func (blob *BinaryBlob) IsBinary() bool {
+	return true
+}
+
+// Returns the contents of the given range of the blob, base64 encoded.
+func (blob *BinaryBlob) Base64Range(byteRange *ByteRange) (string, error) {
+	data, err := readBlob(blob.repo, blob.blob, byteRange)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
 type TextBlob struct {
 	Type    ObjectType `json:"type"`
 	ID      string     `json:"id"`
 	ShortID string     `json:"shortId"`
 	Raw     string     `json:"raw"`
-
-	Text string `json:"text"`
+	Size    int        `json:"size"`
 
 	blob *object.Blob
 	repo *RepoWrapper
@@ -38,46 +58,116 @@ type TextBlob struct {
 func (TextBlob) IsObject() {}
 func (TextBlob) IsBlob()   {}
 
-func BlobFromObject(repo *RepoWrapper, obj *object.Blob) Object {
-	reader, err := obj.Reader()
+func (blob *TextBlob) IsBinary() bool {
+	return false
+}
+
+// Returns the contents of the given range of the blob.
+func (blob *TextBlob) TextRange(byteRange *ByteRange) (string, error) {
+	data, err := readBlob(blob.repo, blob.blob, byteRange)
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	return strings.ToValidUTF8(string(data), "�"), nil
+}
+
+// Reads the given range of the blob, or all of it if byteRange is nil.
+func readBlob(repo *RepoWrapper, blob *object.Blob,
+	byteRange *ByteRange) ([]byte, error) {
+	start, end := int64(0), blob.Size
+	if byteRange != nil {
+		start = int64(byteRange.Start)
+		if byteRange.End != nil {
+			end = int64(*byteRange.End)
+			if end < start {
+				return nil, fmt.Errorf("Invalid range %d-%d", start, end)
+			}
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("Invalid range start %d", start)
+		}
+		if end > blob.Size {
+			end = blob.Size
+		}
+		if start > end {
+			start = end
+		}
+	}
+	if end-start > maxBlobRead {
+		return nil, fmt.Errorf("Blob %s is too large to read at once; "+
+			"request a range of at most %d bytes", blob.Hash, maxBlobRead)
+	}
+
+	repo.Lock()
+	defer repo.Unlock()
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
 	}
 	defer reader.Close()
+	if _, err := io.CopyN(ioutil.Discard, reader, start); err != nil {
+		return nil, err
+	}
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
-	// XXX: Probably a bad idea
-	// An improvement would be to just read the first bit, and see if it's
-	// parsable as UTF-8, then wait to fetch the rest until the user asks for
-	// it (or, if they ask for a range, we might skip some!). This would still
-	// be kind of finicky though, because if we accidentally read half of a
-	// UTF-8 codepoint at the end of the buffer, we'll be in Problems City,
-	// population us.
-	bytes, err := ioutil.ReadAll(reader)
+// Only the start of the blob is read to determine if it is binary; the rest
+// is read on demand.
+func BlobFromObject(repo *RepoWrapper, obj *object.Blob) Object {
+	repo.Lock()
+	reader, err := obj.Reader()
 	if err != nil {
+		repo.Unlock()
+		panic(err)
+	}
+	head := make([]byte, 8000)
+	n, err := io.ReadFull(reader, head)
+	reader.Close()
+	repo.Unlock()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		panic(err)
 	}
+	head = head[:n]
 
-	text := string(bytes)
-	if utf8.ValidString(text) {
+	if !codesearch.IsBinary(head) && validUTF8Prefix(head, int64(n) < obj.Size) {
 		return &TextBlob{
 			Type:    ObjectTypeBlob,
 			ID:      obj.ID().String(),
 			ShortID: obj.ID().String()[:7],
-			Text:    text,
+			Size:    int(obj.Size),
 
 			blob: obj,
 			repo: repo,
 		}
 	} else {
-		b64 := base64.StdEncoding.EncodeToString(bytes)
 		return &BinaryBlob{
 			Type:    ObjectTypeBlob,
 			ID:      obj.ID().String(),
 			ShortID: obj.ID().String()[:7],
-			Base64:  b64,
+			Size:    int(obj.Size),
 
 			blob: obj,
 			repo: repo,
 		}
 	}
 }
+
+// Reports whether b is valid UTF-8. If b is truncated, a multi-byte
+// character may be cut off at the end.
+func validUTF8Prefix(b []byte, truncated bool) bool {
+	if truncated {
+		for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(b[i]) {
+				if !utf8.FullRune(b[i:]) {
+					b = b[:i]
+				}
+				break
+			}
+		}
+	}
+	return utf8.Valid(b)
+}
@@ -0,0 +1,86 @@
+package model
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func testBlob(t *testing.T, commit *object.Commit, name string) Object {
+	t.Helper()
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := tree.File(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return BlobFromObject(WrapRepo(nil), &file.Blob)
+}
+
+func TestBlobFromObject(t *testing.T) {
+	// "é" is two bytes, and is split at the 8000th byte of long.txt
+	commits := testCommits(t, map[string]string{
+		"text.txt":   "héllo, world\n",
+		"binary.bin": "hello\x00world",
+		"latin1.txt": "h\xe9llo",
+		"long.txt":   strings.Repeat("a", 7999) + "é" + strings.Repeat("b", 100),
+	})
+	for name, binary := range map[string]bool{
+		"text.txt":   false,
+		"binary.bin": true,
+		"latin1.txt": true,
+		"long.txt":   false,
+	} {
+		blob := testBlob(t, commits[0], name)
+		if _, ok := blob.(*BinaryBlob); ok != binary {
+			t.Errorf("%s: expected binary to be %v", name, binary)
+		}
+	}
+
+	text := testBlob(t, commits[0], "text.txt").(*TextBlob)
+	if text.Size != 14 {
+		t.Errorf("expected size 14, got %d", text.Size)
+	}
+	end := func(n int) *int { return &n }
+	for _, tc := range []struct {
+		byteRange *ByteRange
+		want      string
+	}{
+		{nil, "héllo, world\n"},
+		{&ByteRange{Start: 7}, " world\n"},
+		{&ByteRange{Start: 0, End: end(5)}, "héll"},
+		// Splits "é"
+		{&ByteRange{Start: 0, End: end(2)}, "h�"},
+		{&ByteRange{Start: 10, End: end(100)}, "rld\n"},
+		{&ByteRange{Start: 100}, ""},
+	} {
+		got, err := text.TextRange(tc.byteRange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("range %+v: got %q, want %q", tc.byteRange, got, tc.want)
+		}
+	}
+	for _, byteRange := range []*ByteRange{
+		{Start: -1},
+		{Start: 5, End: end(4)},
+	} {
+		if _, err := text.TextRange(byteRange); err == nil {
+			t.Errorf("range %+v: expected an error", byteRange)
+		}
+	}
+
+	binary := testBlob(t, commits[0], "binary.bin").(*BinaryBlob)
+	got, err := binary.Base64Range(&ByteRange{Start: 4, End: end(7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := base64.StdEncoding.EncodeToString([]byte("o\x00w")); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
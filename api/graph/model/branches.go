@@ -0,0 +1,526 @@
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+type Branch struct {
+	Name string `json:"name"`
+
+	refInfo
+}
+
+func (b *Branch) Commit() *Commit {
+	return CommitFromObject(b.repo.Repo(), b.commit)
+}
+
+type TagReference struct {
+	Name      string `json:"name"`
+	Annotated bool   `json:"annotated"`
+
+	refInfo
+}
+
+func (t *TagReference) Commit() *Commit {
+	if t.commit == nil {
+		return nil
+	}
+	return CommitFromObject(t.repo.Repo(), t.commit)
+}
+
+// Details of a branch or tag, shared by Branch and TagReference.
+type refInfo struct {
+	ref    *plumbing.Reference
+	commit *object.Commit
+	repo   *Repository
+
+	// Shared by the references of a page, so that their ahead and behind
+	// counts are computed together
+	counts        *aheadBehindCounts
+	ahead, behind *int
+}
+
+func (r *refInfo) Reference() *Reference {
+	return &Reference{Repo: r.repo, Ref: r.ref}
+}
+
+// Returns the number of commits which are reachable from this reference, but
+// not from HEAD.
+func (r *refInfo) Ahead(ctx context.Context) (*int, error) {
+	if err := r.counts.count(ctx); err != nil {
+		return nil, err
+	}
+	return r.ahead, nil
+}
+
+// Returns the number of commits which are reachable from HEAD, but not from
+// this reference.
+func (r *refInfo) Behind(ctx context.Context) (*int, error) {
+	if err := r.counts.count(ctx); err != nil {
+		return nil, err
+	}
+	return r.behind, nil
+}
+
+// The ahead and behind counts of a page of references, which are computed
+// when any of them is first requested.
+type aheadBehindCounts struct {
+	repo *Repository
+	refs []*refInfo
+
+	once sync.Once
+	err  error
+}
+
+func newAheadBehindCounts(repo *Repository,
+	refs []*refInfo) *aheadBehindCounts {
+	counts := &aheadBehindCounts{repo: repo, refs: refs}
+	for _, ref := range refs {
+		ref.counts = counts
+	}
+	return counts
+}
+
+func (c *aheadBehindCounts) count(ctx context.Context) error {
+	c.once.Do(func() { c.err = c.countOnce(ctx) })
+	return c.err
+}
+
+func (c *aheadBehindCounts) countOnce(ctx context.Context) error {
+	head := c.repo.Head()
+	if head == nil {
+		return nil
+	}
+	gitRepo := c.repo.Repo()
+	gitRepo.Lock()
+	_, err := gitRepo.CommitObject(head.Ref.Hash())
+	gitRepo.Unlock()
+	if err != nil {
+		// HEAD does not point to a commit
+		return nil
+	}
+
+	var (
+		refs    []*refInfo
+		commits []plumbing.Hash
+	)
+	for _, ref := range c.refs {
+		if ref.commit != nil {
+			refs = append(refs, ref)
+			commits = append(commits, ref.commit.Hash)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	ahead, behind, err := countAheadBehind(ctx, c.repo.Path,
+		head.Ref.Hash(), commits)
+	if err != nil {
+		return err
+	}
+	for i, ref := range refs {
+		ref.ahead, ref.behind = &ahead[i], &behind[i]
+	}
+	return nil
+}
+
+// A set of the tips from which a commit is reachable.
+type tipSet []uint64
+
+func newTipSet(n int) tipSet {
+	return make(tipSet, (n+63)/64)
+}
+
+func (s tipSet) add(i int) {
+	s[i/64] |= 1 << uint(i%64)
+}
+
+func (s tipSet) has(i int) bool {
+	return s[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (s tipSet) union(t tipSet) {
+	for i := range s {
+		s[i] |= t[i]
+	}
+}
+
+func (s tipSet) equal(t tipSet) bool {
+	for i := range s {
+		if s[i] != t[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Counts the commits which are reachable from each of the given commits but
+// not from head, and vice versa, in a single walk of the history. The walk
+// stops once the remaining commits are reachable from all of them.
+func countAheadBehind(ctx context.Context, repoPath string, head plumbing.Hash,
+	commits []plumbing.Hash) (ahead, behind []int, err error) {
+	// Tip 0 is head, and tip i is commits[i-1]
+	n := len(commits) + 1
+	all := newTipSet(n)
+	tips := make(map[plumbing.Hash]tipSet)
+	args := []string{"-C", repoPath, "rev-list", "--topo-order", "--parents"}
+	for i, hash := range append([]plumbing.Hash{head}, commits...) {
+		all.add(i)
+		set, ok := tips[hash]
+		if !ok {
+			set = newTipSet(n)
+			tips[hash] = set
+			args = append(args, hash.String())
+		}
+		set.add(i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	revList := exec.CommandContext(ctx, "git", args...)
+	var stderr bytes.Buffer
+	revList.Stderr = &stderr
+	stdout, err := revList.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := revList.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	ahead, behind = make([]int, len(commits)), make([]int, len(commits))
+	var (
+		// The tips which reach each commit which has not been listed yet.
+		// Commits are listed after all of their children.
+		pending = make(map[plumbing.Hash]tipSet)
+		// The number of pending commits not reachable from all tips
+		partial   int
+		remaining = len(tips)
+		done      bool
+	)
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		ids := strings.Fields(scanner.Text())
+		if len(ids) == 0 {
+			continue
+		}
+		hash := plumbing.NewHash(ids[0])
+		set, ok := pending[hash]
+		if ok {
+			delete(pending, hash)
+			if !set.equal(all) {
+				partial--
+			}
+		} else {
+			set = newTipSet(n)
+		}
+		if tip, ok := tips[hash]; ok {
+			set.union(tip)
+			remaining--
+		}
+
+		fromHead := set.has(0)
+		for i := 1; i < n; i++ {
+			if set.has(i) && !fromHead {
+				ahead[i-1]++
+			} else if fromHead && !set.has(i) {
+				behind[i-1]++
+			}
+		}
+
+		for _, id := range ids[1:] {
+			parent := plumbing.NewHash(id)
+			parentSet, ok := pending[parent]
+			if !ok {
+				parentSet = newTipSet(n)
+				pending[parent] = parentSet
+				partial++
+			} else if parentSet.equal(all) {
+				continue
+			}
+			parentSet.union(set)
+			if parentSet.equal(all) {
+				partial--
+			}
+		}
+
+		if remaining == 0 && partial == 0 {
+			// Everything else is reachable from all of the tips
+			done = true
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil && !done {
+		return nil, nil, err
+	}
+	cancel()
+	if err := revList.Wait(); err != nil && !done {
+		return nil, nil, fmt.Errorf("git rev-list: %s",
+			strings.TrimPrefix(strings.TrimSpace(stderr.String()), "fatal: "))
+	}
+	return ahead, behind, nil
+}
+
+// Returns a page of the branches of the repository whose names start with
+// prefix, in the given order. Branches which do not point to commits are
+// omitted.
+func BranchesWithCursor(ctx context.Context, repo *Repository,
+	cur *model.Cursor, prefix string, order ReferenceOrder) (
+	[]*Branch, *model.Cursor, error) {
+	infos, cur, err := listRefs(ctx, repo, cur, "refs/heads/", prefix, order,
+		func(r *listedRef) bool { return r.commit != nil })
+	if err != nil {
+		return nil, nil, err
+	}
+	branches := make([]*Branch, len(infos))
+	refs := make([]*refInfo, len(infos))
+	for i, info := range infos {
+		branches[i] = &Branch{
+			Name:    info.name,
+			refInfo: refInfo{ref: info.ref, commit: info.commit, repo: repo},
+		}
+		refs[i] = &branches[i].refInfo
+	}
+	newAheadBehindCounts(repo, refs)
+	return branches, cur, nil
+}
+
+// Returns a page of the tags of the repository whose names start with prefix,
+// in the given order.
+func TagsWithCursor(ctx context.Context, repo *Repository, cur *model.Cursor,
+	prefix string, order ReferenceOrder) ([]*TagReference, *model.Cursor, error) {
+	infos, cur, err := listRefs(ctx, repo, cur, "refs/tags/", prefix, order,
+		func(r *listedRef) bool { return true })
+	if err != nil {
+		return nil, nil, err
+	}
+	tags := make([]*TagReference, len(infos))
+	refs := make([]*refInfo, len(infos))
+	for i, info := range infos {
+		tags[i] = &TagReference{
+			Name:      info.name,
+			Annotated: info.annotated,
+			refInfo:   refInfo{ref: info.ref, commit: info.commit, repo: repo},
+		}
+		refs[i] = &tags[i].refInfo
+	}
+	newAheadBehindCounts(repo, refs)
+	return tags, cur, nil
+}
+
+type listedRef struct {
+	name      string
+	ref       *plumbing.Reference
+	commit    *object.Commit
+	annotated bool
+	date      time.Time
+}
+
+// Cursors for references sorted by date are "<unix time>:<name>", and
+// otherwise the name, of the first reference of the next page.
+func (r *listedRef) cursor(order ReferenceOrder) string {
+	if order == ReferenceOrderDate {
+		return fmt.Sprintf("%d:%s", r.date.Unix(), r.name)
+	}
+	return r.name
+}
+
+func parseRefCursor(next string, order ReferenceOrder) (*listedRef, error) {
+	if order != ReferenceOrderDate {
+		return &listedRef{name: next}, nil
+	}
+	parts := strings.SplitN(next, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor")
+	}
+	return &listedRef{name: parts[1], date: time.Unix(ts, 0)}, nil
+}
+
+// Reports whether a sorts before b in the given order.
+func (a *listedRef) less(b *listedRef, order ReferenceOrder) bool {
+	if order == ReferenceOrderDate && a.date.Unix() != b.date.Unix() {
+		return a.date.Unix() > b.date.Unix()
+	}
+	return a.name < b.name
+}
+
+// Lists a page of the references under refPrefix, e.g. "refs/heads/", whose
+// names without refPrefix start with prefix, and for which keep returns true.
+// Only the references on the page are peeled with go-git; when sorting by
+// date, the dates of the others are read by git for-each-ref.
+func listRefs(ctx context.Context, repo *Repository, cur *model.Cursor,
+	refPrefix, prefix string, order ReferenceOrder,
+	keep func(r *listedRef) bool) ([]*listedRef, *model.Cursor, error) {
+	var next *listedRef
+	if cur.Next != "" {
+		var err error
+		if next, err = parseRefCursor(cur.Next, order); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		refs []*listedRef
+		err  error
+	)
+	if order == ReferenceOrderDate {
+		refs, err = listRefDates(ctx, repo.Path, refPrefix, prefix)
+	} else {
+		refs, err = listRefNames(repo, refPrefix, prefix)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].less(refs[j], order)
+	})
+	if next != nil {
+		i := sort.Search(len(refs), func(n int) bool {
+			return !refs[n].less(next, order)
+		})
+		refs = refs[i:]
+	}
+
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	defer gitRepo.Unlock()
+	var page []*listedRef
+	for _, r := range refs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if err := peelRef(gitRepo, r); err != nil {
+			return nil, nil, err
+		}
+		if !keep(r) {
+			continue
+		}
+		page = append(page, r)
+		if len(page) > cur.Count {
+			break
+		}
+	}
+
+	if len(page) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   page[cur.Count].cursor(order),
+			Search: cur.Search,
+		}
+		page = page[:cur.Count]
+	} else {
+		cur = nil
+	}
+	return page, cur, nil
+}
+
+// Lists the references under refPrefix whose names without refPrefix start
+// with prefix.
+func listRefNames(repo *Repository, refPrefix, prefix string) (
+	[]*listedRef, error) {
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	defer gitRepo.Unlock()
+	iter, err := gitRepo.References()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var refs []*listedRef
+	if err := iter.ForEach(func(ref *plumbing.Reference) error {
+		name := string(ref.Name())
+		if ref.Type() != plumbing.HashReference ||
+			!strings.HasPrefix(name, refPrefix+prefix) {
+			return nil
+		}
+		refs = append(refs, &listedRef{
+			name: strings.TrimPrefix(name, refPrefix),
+			ref:  ref,
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// Like listRefNames, but also reads the date of the commit which each
+// reference points to, or which the tag it points to points to.
+func listRefDates(ctx context.Context, repoPath, refPrefix, prefix string) (
+	[]*listedRef, error) {
+	forEachRef := exec.CommandContext(ctx, "git", "-C", repoPath,
+		"for-each-ref", "--format=%(objectname) %(committerdate:unix) "+
+			"%(*committerdate:unix) %(refname)", refPrefix)
+	var stderr bytes.Buffer
+	forEachRef.Stderr = &stderr
+	out, err := forEachRef.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref: %s",
+			strings.TrimPrefix(strings.TrimSpace(stderr.String()), "fatal: "))
+	}
+
+	var refs []*listedRef
+	for _, line := range strings.Split(string(out), "\n") {
+		// The dates are empty if the reference does not point to a commit
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) != 4 || !strings.HasPrefix(fields[3], refPrefix+prefix) {
+			continue
+		}
+		r := &listedRef{
+			name: strings.TrimPrefix(fields[3], refPrefix),
+			ref: plumbing.NewHashReference(
+				plumbing.ReferenceName(fields[3]), plumbing.NewHash(fields[0])),
+		}
+		for _, date := range fields[1:3] {
+			if ts, err := strconv.ParseInt(date, 10, 64); err == nil {
+				r.date = time.Unix(ts, 0)
+			}
+		}
+		refs = append(refs, r)
+	}
+	return refs, nil
+}
+
+// Looks up the commit which the reference points to, if any, following tags.
+// The caller must hold the lock.
+func peelRef(gitRepo *RepoWrapper, r *listedRef) error {
+	obj, err := gitRepo.Object(plumbing.AnyObject, r.ref.Hash())
+	if err == plumbing.ErrObjectNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Tags may point to other tags
+	for tag, ok := obj.(*object.Tag); ok; tag, ok = obj.(*object.Tag) {
+		r.annotated = true
+		if obj, err = tag.Object(); err == plumbing.ErrObjectNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if commit, ok := obj.(*object.Commit); ok {
+		r.commit = commit
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+// Creates a repository whose master branch has three commits, with these
+// branches:
+//
+// - old, at the first commit
+// - feature, two commits ahead of the second commit
+// - same, at master
+// - blob, at a blob
+func testBranchRepo(t *testing.T) *Repository {
+	t.Helper()
+	dir, run := testRepo(t)
+	commit := func(msg string, ts int) {
+		t.Helper()
+		os.Setenv("GIT_COMMITTER_DATE", fmt.Sprintf("@%d +0000", ts))
+		defer os.Unsetenv("GIT_COMMITTER_DATE")
+		run("commit", "--quiet", "--allow-empty", "-m", msg)
+	}
+	run("checkout", "--quiet", "-b", "master")
+	commit("First", 1000)
+	run("branch", "old")
+	run("tag", "-a", "-m", "Version 1.0", "v1.0")
+	commit("Second", 2000)
+	run("checkout", "--quiet", "-b", "feature")
+	commit("Feature", 5000)
+	commit("More feature", 6000)
+	run("tag", "v2.0-rc1")
+	run("checkout", "--quiet", "master")
+	commit("Third", 3000)
+	run("branch", "same")
+
+	// git refuses to point branches at anything but commits
+	blob := run("hash-object", "-w", "--stdin")
+	err := ioutil.WriteFile(path.Join(dir, ".git", "refs", "heads", "blob"),
+		[]byte(blob+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Repository{Path: dir}
+}
+
+func TestBranchesWithCursor(t *testing.T) {
+	repo := testBranchRepo(t)
+	ctx := context.Background()
+
+	var names []string
+	ahead := make(map[string]int)
+	behind := make(map[string]int)
+	cur := &model.Cursor{Count: 2}
+	for pages := 0; cur != nil; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		var (
+			branches []*Branch
+			err      error
+		)
+		branches, cur, err = BranchesWithCursor(ctx, repo, cur, "",
+			ReferenceOrderName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The blob branch does not leave a page short
+		if cur != nil && len(branches) != 2 {
+			t.Fatalf("expected a full page, got %d branches", len(branches))
+		}
+		for _, b := range branches {
+			names = append(names, b.Name)
+			a, err := b.Ahead(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bh, err := b.Behind(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ahead[b.Name], behind[b.Name] = *a, *bh
+		}
+	}
+
+	if got := strings.Join(names, " "); got != "feature master old same" {
+		t.Errorf("got branches %q", got)
+	}
+	for _, tc := range []struct {
+		name          string
+		ahead, behind int
+	}{
+		{"feature", 2, 1},
+		{"master", 0, 0},
+		{"old", 0, 2},
+		{"same", 0, 0},
+	} {
+		if ahead[tc.name] != tc.ahead || behind[tc.name] != tc.behind {
+			t.Errorf("%s: %d ahead, %d behind; want %d ahead, %d behind",
+				tc.name, ahead[tc.name], behind[tc.name], tc.ahead, tc.behind)
+		}
+	}
+}
+
+func TestBranchesWithCursorDate(t *testing.T) {
+	repo := testBranchRepo(t)
+	ctx := context.Background()
+
+	var names []string
+	cur := &model.Cursor{Count: 1}
+	for pages := 0; cur != nil; pages++ {
+		if pages > 5 {
+			t.Fatal("too many pages")
+		}
+		var (
+			branches []*Branch
+			err      error
+		)
+		branches, cur, err = BranchesWithCursor(ctx, repo, cur, "",
+			ReferenceOrderDate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, b := range branches {
+			names = append(names, b.Name)
+		}
+	}
+	// master and same point to the same commit, and are sorted by name
+	if got := strings.Join(names, " "); got != "feature master same old" {
+		t.Errorf("got branches %q", got)
+	}
+}
+
+func TestTagsWithCursor(t *testing.T) {
+	repo := testBranchRepo(t)
+	ctx := context.Background()
+
+	tags, cur, err := TagsWithCursor(ctx, repo, &model.Cursor{Count: 10}, "",
+		ReferenceOrderDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur != nil || len(tags) != 2 {
+		t.Fatalf("expected 2 tags on one page, got %d", len(tags))
+	}
+	if tags[0].Name != "v2.0-rc1" || tags[0].Annotated {
+		t.Errorf("expected the lightweight v2.0-rc1 first, got %s", tags[0].Name)
+	}
+	if tags[1].Name != "v1.0" || !tags[1].Annotated || tags[1].Commit() == nil {
+		t.Errorf("expected the annotated v1.0 second, got %s", tags[1].Name)
+	}
+	ahead, err := tags[1].Ahead(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	behind, err := tags[1].Behind(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *ahead != 0 || *behind != 2 {
+		t.Errorf("v1.0: %d ahead, %d behind; want 0 ahead, 2 behind",
+			*ahead, *behind)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/sigverify"
 )
 
 type Commit struct {
@@ -38,13 +40,50 @@ func (c *Commit) Committer() *Signature {
 	}
 }
 
-func (c *Commit) DiffContext(ctx context.Context) string {
-	parent, _ := c.commit.Parent(0)
-	patch, _ := c.commit.PatchContext(ctx, parent)
-	if patch != nil {
-		return patch.String()
+func (c *Commit) Signature() (*ObjectSignature, error) {
+	raw, err := readRawObject(c.repo, c.commit.Hash)
+	if err != nil {
+		return nil, err
+	}
+	data, armored := sigverify.SplitCommit(raw)
+	return parseSignature(armored, data, c.commit.Committer.Email), nil
+}
+
+func (c *Commit) DiffContext(ctx context.Context) (string, error) {
+	var parent *object.Commit
+	if c.commit.NumParents() != 0 {
+		var err error
+		if parent, err = c.commit.Parent(0); err != nil {
+			return "", err
+		}
+	}
+	patch, err := c.commit.PatchContext(ctx, parent)
+	if err != nil {
+		return "", err
+	}
+	return patch.String(), nil
+}
+
+// Computes the changes introduced by this commit relative to the given base
+// revision, or to its first parent if base is nil.
+func (c *Commit) StructuredDiffContext(ctx context.Context,
+	base *string, contextLines int) (*Diff, error) {
+	c.repo.Lock()
+	defer c.repo.Unlock()
+
+	var (
+		baseCommit *object.Commit
+		err        error
+	)
+	if base != nil {
+		baseCommit, err = c.repo.ResolveCommit(*base)
+	} else if c.commit.NumParents() != 0 {
+		baseCommit, err = c.commit.Parent(0)
+	}
+	if err != nil {
+		return nil, err
 	}
-	return ""
+	return DiffCommits(ctx, c.repo, baseCommit, c.commit, contextLines)
 }
 
 func (c *Commit) Tree() *Tree {
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+type Comparison struct {
+	Base      *Commit `json:"base"`
+	Head      *Commit `json:"head"`
+	MergeBase *Commit `json:"mergeBase"`
+
+	path string
+	repo *RepoWrapper
+}
+
+// Compares the base and head revspecs of the given repository.
+func CompareRevisions(r *Repository, base, head string) (*Comparison, error) {
+	repo := r.Repo()
+	repo.Lock()
+	defer repo.Unlock()
+
+	baseCommit, err := repo.ResolveCommit(base)
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := repo.ResolveCommit(head)
+	if err != nil {
+		return nil, err
+	}
+	mergeBases, err := baseCommit.MergeBase(headCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &Comparison{
+		Base: CommitFromObject(repo, baseCommit),
+		Head: CommitFromObject(repo, headCommit),
+		path: r.Path,
+		repo: repo,
+	}
+	if len(mergeBases) != 0 {
+		cmp.MergeBase = CommitFromObject(repo, mergeBases[0])
+	}
+	return cmp, nil
+}
+
+// Returns up to limit commits which are reachable from head but not from
+// base, sorted by committer time. If from is not empty, it is interpreted as
+// a revspec to start from instead of head.
+//
+// git rev-list stops walking once the remaining commits are all reachable from
+// base, whereas go-git would have to walk the whole history of base.
+func (c *Comparison) Log(ctx context.Context,
+	from string, limit int) ([]*Commit, error) {
+	start := c.Head.commit
+	if from != "" {
+		var err error
+		c.repo.Lock()
+		start, err = c.repo.ResolveCommit(from)
+		c.repo.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	revList := exec.CommandContext(ctx, "git", "-C", c.path, "rev-list",
+		"--max-count="+strconv.Itoa(limit), start.Hash.String(),
+		"^"+c.Base.commit.Hash.String(), "--")
+	var stderr bytes.Buffer
+	revList.Stderr = &stderr
+	out, err := revList.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-list: %s",
+			strings.TrimPrefix(strings.TrimSpace(stderr.String()), "fatal: "))
+	}
+
+	c.repo.Lock()
+	defer c.repo.Unlock()
+	var commits []*Commit
+	for _, id := range strings.Fields(string(out)) {
+		commit, err := c.repo.CommitObject(plumbing.NewHash(id))
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, CommitFromObject(c.repo, commit))
+	}
+	return commits, nil
+}
+
+// Computes the changes made on head since it diverged from base, i.e. relative
+// to the merge base. If the revisions have no common history, the changes are
+// relative to base.
+func (c *Comparison) DiffContext(ctx context.Context,
+	contextLines int) (*Diff, error) {
+	c.repo.Lock()
+	defer c.repo.Unlock()
+
+	base := c.Base.commit
+	if c.MergeBase != nil {
+		base = c.MergeBase.commit
+	}
+	return DiffCommits(ctx, c.repo, base, c.Head.commit, contextLines)
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"context"
+	"testing"
+)
+
+func TestComparisonLog(t *testing.T) {
+	dir, run := testRepo(t)
+	commit := func(message string) string {
+		run("commit", "--quiet", "--allow-empty", "-m", message)
+		return run("rev-parse", "HEAD")
+	}
+	run("checkout", "--quiet", "-b", "main")
+	root := commit("A")
+	commit("B")
+	run("checkout", "--quiet", "-b", "feature", root)
+	c := commit("C")
+	d := commit("D")
+
+	repo := &Repository{Path: dir}
+	cmp, err := CompareRevisions(repo, "main", "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmp.MergeBase == nil || cmp.MergeBase.ID != root {
+		t.Fatalf("expected merge base %s", root)
+	}
+
+	ctx := context.Background()
+	commits, err := cmp.Log(ctx, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].ID != d || commits[1].ID != c {
+		t.Fatalf("expected %s, %s; got %d commits", d, c, len(commits))
+	}
+
+	// Paging
+	commits, err = cmp.Log(ctx, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].ID != d {
+		t.Fatalf("expected %s only", d)
+	}
+	commits, err = cmp.Log(ctx, c, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].ID != c {
+		t.Fatalf("expected %s only", c)
+	}
+
+	// Nothing on main is missing from main
+	cmp, err = CompareRevisions(repo, "feature", "main~1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commits, err = cmp.Log(ctx, "", 10); err != nil {
+		t.Fatal(err)
+	} else if len(commits) != 0 {
+		t.Fatalf("expected no commits, got %d", len(commits))
+	}
+}
@@ -0,0 +1,259 @@
+package model
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+const (
+	// Files beyond this many are omitted from a diff
+	maxDiffFiles = 1000
+	// Hunks beyond this many lines in total are omitted from a diff
+	maxDiffLines = 10000
+	// Files larger than this are not diffed line by line
+	maxDiffFileSize = 1 << 20
+)
+
+// Computes the changes from base to commit, detecting renamed and copied
+// files. If base is nil, the changes are relative to the empty tree. The
+// caller must hold the repository lock.
+//
+// Large diffs are truncated, either by omitting files beyond maxDiffFiles, or
+// by omitting the hunks of files beyond maxDiffLines lines.
+func DiffCommits(ctx context.Context, repo *RepoWrapper,
+	base, commit *object.Commit, contextLines int) (*Diff, error) {
+	if contextLines < 0 {
+		contextLines = 0
+	}
+	var baseTree *object.Tree
+	if base != nil {
+		var err error
+		if baseTree, err = base.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, baseTree, tree,
+		object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// go-git only detects renames, so added files which are identical to a
+	// file modified by the same change are reported as copies of it.
+	sources := make(map[plumbing.Hash]object.ChangeEntry)
+	for _, change := range changes {
+		if change.From.Name != "" && change.To.Name == change.From.Name {
+			sources[change.From.TreeEntry.Hash] = change.From
+		}
+	}
+
+	result := &Diff{Files: []*FileDiff{}}
+	if base != nil {
+		result.Base = CommitFromObject(repo, base)
+	}
+	budget := maxDiffLines
+	for i, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if i == maxDiffFiles {
+			result.Truncated = true
+			break
+		}
+		fd, err := diffChange(change, sources, contextLines, &budget)
+		if err != nil {
+			return nil, err
+		}
+		result.Truncated = result.Truncated || fd.Truncated
+		result.Files = append(result.Files, fd)
+		result.Insertions += fd.Insertions
+		result.Deletions += fd.Deletions
+	}
+	return result, nil
+}
+
+// Computes the changes to a single file, whose hunks may have up to budget
+// lines in total. The budget is reduced by the number of lines included.
+func diffChange(change *object.Change,
+	sources map[plumbing.Hash]object.ChangeEntry,
+	contextLines int, budget *int) (*FileDiff, error) {
+	from, to := change.From, change.To
+	fd := &FileDiff{Hunks: []*DiffHunk{}}
+	switch {
+	case from.Name == "":
+		fd.ChangeType = DiffChangeTypeAdded
+		if source, ok := sources[to.TreeEntry.Hash]; ok {
+			fd.ChangeType = DiffChangeTypeCopied
+			from = source
+		}
+	case to.Name == "":
+		fd.ChangeType = DiffChangeTypeDeleted
+	case from.Name != to.Name:
+		fd.ChangeType = DiffChangeTypeRenamed
+	default:
+		fd.ChangeType = DiffChangeTypeModified
+	}
+	if from.Name != "" {
+		mode := int(from.TreeEntry.Mode)
+		id := from.TreeEntry.Hash.String()
+		fd.OldPath, fd.OldMode, fd.OldID = &from.Name, &mode, &id
+	}
+	if to.Name != "" {
+		mode := int(to.TreeEntry.Mode)
+		id := to.TreeEntry.Hash.String()
+		fd.NewPath, fd.NewMode, fd.NewID = &to.Name, &mode, &id
+	}
+	if fd.ChangeType == DiffChangeTypeCopied {
+		// The contents are identical
+		return fd, nil
+	}
+
+	fromFile, toFile, err := change.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	var fromContent, toContent string
+	for _, f := range []struct {
+		file    *object.File
+		content *string
+	}{{fromFile, &fromContent}, {toFile, &toContent}} {
+		if f.file == nil {
+			continue
+		}
+		if binary, err := f.file.IsBinary(); err != nil {
+			return nil, err
+		} else if binary {
+			fd.Binary = true
+			return fd, nil
+		}
+		if *budget <= 0 || f.file.Size > maxDiffFileSize {
+			fd.Truncated = true
+			return fd, nil
+		}
+		if *f.content, err = f.file.Contents(); err != nil {
+			return nil, err
+		}
+	}
+
+	lines, oldBefore, newBefore := diffLines(diff.Do(fromContent, toContent))
+	for _, line := range lines {
+		switch line.Type {
+		case DiffLineTypeAddition:
+			fd.Insertions++
+		case DiffLineTypeDeletion:
+			fd.Deletions++
+		}
+	}
+	for _, hunk := range diffHunks(lines, oldBefore, newBefore, contextLines) {
+		if len(hunk.Lines) > *budget {
+			fd.Truncated = true
+			*budget = 0
+			break
+		}
+		*budget -= len(hunk.Lines)
+		fd.Hunks = append(fd.Hunks, hunk)
+	}
+	return fd, nil
+}
+
+// Splits a line-oriented diff into numbered lines. For each line, the number
+// of old and new lines which precede it are also returned.
+func diffLines(chunks []diffmatchpatch.Diff) (
+	lines []*DiffLine, oldBefore, newBefore []int) {
+	var oldNo, newNo int
+	for _, chunk := range chunks {
+		if chunk.Text == "" {
+			continue
+		}
+		for _, text := range strings.Split(
+			strings.TrimSuffix(chunk.Text, "\n"), "\n") {
+			oldBefore = append(oldBefore, oldNo)
+			newBefore = append(newBefore, newNo)
+			line := &DiffLine{Content: text}
+			switch chunk.Type {
+			case diffmatchpatch.DiffEqual:
+				oldNo++
+				newNo++
+				o, n := oldNo, newNo
+				line.Type = DiffLineTypeContext
+				line.OldNumber, line.NewNumber = &o, &n
+			case diffmatchpatch.DiffDelete:
+				oldNo++
+				o := oldNo
+				line.Type = DiffLineTypeDeletion
+				line.OldNumber = &o
+			case diffmatchpatch.DiffInsert:
+				newNo++
+				n := newNo
+				line.Type = DiffLineTypeAddition
+				line.NewNumber = &n
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines, oldBefore, newBefore
+}
+
+// Groups changed lines into hunks with up to contextLines unchanged lines on
+// either side. Changes separated by no more than twice that many unchanged
+// lines share a hunk, as with diff -U.
+func diffHunks(lines []*DiffLine, oldBefore, newBefore []int,
+	contextLines int) []*DiffHunk {
+	hunks := []*DiffHunk{}
+	for i := 0; i < len(lines); {
+		if lines[i].Type == DiffLineTypeContext {
+			i++
+			continue
+		}
+
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		last := i
+		for j := i + 1; j < len(lines) && j-last-1 <= 2*contextLines; j++ {
+			if lines[j].Type != DiffLineTypeContext {
+				last = j
+			}
+		}
+		end := last + contextLines + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		hunk := &DiffHunk{
+			OldStart: oldBefore[start],
+			NewStart: newBefore[start],
+			Lines:    lines[start:end],
+		}
+		for _, line := range hunk.Lines {
+			if line.OldNumber != nil {
+				hunk.OldLines++
+			}
+			if line.NewNumber != nil {
+				hunk.NewLines++
+			}
+		}
+		// Like diff -U, empty ranges start at the line before them
+		if hunk.OldLines != 0 {
+			hunk.OldStart++
+		}
+		if hunk.NewLines != 0 {
+			hunk.NewStart++
+		}
+		hunks = append(hunks, hunk)
+		i = end
+	}
+	return hunks
+}
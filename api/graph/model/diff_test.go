@@ -0,0 +1,192 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Creates an empty repository in a temporary directory, and returns its path
+// and a function which runs git commands in it.
+func testRepo(t *testing.T) (string, func(args ...string) string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gitsrht-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Example", "GIT_AUTHOR_EMAIL=example@example.org",
+			"GIT_COMMITTER_NAME=Example", "GIT_COMMITTER_EMAIL=example@example.org",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "--quiet")
+	return dir, run
+}
+
+// Creates a repository with a commit for each of the given sets of files, and
+// returns the commits.
+func testCommits(t *testing.T, trees ...map[string]string) []*object.Commit {
+	t.Helper()
+	dir, run := testRepo(t)
+	for _, files := range trees {
+		run("rm", "-r", "--quiet", "--ignore-unmatch", ".")
+		for name, content := range files {
+			p := path.Join(dir, name)
+			if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		run("add", "--all")
+		run("commit", "--quiet", "--allow-empty", "-m", "Commit")
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits := []*object.Commit{commit}
+	for len(commit.ParentHashes) != 0 {
+		if commit, err = commit.Parent(0); err != nil {
+			t.Fatal(err)
+		}
+		commits = append([]*object.Commit{commit}, commits...)
+	}
+	return commits
+}
+
+func numberedLines(n int) string {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		sb.WriteString(strings.Repeat("x", i%7) + "\n")
+	}
+	return sb.String()
+}
+
+func TestDiffCommits(t *testing.T) {
+	commits := testCommits(t,
+		map[string]string{"a.txt": "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"},
+		map[string]string{"a.txt": "one\n2\nthree\nfour\nfive\nsix\nseven\neight\n"})
+	diff, err := DiffCommits(context.Background(), nil, nil, commits[1], 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Files) != 1 || diff.Truncated {
+		t.Fatalf("expected one complete file, got %d (truncated: %v)",
+			len(diff.Files), diff.Truncated)
+	}
+	// Relative to the empty tree
+	if fd := diff.Files[0]; fd.ChangeType != DiffChangeTypeAdded ||
+		fd.Insertions != 8 || fd.Deletions != 0 {
+		t.Errorf("unexpected file diff: %s +%d -%d",
+			fd.ChangeType, fd.Insertions, fd.Deletions)
+	}
+
+	// With one line of context, the changes are too far apart to share a hunk
+	lines, oldBefore, newBefore := diffLines([]diffmatchpatch.Diff{
+		{Type: diffmatchpatch.DiffEqual, Text: "one\n"},
+		{Type: diffmatchpatch.DiffDelete, Text: "two\n"},
+		{Type: diffmatchpatch.DiffInsert, Text: "2\n"},
+		{Type: diffmatchpatch.DiffEqual, Text: "three\nfour\nfive\nsix\nseven\n"},
+		{Type: diffmatchpatch.DiffInsert, Text: "eight\n"},
+	})
+	hunks := diffHunks(lines, oldBefore, newBefore, 1)
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+	for i, want := range []DiffHunk{
+		{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3},
+		{OldStart: 7, OldLines: 1, NewStart: 7, NewLines: 2},
+	} {
+		h := hunks[i]
+		if h.OldStart != want.OldStart || h.OldLines != want.OldLines ||
+			h.NewStart != want.NewStart || h.NewLines != want.NewLines {
+			t.Errorf("hunk %d: @@ -%d,%d +%d,%d @@, want @@ -%d,%d +%d,%d @@",
+				i, h.OldStart, h.OldLines, h.NewStart, h.NewLines,
+				want.OldStart, want.OldLines, want.NewStart, want.NewLines)
+		}
+	}
+
+	// With three, they do
+	if hunks := diffHunks(lines, oldBefore, newBefore, 3); len(hunks) != 1 {
+		t.Errorf("expected 1 hunk, got %d", len(hunks))
+	}
+}
+
+func TestDiffCommitsTruncated(t *testing.T) {
+	commits := testCommits(t, map[string]string{
+		"a.txt": numberedLines(maxDiffLines - 10),
+		"b.txt": numberedLines(20),
+		"c.txt": numberedLines(5),
+	})
+	diff, err := DiffCommits(context.Background(), nil, nil, commits[0], 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Truncated || len(diff.Files) != 3 {
+		t.Fatalf("expected 3 files and a truncated diff, got %d (truncated: %v)",
+			len(diff.Files), diff.Truncated)
+	}
+	a, b, c := diff.Files[0], diff.Files[1], diff.Files[2]
+	if a.Truncated || len(a.Hunks) != 1 {
+		t.Errorf("a.txt: expected one complete hunk")
+	}
+	// b.txt exceeds the remaining budget, but is still counted
+	if !b.Truncated || len(b.Hunks) != 0 || b.Insertions != 20 {
+		t.Errorf("b.txt: expected no hunks and 20 insertions, got %d, +%d",
+			len(b.Hunks), b.Insertions)
+	}
+	// Nothing is left for c.txt
+	if !c.Truncated || len(c.Hunks) != 0 || c.Insertions != 0 {
+		t.Errorf("c.txt: expected not to be compared, got %d hunks, +%d",
+			len(c.Hunks), c.Insertions)
+	}
+	if diff.Insertions != maxDiffLines+10 {
+		t.Errorf("expected %d insertions, got %d", maxDiffLines+10, diff.Insertions)
+	}
+}
+
+func TestDiffCommitsTooManyFiles(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < maxDiffFiles+5; i++ {
+		files[fmt.Sprintf("dir/%04d.txt", i)] = fmt.Sprintf("%d\n", i)
+	}
+	commits := testCommits(t, files)
+	diff, err := DiffCommits(context.Background(), nil, nil, commits[0], 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Truncated || len(diff.Files) != maxDiffFiles {
+		t.Errorf("expected %d files and a truncated diff, got %d (truncated: %v)",
+			maxDiffFiles, len(diff.Files), diff.Truncated)
+	}
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"path"
+	"strings"
+
+	"git.sr.ht/~turminal/go-fnmatch"
+)
+
+// Reports whether name matches the given glob pattern. Patterns are matched
+// with fnmatch(3) and FNM_PATHNAME, as with build manifests, except that "**"
+// matches any number of directories. Patterns without a slash are matched
+// against the base name only, like .gitignore, so "*.go" matches Go files in
+// any directory.
+func MatchGlob(pattern, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	name = strings.Trim(name, "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		return fnmatch.Match(pattern, path.Base(name), fnmatch.FNM_PATHNAME)
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 ||
+			!fnmatch.Match(pattern[0], name[0], fnmatch.FNM_PATHNAME) {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
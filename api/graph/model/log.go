@@ -0,0 +1,326 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+// Criteria for filtering the commit log. Commits must match all of them.
+type logFilter struct {
+	author    string
+	committer string
+	since     *time.Time
+	until     *time.Time
+	message   *regexp.Regexp
+}
+
+// Parses a commit log search string. The terms author:name and committer:name
+// match a case-insensitive substring of the name or email address, and
+// since:date and until:date limit the commit time, given either in RFC 3339
+// format or as a date. The remaining terms are joined with spaces and matched
+// against the commit message as a case-insensitive regular expression. Values
+// containing spaces may be enclosed in double quotes.
+func parseLogSearch(search string) (*logFilter, error) {
+	var (
+		filter  logFilter
+		message []string
+	)
+	parseTime := func(key, value string, endOfDay bool) (*time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return &t, nil
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s date '%s'", key, value)
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return &t, nil
+	}
+	for _, term := range splitSearchTerms(search) {
+		var err error
+		parts := strings.SplitN(term, ":", 2)
+		switch {
+		case len(parts) == 2 && parts[0] == "author":
+			filter.author = strings.ToLower(parts[1])
+		case len(parts) == 2 && parts[0] == "committer":
+			filter.committer = strings.ToLower(parts[1])
+		case len(parts) == 2 && parts[0] == "since":
+			filter.since, err = parseTime(parts[0], parts[1], false)
+		case len(parts) == 2 && parts[0] == "until":
+			filter.until, err = parseTime(parts[0], parts[1], true)
+		default:
+			message = append(message, term)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(message) != 0 {
+		re, err := regexp.Compile("(?i)" + strings.Join(message, " "))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid message pattern: %v", err)
+		}
+		filter.message = re
+	}
+	return &filter, nil
+}
+
+// Splits a search string into terms separated by whitespace, except within
+// double quotes. The quotes are removed.
+func splitSearchTerms(search string) []string {
+	var (
+		terms  []string
+		term   strings.Builder
+		quoted bool
+		inTerm bool
+	)
+	for _, r := range search {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inTerm = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if inTerm {
+				terms = append(terms, term.String())
+				term.Reset()
+				inTerm = false
+			}
+		default:
+			term.WriteRune(r)
+			inTerm = true
+		}
+	}
+	if inTerm {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+// Returns a page of the history of the given repository, sorted by committer
+// time, starting from the given revspec or from the cursor. Commits are
+// filtered by the cursor's search string (see parseLogSearch). If path is not
+// empty, only commits which change the file or directory at that path are
+// included, following renames of the file if follow is set. When following
+// renames, the cursor records the path of the file as of the next commit
+// alongside the commit ID.
+func LogWithCursor(ctx context.Context, repo *RepoWrapper, cur *model.Cursor,
+	from, path string, follow bool) ([]*Commit, *model.Cursor, error) {
+	filter, err := parseLogSearch(cur.Search)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path = strings.Trim(path, "/")
+	if cur.Next != "" {
+		from = cur.Next
+		if follow {
+			parts := strings.SplitN(cur.Next, ":", 2)
+			if len(parts) != 2 {
+				return nil, nil, fmt.Errorf("Invalid cursor")
+			}
+			from, path = parts[0], parts[1]
+		}
+	}
+
+	repo.Lock()
+	defer repo.Unlock()
+
+	var start *object.Commit
+	if from != "" {
+		start, err = repo.ResolveCommit(from)
+	} else {
+		var head *plumbing.Reference
+		if head, err = repo.Head(); err == nil {
+			start, err = repo.CommitObject(head.Hash())
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		commits []*Commit
+		paths   []string
+		entries = make(map[plumbing.Hash]plumbing.Hash)
+	)
+	err = object.NewCommitIterCTime(start, nil, nil).
+		ForEach(func(c *object.Commit) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !filter.matches(c) {
+				return nil
+			}
+
+			commitPath := path
+			if path != "" {
+				touched, err := touchesPath(c, path, entries)
+				if err != nil {
+					return err
+				}
+				if !touched {
+					return nil
+				}
+				if follow {
+					if path, err = renamedFrom(ctx, c, path); err != nil {
+						return err
+					}
+					if path != commitPath {
+						entries = make(map[plumbing.Hash]plumbing.Hash)
+					}
+				}
+			}
+
+			commits = append(commits, CommitFromObject(repo, c))
+			paths = append(paths, commitPath)
+			if len(commits) == cur.Count+1 {
+				return storer.ErrStop
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(commits) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   commits[cur.Count].ID,
+			Search: cur.Search,
+		}
+		if follow {
+			cur.Next += ":" + paths[cur.Count]
+		}
+		commits = commits[:cur.Count]
+	} else {
+		cur = nil
+	}
+	return commits, cur, nil
+}
+
+// Returns true if the commit matches all of the criteria of the filter.
+func (f *logFilter) matches(c *object.Commit) bool {
+	contains := func(sig object.Signature, substr string) bool {
+		return strings.Contains(
+			strings.ToLower(sig.Name+" <"+sig.Email+">"), substr)
+	}
+	if f.author != "" && !contains(c.Author, f.author) {
+		return false
+	}
+	if f.committer != "" && !contains(c.Committer, f.committer) {
+		return false
+	}
+	if f.since != nil && c.Committer.When.Before(*f.since) {
+		return false
+	}
+	if f.until != nil && c.Committer.When.After(*f.until) {
+		return false
+	}
+	if f.message != nil && !f.message.MatchString(c.Message) {
+		return false
+	}
+	return true
+}
+
+// Returns true if the commit changes the file or directory at the given path
+// relative to each of its parents, like git log's default history
+// simplification. The hashes of the entry at the path are cached in entries,
+// keyed by commit.
+func touchesPath(c *object.Commit, path string,
+	entries map[plumbing.Hash]plumbing.Hash) (bool, error) {
+	entryHash := func(c *object.Commit) (plumbing.Hash, error) {
+		if hash, ok := entries[c.Hash]; ok {
+			return hash, nil
+		}
+		tree, err := c.Tree()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		var hash plumbing.Hash
+		entry, err := tree.FindEntry(path)
+		if err == nil {
+			hash = entry.Hash
+		} else if err != object.ErrEntryNotFound &&
+			err != object.ErrDirectoryNotFound &&
+			// One of the parent directories is not a tree
+			err != plumbing.ErrObjectNotFound {
+			return plumbing.ZeroHash, err
+		}
+		entries[c.Hash] = hash
+		return hash, nil
+	}
+
+	hash, err := entryHash(c)
+	if err != nil {
+		return false, err
+	}
+	if c.NumParents() == 0 {
+		return !hash.IsZero(), nil
+	}
+	touched := true
+	err = c.Parents().ForEach(func(parent *object.Commit) error {
+		parentHash, err := entryHash(parent)
+		if err != nil {
+			return err
+		}
+		if parentHash == hash {
+			touched = false
+			return storer.ErrStop
+		}
+		return nil
+	})
+	return touched, err
+}
+
+// If the commit renames a file to the given path, returns the path it was
+// renamed from. Otherwise, returns the given path.
+func renamedFrom(ctx context.Context, c *object.Commit,
+	path string) (string, error) {
+	if c.NumParents() != 1 {
+		return path, nil
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return "", err
+	}
+	entry, err := tree.FindEntry(path)
+	if err != nil || !entry.Mode.IsFile() {
+		// Deleted, or not a file
+		return path, nil
+	}
+	parent, err := c.Parent(0)
+	if err != nil {
+		return "", err
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", err
+	}
+	if _, err := parentTree.FindEntry(path); err == nil {
+		// Modified, not added
+		return path, nil
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, parentTree, tree,
+		object.DefaultDiffTreeOptions)
+	if err != nil {
+		return "", err
+	}
+	for _, change := range changes {
+		if change.To.Name == path && change.From.Name != "" {
+			return change.From.Name, nil
+		}
+	}
+	return path, nil
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"context"
+	"io/ioutil"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+func TestParseLogSearch(t *testing.T) {
+	filter, err := parseLogSearch(
+		`author:"Jane Doe" since:2020-01-01 until:2020-12-31 fix(es)? crash`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.author != "jane doe" || filter.committer != "" {
+		t.Errorf("unexpected author %q, committer %q",
+			filter.author, filter.committer)
+	}
+	if want := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC); !filter.since.Equal(want) {
+		t.Errorf("since = %s, want %s", filter.since, want)
+	}
+	if want := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC); !filter.until.Before(want) ||
+		filter.until.Before(want.Add(-time.Second)) {
+		t.Errorf("until = %s, want the end of 2020-12-31", filter.until)
+	}
+	for message, match := range map[string]bool{
+		"Fixes crash on startup": true,
+		"fix crash":              true,
+		"Crash fixes":            false,
+	} {
+		if filter.message.MatchString(message) != match {
+			t.Errorf("message %q: expected match to be %v", message, match)
+		}
+	}
+
+	if _, err := parseLogSearch("since:yesterday"); err == nil {
+		t.Error("expected an invalid date to be rejected")
+	}
+	if _, err := parseLogSearch("fix("); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+func TestLogWithCursor(t *testing.T) {
+	dir, run := testRepo(t)
+	commit := func(file, content, message string) string {
+		if err := ioutil.WriteFile(path.Join(dir, file),
+			[]byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run("add", "--all")
+		run("commit", "--quiet", "-m", message)
+		return run("rev-parse", "HEAD")
+	}
+	first := commit("old.txt", "one\ntwo\nthree\nfour\nfive\n", "Add old.txt")
+	commit("other.txt", "other\n", "Add other.txt")
+	run("mv", "old.txt", "new.txt")
+	renamed := commit("new.txt", "one\ntwo\nthree\nfour\nfive\nsix\n",
+		"Rename old.txt to new.txt")
+	last := commit("new.txt", "1\ntwo\nthree\nfour\nfive\nsix\n", "Fix new.txt")
+
+	gitRepo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := WrapRepo(gitRepo)
+	ctx := context.Background()
+
+	// Without following renames, history stops at the rename
+	commits, cur, err := LogWithCursor(ctx, repo,
+		&model.Cursor{Count: 10}, "", "new.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || cur != nil ||
+		commits[0].ID != last || commits[1].ID != renamed {
+		t.Fatalf("expected %s, %s; got %d commits", last, renamed, len(commits))
+	}
+
+	// Following renames, page by page
+	var ids []string
+	cur = &model.Cursor{Count: 1, Search: "new|old"}
+	for cur != nil {
+		commits, cur, err = LogWithCursor(ctx, repo, cur, "", "new.txt", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range commits {
+			ids = append(ids, c.ID)
+		}
+		if cur != nil && cur.Search != "new|old" {
+			t.Fatalf("cursor lost the search string: %q", cur.Search)
+		}
+	}
+	if len(ids) != 3 || ids[0] != last || ids[1] != renamed || ids[2] != first {
+		t.Fatalf("expected %s, %s, %s; got %v", last, renamed, first, ids)
+	}
+
+	// The search string applies to the whole history
+	commits, _, err = LogWithCursor(ctx, repo,
+		&model.Cursor{Count: 10, Search: "^add"}, "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[1].ID != first {
+		t.Fatalf("expected 2 commits ending in %s, got %d", first, len(commits))
+	}
+}
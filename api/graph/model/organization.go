@@ -0,0 +1,205 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+type Organization struct {
+	ID          int       `json:"id"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (Organization) IsEntity() {}
+
+func (org *Organization) CanonicalName() string {
+	return "~" + org.Name
+}
+
+func (org *Organization) As(alias string) *Organization {
+	org.alias = alias
+	return org
+}
+
+func (org *Organization) Alias() string {
+	return org.alias
+}
+
+func (org *Organization) Table() string {
+	return "organization"
+}
+
+func (org *Organization) Fields() *database.ModelFields {
+	if org.fields != nil {
+		return org.fields
+	}
+	org.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &org.ID},
+			{"created", "created", &org.Created},
+			{"updated", "updated", &org.Updated},
+			{"name", "name", &org.Name},
+			{"description", "description", &org.Description},
+
+			// Always fetch:
+			{"id", "", &org.ID},
+			{"name", "", &org.Name},
+		},
+	}
+	return org.fields
+}
+
+func (org *Organization) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*Organization, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(org.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(org.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var orgs []*Organization
+	for rows.Next() {
+		var org Organization
+		if err := rows.Scan(database.Scan(ctx, &org)...); err != nil {
+			panic(err)
+		}
+		orgs = append(orgs, &org)
+	}
+
+	if len(orgs) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(orgs[len(orgs)-1].ID),
+			Search: cur.Search,
+		}
+		orgs = orgs[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return orgs, cur
+}
+
+type OrganizationMember struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+
+	RawRole string
+	OrgID   int
+	UserID  int
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (om *OrganizationMember) Role() OrganizationRole {
+	role := OrganizationRole(strings.ToUpper(om.RawRole))
+	if !role.IsValid() {
+		panic(fmt.Errorf("Invalid organization role '%s'", om.RawRole)) // Invariant
+	}
+	return role
+}
+
+func (om *OrganizationMember) As(alias string) *OrganizationMember {
+	om.alias = alias
+	return om
+}
+
+func (om *OrganizationMember) Alias() string {
+	return om.alias
+}
+
+func (om *OrganizationMember) Table() string {
+	return "organization_member"
+}
+
+func (om *OrganizationMember) Fields() *database.ModelFields {
+	if om.fields != nil {
+		return om.fields
+	}
+	om.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &om.ID},
+			{"created", "created", &om.Created},
+			{"role", "role", &om.RawRole},
+
+			// Always fetch:
+			{"id", "", &om.ID},
+			{"org_id", "", &om.OrgID},
+			{"user_id", "", &om.UserID},
+		},
+	}
+	return om.fields
+}
+
+func (om *OrganizationMember) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*OrganizationMember, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(om.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(om.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var members []*OrganizationMember
+	for rows.Next() {
+		var om OrganizationMember
+		if err := rows.Scan(database.Scan(ctx, &om)...); err != nil {
+			panic(err)
+		}
+		members = append(members, &om)
+	}
+
+	if len(members) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(members[len(members)-1].ID),
+			Search: cur.Search,
+		}
+		members = members[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return members, cur
+}
@@ -0,0 +1,429 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Parses a full object ID.
+func ParseHash(id string) (plumbing.Hash, error) {
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 40 {
+		return plumbing.ZeroHash, fmt.Errorf("Invalid object ID '%s'", id)
+	}
+	return plumbing.NewHash(id), nil
+}
+
+// Writes a blob to the repository. Exactly one of text and b64, which is
+// base64 encoded, must be specified.
+func WriteBlob(repo *RepoWrapper, text, b64 *string) (Object, error) {
+	data, err := blobContent(text, b64)
+	if err != nil {
+		return nil, err
+	}
+	repo.Lock()
+	blob, err := writeBlob(repo, data)
+	repo.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return BlobFromObject(repo, blob), nil
+}
+
+func blobContent(text, b64 *string) ([]byte, error) {
+	if text != nil {
+		return []byte(*text), nil
+	}
+	data, err := base64.StdEncoding.DecodeString(*b64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid base64 content: %v", err)
+	}
+	return data, nil
+}
+
+// The caller must hold the lock.
+func writeBlob(repo *RepoWrapper, data []byte) (*object.Blob, error) {
+	obj := repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(data)))
+	w, err := obj.Writer()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	return repo.BlobObject(hash)
+}
+
+// Writes a tree to the repository, which is a copy of the tree identified by
+// base, if not empty, with the given entries added, replaced or removed. The
+// base is either a tree ID or a revspec for a commit.
+func WriteTree(repo *RepoWrapper, base string,
+	entries []*TreeEntryInput) (*Tree, error) {
+	repo.Lock()
+	defer repo.Unlock()
+
+	var tree *object.Tree
+	if base != "" {
+		var err error
+		if tree, err = resolveTree(repo, base); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make(map[string]*object.TreeEntry)
+	for _, input := range entries {
+		if err := validateTreePath(input.Path); err != nil {
+			return nil, err
+		}
+		if _, ok := changes[input.Path]; ok {
+			return nil, fmt.Errorf("Duplicate tree entry '%s'", input.Path)
+		}
+		entry, err := treeEntry(repo, input)
+		if err != nil {
+			return nil, err
+		}
+		changes[input.Path] = entry
+	}
+	for p := range changes {
+		for dir := p; strings.Contains(dir, "/"); {
+			dir = dir[:strings.LastIndexByte(dir, '/')]
+			if entry := changes[dir]; entry != nil {
+				return nil, fmt.Errorf("Tree entry '%s' conflicts with '%s'",
+					p, dir)
+			}
+		}
+	}
+
+	hash, err := updateTree(repo, tree, changes)
+	if err != nil {
+		return nil, err
+	}
+	if hash.IsZero() {
+		if hash, err = storeObject(repo, &object.Tree{}); err != nil {
+			return nil, err
+		}
+	}
+	if tree, err = repo.TreeObject(hash); err != nil {
+		return nil, err
+	}
+	return TreeFromObject(repo, tree), nil
+}
+
+// The caller must hold the lock.
+func resolveTree(repo *RepoWrapper, base string) (*object.Tree, error) {
+	if hash, err := ParseHash(base); err == nil {
+		if tree, err := repo.TreeObject(hash); err == nil {
+			return tree, nil
+		}
+	}
+	commit, err := repo.ResolveCommit(base)
+	if err != nil {
+		return nil, fmt.Errorf("No tree or commit found for '%s'", base)
+	}
+	return commit.Tree()
+}
+
+func validateTreePath(p string) error {
+	for _, elem := range strings.Split(p, "/") {
+		switch {
+		case elem == "", elem == ".", elem == "..":
+			return fmt.Errorf("Invalid tree entry path '%s'", p)
+		case strings.EqualFold(elem, ".git"):
+			return fmt.Errorf("Invalid tree entry path '%s' (must not contain .git)", p)
+		}
+	}
+	return nil
+}
+
+// Returns the tree entry for the given input, or nil if the input removes an
+// entry. The caller must hold the lock.
+func treeEntry(repo *RepoWrapper, input *TreeEntryInput) (*object.TreeEntry, error) {
+	if input.ID == nil {
+		return nil, nil
+	}
+	hash, err := ParseHash(*input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Mode != nil && filemode.FileMode(*input.Mode) == filemode.Submodule {
+		// The commit is in another repository
+		return &object.TreeEntry{Mode: filemode.Submodule, Hash: hash}, nil
+	}
+	obj, err := repo.Object(plumbing.AnyObject, hash)
+	if err != nil {
+		return nil, fmt.Errorf("lookup object %s: %w", hash.String(), err)
+	}
+
+	var mode filemode.FileMode
+	switch obj.(type) {
+	case *object.Blob:
+		mode = filemode.Regular
+		if input.Mode != nil {
+			mode = filemode.FileMode(*input.Mode)
+			if mode != filemode.Regular && mode != filemode.Executable &&
+				mode != filemode.Symlink {
+				return nil, fmt.Errorf("Invalid mode %o for blob '%s'",
+					*input.Mode, input.Path)
+			}
+		}
+	case *object.Tree:
+		mode = filemode.Dir
+		if input.Mode != nil && filemode.FileMode(*input.Mode) != mode {
+			return nil, fmt.Errorf("Invalid mode %o for tree '%s'",
+				*input.Mode, input.Path)
+		}
+	default:
+		return nil, fmt.Errorf("Object %s is not a blob or tree", hash.String())
+	}
+	return &object.TreeEntry{Mode: mode, Hash: hash}, nil
+}
+
+// Writes a copy of tree, which may be nil, with the given changes, keyed by
+// path relative to the tree. nil changes remove the entry. Returns the zero
+// hash if the new tree is empty. The caller must hold the lock.
+func updateTree(repo *RepoWrapper, tree *object.Tree,
+	changes map[string]*object.TreeEntry) (plumbing.Hash, error) {
+	entries := make(map[string]object.TreeEntry)
+	if tree != nil {
+		for _, entry := range tree.Entries {
+			entries[entry.Name] = entry
+		}
+	}
+
+	subchanges := make(map[string]map[string]*object.TreeEntry)
+	for p, change := range changes {
+		if i := strings.IndexByte(p, '/'); i != -1 {
+			dir := p[:i]
+			if subchanges[dir] == nil {
+				subchanges[dir] = make(map[string]*object.TreeEntry)
+			}
+			subchanges[dir][p[i+1:]] = change
+		} else if change == nil {
+			delete(entries, p)
+		} else {
+			entries[p] = object.TreeEntry{
+				Name: p,
+				Mode: change.Mode,
+				Hash: change.Hash,
+			}
+		}
+	}
+	for dir, changes := range subchanges {
+		var subtree *object.Tree
+		if entry, ok := entries[dir]; ok && entry.Mode == filemode.Dir {
+			var err error
+			if subtree, err = repo.TreeObject(entry.Hash); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+		hash, err := updateTree(repo, subtree, changes)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if hash.IsZero() {
+			delete(entries, dir)
+		} else {
+			entries[dir] = object.TreeEntry{
+				Name: dir,
+				Mode: filemode.Dir,
+				Hash: hash,
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+
+	newTree := &object.Tree{}
+	for _, entry := range entries {
+		newTree.Entries = append(newTree.Entries, entry)
+	}
+	// git sorts trees as if their names ended with a slash
+	sortName := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(newTree.Entries, func(i, j int) bool {
+		return sortName(newTree.Entries[i]) < sortName(newTree.Entries[j])
+	})
+	return storeObject(repo, newTree)
+}
+
+// Writes a commit to the repository. The committer defaults to the author,
+// which must be specified, and the time of each defaults to now.
+func WriteCommit(repo *RepoWrapper, input *CommitInput) (*Commit, error) {
+	repo.Lock()
+	defer repo.Unlock()
+
+	treeHash, err := ParseHash(input.Tree)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := repo.TreeObject(treeHash); err != nil {
+		return nil, fmt.Errorf("lookup tree %s: %w", input.Tree, err)
+	}
+
+	now := time.Now()
+	commit := &object.Commit{
+		Author:    signature(input.Author, now),
+		Committer: signature(input.Author, now),
+		Message:   input.Message,
+		TreeHash:  treeHash,
+	}
+	if input.Committer != nil {
+		commit.Committer = signature(input.Committer, now)
+	}
+	// Like git commit-tree -m
+	if !strings.HasSuffix(commit.Message, "\n") {
+		commit.Message += "\n"
+	}
+	for _, revspec := range input.Parents {
+		parent, err := repo.ResolveCommit(revspec)
+		if err != nil {
+			return nil, fmt.Errorf("No commit found for '%s'", revspec)
+		}
+		commit.ParentHashes = append(commit.ParentHashes, parent.Hash)
+	}
+
+	hash, err := storeObject(repo, commit)
+	if err != nil {
+		return nil, err
+	}
+	if commit, err = repo.CommitObject(hash); err != nil {
+		return nil, err
+	}
+	return CommitFromObject(repo, commit), nil
+}
+
+// Writes an annotated tag for the given commit to the repository.
+func WriteTag(repo *RepoWrapper, name string, target plumbing.Hash,
+	message string, tagger *SignatureInput) (plumbing.Hash, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	// Like git tag -m
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	return storeObject(repo, &object.Tag{
+		Name:       name,
+		Tagger:     signature(tagger, time.Now()),
+		Message:    message,
+		TargetType: plumbing.CommitObject,
+		Target:     target,
+	})
+}
+
+func signature(input *SignatureInput, now time.Time) object.Signature {
+	sig := object.Signature{
+		Name:  input.Name,
+		Email: input.Email,
+		When:  now,
+	}
+	if input.Time != nil {
+		sig.When = *input.Time
+	}
+	return sig
+}
+
+// Writes a commit to the repository which makes the given changes to the files
+// of the parent commit. Changed files keep their mode.
+func WriteFileChanges(repo *RepoWrapper, parent plumbing.Hash, message string,
+	author *SignatureInput, changes []*FileChange) (*Commit, error) {
+	repo.Lock()
+	entries, err := fileChangeEntries(repo, parent, changes)
+	repo.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := WriteTree(repo, parent.String(), entries)
+	if err != nil {
+		return nil, err
+	}
+	return WriteCommit(repo, &CommitInput{
+		Tree:    tree.ID,
+		Parents: []string{parent.String()},
+		Message: message,
+		Author:  author,
+	})
+}
+
+// Writes the blobs for the given file changes and returns the corresponding
+// tree entries. The caller must hold the lock.
+func fileChangeEntries(repo *RepoWrapper, parent plumbing.Hash,
+	changes []*FileChange) ([]*TreeEntryInput, error) {
+	commit, err := repo.CommitObject(parent)
+	if err != nil {
+		return nil, fmt.Errorf("lookup commit %s: %w", parent.String(), err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*TreeEntryInput, len(changes))
+	for i, change := range changes {
+		entries[i] = &TreeEntryInput{Path: change.Path}
+		if err := validateTreePath(change.Path); err != nil {
+			return nil, err
+		}
+		// Any path which cannot be found is treated as a new file
+		existing, err := tree.FindEntry(change.Path)
+		if err != nil {
+			existing = nil
+		}
+		if change.Delete != nil && *change.Delete {
+			if existing == nil {
+				return nil, fmt.Errorf("No file '%s' to delete", change.Path)
+			}
+			continue
+		}
+		if existing != nil && existing.Mode.IsFile() {
+			mode := int(existing.Mode)
+			entries[i].Mode = &mode
+		}
+
+		data, err := blobContent(change.Content, change.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", change.Path, err)
+		}
+		blob, err := writeBlob(repo, data)
+		if err != nil {
+			return nil, err
+		}
+		id := blob.Hash.String()
+		entries[i].ID = &id
+	}
+	return entries, nil
+}
+
+// Writes an encoded object to the repository. The caller must hold the lock.
+func storeObject(repo *RepoWrapper, obj interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	encoded := repo.Storer.NewEncodedObject()
+	if err := obj.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(encoded)
+}
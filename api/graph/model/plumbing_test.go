@@ -0,0 +1,118 @@
+package model
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestWriteFileChanges(t *testing.T) {
+	dir, run := testRepo(t)
+	for name, content := range map[string]string{
+		"README":     "Hello\n",
+		"bin/run.sh": "#!/bin/sh\n",
+	} {
+		p := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("add", "--all")
+	run("update-index", "--chmod=+x", "bin/run.sh")
+	run("commit", "--quiet", "-m", "Initial commit")
+	parent := plumbing.NewHash(run("rev-parse", "HEAD"))
+
+	gitRepo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := WrapRepo(gitRepo)
+	str := func(s string) *string { return &s }
+	yes := true
+	author := &SignatureInput{Name: "Example", Email: "example@example.org"}
+
+	commit, err := WriteFileChanges(repo, parent, "Update files", author,
+		[]*FileChange{
+			{Path: "bin/run.sh", Content: str("#!/bin/sh\nexit 0\n")},
+			{Path: "docs/new.bin",
+				Base64: str(base64.StdEncoding.EncodeToString([]byte{0, 1, 2}))},
+			{Path: "README", Delete: &yes},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := run("rev-parse", commit.ID+"^"); got != parent.String() {
+		t.Errorf("parent is %s, want %s", got, parent)
+	}
+	if got := run("log", "-1", "--format=%an <%ae>%n%s", commit.ID); got !=
+		"Example <example@example.org>\nUpdate files" {
+		t.Errorf("unexpected commit: %q", got)
+	}
+	// Changed files keep their mode
+	want := []string{
+		"100755 blob bin/run.sh",
+		"100644 blob docs/new.bin",
+	}
+	var got []string
+	for _, line := range strings.Split(run("ls-tree", "-r", commit.ID), "\n") {
+		fields := strings.Fields(line)
+		got = append(got, fields[0]+" "+fields[1]+" "+fields[3])
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got tree:\n%s\nwant:\n%s",
+			strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if got := run("show", commit.ID+":bin/run.sh"); got != "#!/bin/sh\nexit 0" {
+		t.Errorf("unexpected content of bin/run.sh: %q", got)
+	}
+
+	for _, changes := range [][]*FileChange{
+		{{Path: "missing", Delete: &yes}},
+		{{Path: "../escape", Content: str("")}},
+		{{Path: "dir/.git/config", Content: str("")}},
+	} {
+		if _, err := WriteFileChanges(repo, parent, "Bad", author,
+			changes); err == nil {
+			t.Errorf("%s: expected an error", changes[0].Path)
+		}
+	}
+}
+
+func TestWriteTag(t *testing.T) {
+	dir, run := testRepo(t)
+	run("commit", "--quiet", "--allow-empty", "-m", "Commit")
+	target := plumbing.NewHash(run("rev-parse", "HEAD"))
+
+	gitRepo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	hash, err := WriteTag(WrapRepo(gitRepo), "v1.0", target, "Release 1.0",
+		&SignatureInput{Name: "Example", Email: "example@example.org", Time: &when})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// git can read the tag, and the message ends with a newline
+	want := "object " + target.String() + "\n" +
+		"type commit\n" +
+		"tag v1.0\n" +
+		"tagger Example <example@example.org> 1577934245 +0000\n" +
+		"\n" +
+		"Release 1.0"
+	if got := run("cat-file", "tag", hash.String()); got != want {
+		t.Errorf("got tag:\n%s\nwant:\n%s", got, want)
+	}
+	run("fsck", "--no-dangling")
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+type ProtectedRef struct {
+	ID             int       `json:"id"`
+	Created        time.Time `json:"created"`
+	Updated        time.Time `json:"updated"`
+	Pattern        string    `json:"pattern"`
+	AllowForcePush bool      `json:"allowForcePush"`
+	AllowDeletion  bool      `json:"allowDeletion"`
+
+	RequireSignatures bool `json:"requireSignatures"`
+
+	RepoID         int
+	AllowedUserIDs pq.Int64Array
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (pr *ProtectedRef) As(alias string) *ProtectedRef {
+	pr.alias = alias
+	return pr
+}
+
+func (pr *ProtectedRef) Alias() string {
+	return pr.alias
+}
+
+func (pr *ProtectedRef) Table() string {
+	return "protected_ref"
+}
+
+func (pr *ProtectedRef) Fields() *database.ModelFields {
+	if pr.fields != nil {
+		return pr.fields
+	}
+	pr.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &pr.ID},
+			{"created", "created", &pr.Created},
+			{"updated", "updated", &pr.Updated},
+			{"pattern", "pattern", &pr.Pattern},
+			{"allow_force_push", "allowForcePush", &pr.AllowForcePush},
+			{"allow_deletion", "allowDeletion", &pr.AllowDeletion},
+			{"require_signatures", "requireSignatures", &pr.RequireSignatures},
+			{"allowed_users", "allowedUsers", &pr.AllowedUserIDs},
+
+			// Always fetch:
+			{"id", "", &pr.ID},
+			{"repo_id", "", &pr.RepoID},
+		},
+	}
+	return pr.fields
+}
+
+func (pr *ProtectedRef) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*ProtectedRef, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(pr.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(pr.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var refs []*ProtectedRef
+	for rows.Next() {
+		var pr ProtectedRef
+		if err := rows.Scan(database.Scan(ctx, &pr)...); err != nil {
+			panic(err)
+		}
+		refs = append(refs, &pr)
+	}
+
+	if len(refs) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(refs[len(refs)-1].ID),
+			Search: cur.Search,
+		}
+		refs = refs[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return refs, cur
+}
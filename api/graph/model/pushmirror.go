@@ -0,0 +1,203 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+type PushMirror struct {
+	ID       int       `json:"id"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	URL      string    `json:"url"`
+	Username *string   `json:"username"`
+
+	RepoID int
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (pm *PushMirror) As(alias string) *PushMirror {
+	pm.alias = alias
+	return pm
+}
+
+func (pm *PushMirror) Alias() string {
+	return pm.alias
+}
+
+func (pm *PushMirror) Table() string {
+	return "push_mirror"
+}
+
+func (pm *PushMirror) Fields() *database.ModelFields {
+	if pm.fields != nil {
+		return pm.fields
+	}
+	pm.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &pm.ID},
+			{"created", "created", &pm.Created},
+			{"updated", "updated", &pm.Updated},
+			{"url", "url", &pm.URL},
+			{"username", "username", &pm.Username},
+
+			// Always fetch:
+			{"id", "", &pm.ID},
+			{"repo_id", "", &pm.RepoID},
+		},
+	}
+	return pm.fields
+}
+
+func (pm *PushMirror) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*PushMirror, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(pm.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(pm.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var mirrors []*PushMirror
+	for rows.Next() {
+		var pm PushMirror
+		if err := rows.Scan(database.Scan(ctx, &pm)...); err != nil {
+			panic(err)
+		}
+		mirrors = append(mirrors, &pm)
+	}
+
+	if len(mirrors) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(mirrors[len(mirrors)-1].ID),
+			Search: cur.Search,
+		}
+		mirrors = mirrors[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return mirrors, cur
+}
+
+type PushMirrorAttempt struct {
+	ID       int       `json:"id"`
+	Created  time.Time `json:"created"`
+	PushUUID string    `json:"pushUUID"`
+	Output   *string   `json:"output"`
+
+	RawStatus    string
+	PushMirrorID int
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (pma *PushMirrorAttempt) Status() PushMirrorStatus {
+	status := PushMirrorStatus(strings.ToUpper(pma.RawStatus))
+	if !status.IsValid() {
+		panic(fmt.Errorf("Invalid push mirror status '%s'", pma.RawStatus)) // Invariant
+	}
+	return status
+}
+
+func (pma *PushMirrorAttempt) As(alias string) *PushMirrorAttempt {
+	pma.alias = alias
+	return pma
+}
+
+func (pma *PushMirrorAttempt) Alias() string {
+	return pma.alias
+}
+
+func (pma *PushMirrorAttempt) Table() string {
+	return "push_mirror_attempt"
+}
+
+func (pma *PushMirrorAttempt) Fields() *database.ModelFields {
+	if pma.fields != nil {
+		return pma.fields
+	}
+	pma.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &pma.ID},
+			{"created", "created", &pma.Created},
+			{"push_uuid", "pushUUID", &pma.PushUUID},
+			{"status", "status", &pma.RawStatus},
+			{"output", "output", &pma.Output},
+
+			// Always fetch:
+			{"id", "", &pma.ID},
+			{"push_mirror_id", "", &pma.PushMirrorID},
+		},
+	}
+	return pma.fields
+}
+
+func (pma *PushMirrorAttempt) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*PushMirrorAttempt, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(pma.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(pma.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var attempts []*PushMirrorAttempt
+	for rows.Next() {
+		var pma PushMirrorAttempt
+		if err := rows.Scan(database.Scan(ctx, &pma)...); err != nil {
+			panic(err)
+		}
+		attempts = append(attempts, &pma)
+	}
+
+	if len(attempts) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(attempts[len(attempts)-1].ID),
+			Search: cur.Search,
+		}
+		attempts = attempts[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return attempts, cur
+}
@@ -0,0 +1,116 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"git.sr.ht/~sircmpwn/core-go/database"
+)
+
+type PushPolicy struct {
+	ID               int       `json:"id"`
+	Created          time.Time `json:"created"`
+	Updated          time.Time `json:"updated"`
+	MessagePattern   *string   `json:"messagePattern"`
+	MaxSubjectLength *int      `json:"maxSubjectLength"`
+
+	RepoID              int
+	RawRequiredTrailers pq.StringArray
+	RawCommitterDomains pq.StringArray
+	RawNoMergeRefs      pq.StringArray
+	RawForbiddenPaths   pq.StringArray
+	RawSecretScanning   *string
+	// In bytes
+	RawMaxBlobSize *int64
+	RawMaxRepoSize *int64
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (pp *PushPolicy) RequiredTrailers() []string {
+	return pp.RawRequiredTrailers
+}
+
+func (pp *PushPolicy) CommitterDomains() []string {
+	return pp.RawCommitterDomains
+}
+
+func (pp *PushPolicy) NoMergeRefs() []string {
+	return pp.RawNoMergeRefs
+}
+
+func (pp *PushPolicy) MaxBlobSizeKiB() *int {
+	return sizeIn(pp.RawMaxBlobSize, 1<<10)
+}
+
+func (pp *PushPolicy) MaxRepoSizeMiB() *int {
+	return sizeIn(pp.RawMaxRepoSize, 1<<20)
+}
+
+// Converts a size in bytes to the given unit, rounding down.
+func sizeIn(size *int64, unit int64) *int {
+	if size == nil {
+		return nil
+	}
+	n := int(*size / unit)
+	return &n
+}
+
+func (pp *PushPolicy) ForbiddenPaths() []string {
+	return pp.RawForbiddenPaths
+}
+
+func (pp *PushPolicy) SecretScanning() *SecretScanningMode {
+	if pp.RawSecretScanning == nil {
+		return nil
+	}
+	mode := SecretScanningMode(strings.ToUpper(*pp.RawSecretScanning))
+	if !mode.IsValid() {
+		panic(fmt.Errorf("Invalid secret scanning mode '%s'", *pp.RawSecretScanning)) // Invariant
+	}
+	return &mode
+}
+
+func (pp *PushPolicy) As(alias string) *PushPolicy {
+	pp.alias = alias
+	return pp
+}
+
+func (pp *PushPolicy) Alias() string {
+	return pp.alias
+}
+
+func (pp *PushPolicy) Table() string {
+	return "push_policy"
+}
+
+func (pp *PushPolicy) Fields() *database.ModelFields {
+	if pp.fields != nil {
+		return pp.fields
+	}
+	pp.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &pp.ID},
+			{"created", "created", &pp.Created},
+			{"updated", "updated", &pp.Updated},
+			{"required_trailers", "requiredTrailers", &pp.RawRequiredTrailers},
+			{"message_pattern", "messagePattern", &pp.MessagePattern},
+			{"max_subject_length", "maxSubjectLength", &pp.MaxSubjectLength},
+			{"committer_domains", "committerDomains", &pp.RawCommitterDomains},
+			{"no_merge_refs", "noMergeRefs", &pp.RawNoMergeRefs},
+			{"max_blob_size", "maxBlobSizeKiB", &pp.RawMaxBlobSize},
+			{"forbidden_paths", "forbiddenPaths", &pp.RawForbiddenPaths},
+			{"max_repo_size", "maxRepoSizeMiB", &pp.RawMaxRepoSize},
+			{"secret_scanning", "secretScanning", &pp.RawSecretScanning},
+
+			// Always fetch:
+			{"id", "", &pp.ID},
+			{"repo_id", "", &pp.RepoID},
+		},
+	}
+	return pp.fields
+}
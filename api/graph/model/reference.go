@@ -11,11 +11,16 @@ type Reference struct {
 
 func (r *Reference) Follow() Object {
 	repo := r.Repo.Repo()
-	repo.Lock()
-	ref, err := repo.Reference(r.Ref.Name(), true)
-	repo.Unlock()
-	if err != nil {
-		panic(err)
+	ref := r.Ref
+	// Deleted references may still be followed
+	if ref.Type() != plumbing.HashReference {
+		var err error
+		repo.Lock()
+		ref, err = repo.Reference(r.Ref.Name(), true)
+		repo.Unlock()
+		if err != nil {
+			panic(err)
+		}
 	}
 	obj, err := LookupObject(repo, ref.Hash())
 	if err != nil {
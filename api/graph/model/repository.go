@@ -25,8 +25,14 @@ type Repository struct {
 
 	Path          string
 	OwnerID       int
+	OrgID         *int
+	ForkedFromID  *int
 	RawVisibility string
 
+	MirrorURL      *string
+	MirrorLastSync *time.Time
+	MirrorError    *string
+
 	alias  string
 	repo   *RepoWrapper
 	fields *database.ModelFields
@@ -45,6 +51,19 @@ func (r *Repository) Visibility() Visibility {
 	return vis
 }
 
+// Returns details of the remote repository which this repository mirrors, or
+// nil if it is not a mirror.
+func (r *Repository) Mirror() *RepositoryMirror {
+	if r.MirrorURL == nil {
+		return nil
+	}
+	return &RepositoryMirror{
+		URL:      *r.MirrorURL,
+		LastSync: r.MirrorLastSync,
+		Error:    r.MirrorError,
+	}
+}
+
 func (r *Repository) Repo() *RepoWrapper {
 	if r.repo != nil {
 		return r.repo
@@ -96,11 +115,16 @@ func (r *Repository) Fields() *database.ModelFields {
 			{"description", "description", &r.Description},
 			{"visibility", "visibility", &r.RawVisibility},
 			{"readme", "readme", &r.Readme},
+			{"mirror_url", "mirror", &r.MirrorURL},
+			{"mirror_last_sync", "mirror", &r.MirrorLastSync},
+			{"mirror_error", "mirror", &r.MirrorError},
 
 			// Always fetch:
 			{"id", "", &r.ID},
 			{"path", "", &r.Path},
 			{"owner_id", "", &r.OwnerID},
+			{"org_id", "", &r.OrgID},
+			{"forked_from", "", &r.ForkedFromID},
 			{"updated", "", &r.Updated},
 		},
 	}
@@ -152,6 +176,75 @@ func (r *Repository) QueryWithCursor(ctx context.Context,
 	return repos, cur
 }
 
+// Returns an expression which matches repositories which the given user has
+// been granted access to, either as the owner, through an access control list
+// (directly or as a member of a team), or as a member of the organization which
+// owns the repository. The repository's visibility is not taken into account.
+func (r *Repository) AccessibleBy(userID int) sq.Sqlizer {
+	id := database.WithAlias(r.alias, "id")
+	ownerID := database.WithAlias(r.alias, "owner_id")
+	orgID := database.WithAlias(r.alias, "org_id")
+	return sq.Or{
+		// The creator of an organization's repository has no special access
+		sq.Expr(orgID+` IS NULL AND `+ownerID+` = ?`, userID),
+		sq.Expr(`EXISTS (
+			SELECT 1 FROM access
+			WHERE access.repo_id = `+id+` AND access.user_id = ?
+		)`, userID),
+		sq.Expr(`EXISTS (
+			SELECT 1 FROM team_access ta
+			JOIN team_member tm ON tm.team_id = ta.team_id
+			WHERE ta.repo_id = `+id+` AND tm.user_id = ?
+		)`, userID),
+		sq.Expr(orgID+` IN (
+			SELECT org_id FROM organization_member WHERE user_id = ?
+		)`, userID),
+	}
+}
+
+// Returns an expression which matches repositories which the given user may
+// manage, either as the owner or as an administrator of the organization which
+// owns the repository.
+func (r *Repository) ManageableBy(userID int) sq.Sqlizer {
+	ownerID := database.WithAlias(r.alias, "owner_id")
+	orgID := database.WithAlias(r.alias, "org_id")
+	return sq.Or{
+		sq.Expr(orgID+` IS NULL AND `+ownerID+` = ?`, userID),
+		sq.Expr(orgID+` IN (
+			SELECT org_id FROM organization_member
+			WHERE user_id = ? AND role = 'admin'
+		)`, userID),
+	}
+}
+
+// Returns an expression which matches repositories which the given user may
+// push to, either as the owner, through a read/write access control list entry
+// (directly or as a member of a team), or as an administrator or member of the
+// organization which owns the repository.
+func (r *Repository) WritableBy(userID int) sq.Sqlizer {
+	id := database.WithAlias(r.alias, "id")
+	ownerID := database.WithAlias(r.alias, "owner_id")
+	orgID := database.WithAlias(r.alias, "org_id")
+	return sq.Or{
+		sq.Expr(orgID+` IS NULL AND `+ownerID+` = ?`, userID),
+		sq.Expr(`EXISTS (
+			SELECT 1 FROM access
+			WHERE access.repo_id = `+id+` AND access.mode = 'rw'
+				AND access.user_id = ?
+		)`, userID),
+		sq.Expr(`EXISTS (
+			SELECT 1 FROM team_access ta
+			JOIN team_member tm ON tm.team_id = ta.team_id
+			WHERE ta.repo_id = `+id+` AND ta.mode = 'rw'
+				AND tm.user_id = ?
+		)`, userID),
+		sq.Expr(orgID+` IN (
+			SELECT org_id FROM organization_member
+			WHERE user_id = ? AND role IN ('admin', 'member')
+		)`, userID),
+	}
+}
+
 func (r *Repository) DefaultSearch(query sq.SelectBuilder,
 	term string) (sq.SelectBuilder, error) {
 	name := database.WithAlias(r.alias, "name")
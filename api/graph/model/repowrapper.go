@@ -1,9 +1,12 @@
 package model
 
 import (
+	"fmt"
 	"sync"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
 type RepoWrapper struct {
@@ -14,3 +17,16 @@ type RepoWrapper struct {
 func WrapRepo(repo *git.Repository) *RepoWrapper {
 	return &RepoWrapper{repo, sync.Mutex{}}
 }
+
+// Resolves a git-compatible revspec, e.g. "HEAD~4", to a commit. The caller
+// must hold the lock.
+func (r *RepoWrapper) ResolveCommit(revspec string) (*object.Commit, error) {
+	hash, err := r.ResolveRevision(plumbing.Revision(revspec))
+	if err != nil {
+		return nil, err
+	}
+	if hash == nil {
+		return nil, fmt.Errorf("No such revision")
+	}
+	return r.CommitObject(*hash)
+}
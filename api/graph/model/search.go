@@ -0,0 +1,394 @@
+package model
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"git.sr.ht/~sircmpwn/core-go/model"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/codesearch"
+)
+
+// Matching lines are truncated to this many bytes.
+const maxSearchLineLength = 1024
+
+// At most this many files are read for each page of results. If the limit is
+// reached, a shorter page is returned along with a cursor for the rest.
+const maxSearchBlobs = 500
+
+// Index segments are never modified once written, so they are kept in memory
+// after they are first read, up to this many bytes in total.
+const maxCachedSegmentBytes = 256 * 1024 * 1024
+
+// Returns a page of the lines of the files in the tree at the given revspec
+// which match the regular expression expr, optionally limited to files whose
+// paths match the given glob. The regular expression must contain at least
+// one trigram which the index written by gitsrht-update-hook can use to rule
+// out files.
+func SearchWithCursor(ctx context.Context, repo *Repository,
+	cur *model.Cursor, revspec, expr, glob string) (
+	[]*SearchResult, *model.Cursor, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, nil, err
+	}
+	trigrams := searchTrigrams(parsed.Simplify())
+	if len(trigrams) == 0 {
+		return nil, nil, fmt.Errorf("Query must contain at least three " +
+			"consecutive characters which are matched literally")
+	}
+	index, err := loadSearchIndex(repo.Path, trigrams)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		nextPath string
+		nextLine int
+	)
+	if cur.Next != "" {
+		parts := strings.SplitN(cur.Next, ":", 2)
+		if len(parts) != 2 {
+			return nil, nil, fmt.Errorf("Invalid cursor")
+		}
+		if nextLine, err = strconv.Atoi(parts[0]); err != nil {
+			return nil, nil, fmt.Errorf("Invalid cursor")
+		}
+		nextPath = parts[1]
+	}
+
+	// The lock is only held while reading objects, so that other requests
+	// for this repository are not held up by a long search
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	commit, err := gitRepo.ResolveCommit(revspec)
+	var tree *object.Tree
+	if err == nil {
+		tree, err = commit.Tree()
+	}
+	gitRepo.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		results []*SearchResult
+		scanned int
+		resume  string
+	)
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for len(results) <= cur.Count {
+		gitRepo.Lock()
+		name, entry, err := walker.Next()
+		gitRepo.Unlock()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		if nextPath != "" {
+			if name != nextPath {
+				continue
+			}
+			nextPath = ""
+		} else {
+			nextLine = 0
+		}
+		if !entry.Mode.IsFile() || entry.Mode == filemode.Symlink {
+			continue
+		}
+		if glob != "" && !MatchGlob(glob, name) {
+			continue
+		}
+		if !index.MayMatch(entry.Hash) {
+			continue
+		}
+		if scanned == maxSearchBlobs {
+			resume = name
+			break
+		}
+		scanned++
+
+		content, err := readSearchBlob(gitRepo, entry.Hash)
+		if err != nil {
+			return nil, nil, err
+		}
+		for lineNo := 1; len(content) != 0; lineNo++ {
+			line := content
+			if i := bytes.IndexByte(content, '\n'); i != -1 {
+				line, content = content[:i], content[i+1:]
+			} else {
+				content = nil
+			}
+			if lineNo < nextLine || !re.Match(line) {
+				continue
+			}
+			results = append(results, &SearchResult{
+				Path:    name,
+				Line:    lineNo,
+				Content: truncateLine(line),
+			})
+		}
+	}
+
+	if len(results) > cur.Count {
+		next := results[cur.Count]
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   fmt.Sprintf("%d:%s", next.Line, next.Path),
+			Search: "",
+		}
+		results = results[:cur.Count]
+	} else if resume != "" {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   fmt.Sprintf("%d:%s", 1, resume),
+			Search: "",
+		}
+	} else {
+		cur = nil
+	}
+	return results, cur, nil
+}
+
+// Reads a blob to be searched. Returns nil if the blob is too large or binary.
+func readSearchBlob(gitRepo *RepoWrapper, hash plumbing.Hash) ([]byte, error) {
+	gitRepo.Lock()
+	defer gitRepo.Unlock()
+	blob, err := gitRepo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if blob.Size > codesearch.MaxBlobSize {
+		return nil, nil
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if codesearch.IsBinary(content) {
+		return nil, nil
+	}
+	return content, nil
+}
+
+type cachedSegment struct {
+	path    string
+	segment *codesearch.Segment
+}
+
+// A cache of the index segments which were read most recently.
+type segmentCache struct {
+	sync.Mutex
+	elements map[string]*list.Element
+	lru      list.List
+	size     int
+}
+
+var searchSegments = &segmentCache{
+	elements: make(map[string]*list.Element),
+}
+
+// Returns the segment at the given path, reading it if it is not cached.
+func (c *segmentCache) Get(path string) (*codesearch.Segment, error) {
+	c.Lock()
+	if el, ok := c.elements[path]; ok {
+		c.lru.MoveToFront(el)
+		c.Unlock()
+		return el.Value.(*cachedSegment).segment, nil
+	}
+	c.Unlock()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	segment, err := codesearch.ParseSegment(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.elements[path]; ok {
+		// Read concurrently by another request
+		return el.Value.(*cachedSegment).segment, nil
+	}
+	c.elements[path] = c.lru.PushFront(&cachedSegment{path, segment})
+	c.size += segment.Size()
+	for c.size > maxCachedSegmentBytes && c.lru.Len() > 1 {
+		cached := c.lru.Remove(c.lru.Back()).(*cachedSegment)
+		delete(c.elements, cached.path)
+		c.size -= cached.segment.Size()
+	}
+	return segment, nil
+}
+
+type searchIndex struct {
+	segments []*codesearch.Segment
+	// The blobs of each segment which contain all of the query's trigrams
+	candidates [][]uint32
+}
+
+// Loads the search index of the repository at repoPath and finds the blobs
+// which contain all of the given trigrams. Returns nil if the repository has
+// not been indexed.
+func loadSearchIndex(repoPath string, trigrams []uint32) (*searchIndex, error) {
+	paths, err := filepath.Glob(
+		path.Join(repoPath, codesearch.IndexDir, "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	index := &searchIndex{}
+	for _, p := range paths {
+		segment, err := searchSegments.Get(p)
+		if errors.Is(err, os.ErrNotExist) {
+			// Removed by a concurrent rebuild, which indexes the same blobs
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		index.segments = append(index.segments, segment)
+		index.candidates = append(index.candidates,
+			segment.Candidates(trigrams))
+	}
+	return index, nil
+}
+
+// Returns false if the blob is known not to contain a match.
+func (index *searchIndex) MayMatch(blob plumbing.Hash) bool {
+	if index == nil {
+		return true
+	}
+	indexed := false
+	for i, segment := range index.segments {
+		n, ok := segment.Lookup(blob)
+		if !ok {
+			continue
+		}
+		indexed = true
+		candidates := index.candidates[i]
+		j := sort.Search(len(candidates), func(j int) bool {
+			return candidates[j] >= uint32(n)
+		})
+		if j < len(candidates) && candidates[j] == uint32(n) {
+			return true
+		}
+	}
+	return !indexed
+}
+
+// Returns the trigrams which any match of the regular expression must contain,
+// in the form used by the index.
+func searchTrigrams(re *syntax.Regexp) []uint32 {
+	set := make(map[uint32]struct{})
+	for _, lit := range requiredLiterals(re) {
+		for i := 0; i+3 <= len(lit); i++ {
+			set[codesearch.Trigram([]byte(lit[i:]))] = struct{}{}
+		}
+	}
+	var trigrams []uint32
+	for t := range set {
+		trigrams = append(trigrams, t)
+	}
+	return trigrams
+}
+
+// Returns strings which any match of the regular expression must contain.
+func requiredLiterals(re *syntax.Regexp) []string {
+	literal := func(re *syntax.Regexp) (string, bool) {
+		if re.Op != syntax.OpLiteral {
+			return "", false
+		}
+		s := string(re.Rune)
+		// The index only folds the case of ASCII letters
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 && r >= utf8.RuneSelf {
+				return "", false
+			}
+		}
+		return s, true
+	}
+
+	switch re.Op {
+	case syntax.OpLiteral:
+		if s, ok := literal(re); ok {
+			return []string{s}
+		}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var (
+			lits []string
+			cur  strings.Builder
+		)
+		for _, sub := range re.Sub {
+			if s, ok := literal(sub); ok {
+				cur.WriteString(s)
+				continue
+			}
+			if cur.Len() != 0 {
+				lits = append(lits, cur.String())
+				cur.Reset()
+			}
+			lits = append(lits, requiredLiterals(sub)...)
+		}
+		if cur.Len() != 0 {
+			lits = append(lits, cur.String())
+		}
+		return lits
+	}
+	return nil
+}
+
+func truncateLine(line []byte) string {
+	if len(line) <= maxSearchLineLength {
+		return string(line)
+	}
+	n := maxSearchLineLength
+	for n > 0 && !utf8.RuneStart(line[n]) {
+		n--
+	}
+	return string(line[:n])
+}
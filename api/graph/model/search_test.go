@@ -0,0 +1,132 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"git.sr.ht/~sircmpwn/core-go/model"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/codesearch"
+)
+
+// Creates a repository with a single commit of the given files.
+func testSearchRepo(t *testing.T, files map[string]string) *Repository {
+	t.Helper()
+	dir, run := testRepo(t)
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(dir, name),
+			[]byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("add", "--all")
+	run("commit", "--quiet", "-m", "Commit")
+	return &Repository{Path: dir}
+}
+
+func TestSearchWithCursor(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < maxSearchBlobs+10; i++ {
+		files[fmt.Sprintf("%04d.txt", i)] = fmt.Sprintf("line\nneedle %d\n", i)
+	}
+	repo := testSearchRepo(t, files)
+	ctx := context.Background()
+
+	if _, _, err := SearchWithCursor(ctx, repo, &model.Cursor{Count: 10},
+		"HEAD", "ne.*", ""); err == nil {
+		t.Error("expected a query without trigrams to be rejected")
+	}
+
+	// The number of files read for each page is limited
+	var results []*SearchResult
+	cur := &model.Cursor{Count: 1000}
+	for pages := 0; cur != nil; pages++ {
+		if pages == 3 {
+			t.Fatal("too many pages")
+		}
+		var page []*SearchResult
+		var err error
+		page, cur, err = SearchWithCursor(ctx, repo, cur, "HEAD", "needle", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pages == 0 && (len(page) != maxSearchBlobs || cur == nil) {
+			t.Fatalf("expected a first page of %d results and a cursor, got %d",
+				maxSearchBlobs, len(page))
+		}
+		results = append(results, page...)
+	}
+	if len(results) != len(files) {
+		t.Fatalf("expected %d results, got %d", len(files), len(results))
+	}
+	for i, result := range results {
+		if result.Path != fmt.Sprintf("%04d.txt", i) || result.Line != 2 ||
+			result.Content != fmt.Sprintf("needle %d", i) {
+			t.Fatalf("unexpected result %d: %s:%d: %s",
+				i, result.Path, result.Line, result.Content)
+		}
+	}
+}
+
+func TestSearchWithCursorIndex(t *testing.T) {
+	repo := testSearchRepo(t, map[string]string{
+		"a.txt": "needle a\n",
+		"b.txt": "needle b\n",
+		"c.txt": "needle c\n",
+	})
+	gitRepo := repo.Repo()
+	head := repo.Head()
+	if head == nil {
+		t.Fatal("no HEAD")
+	}
+	commit, err := gitRepo.CommitObject(head.Ref.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobHash := func(name string) plumbing.Hash {
+		entry, err := tree.FindEntry(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entry.Hash
+	}
+
+	// The index claims that a.txt does not contain the query, and does not
+	// know about c.txt, which must therefore be searched
+	writer := codesearch.NewSegmentWriter()
+	writer.Add(blobHash("a.txt"), []byte("haystack\n"))
+	writer.Add(blobHash("b.txt"), []byte("needle b\n"))
+	var buf bytes.Buffer
+	if _, err := writer.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dir := path.Join(repo.Path, codesearch.IndexDir)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "1.idx"),
+		buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, cur, err := SearchWithCursor(context.Background(), repo,
+		&model.Cursor{Count: 10}, "HEAD", "needle", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur != nil || len(results) != 2 ||
+		results[0].Path != "b.txt" || results[1].Path != "c.txt" {
+		t.Fatalf("expected matches in b.txt and c.txt, got %d results", len(results))
+	}
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+type SecretFinding struct {
+	ID       int       `json:"id"`
+	Created  time.Time `json:"created"`
+	PushUUID string    `json:"pushUUID"`
+	Ref      string    `json:"ref"`
+	Blob     string    `json:"blob"`
+	Path     string    `json:"path"`
+	Line     int       `json:"line"`
+	Rule     string    `json:"rule"`
+	Rejected bool      `json:"rejected"`
+
+	RepoID   int
+	PusherID *int
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (sf *SecretFinding) As(alias string) *SecretFinding {
+	sf.alias = alias
+	return sf
+}
+
+func (sf *SecretFinding) Alias() string {
+	return sf.alias
+}
+
+func (sf *SecretFinding) Table() string {
+	return "secret_finding"
+}
+
+func (sf *SecretFinding) Fields() *database.ModelFields {
+	if sf.fields != nil {
+		return sf.fields
+	}
+	sf.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &sf.ID},
+			{"created", "created", &sf.Created},
+			{"push_uuid", "pushUUID", &sf.PushUUID},
+			{"ref_name", "ref", &sf.Ref},
+			{"blob_id", "blob", &sf.Blob},
+			{"path", "path", &sf.Path},
+			{"line", "line", &sf.Line},
+			{"rule", "rule", &sf.Rule},
+			{"rejected", "rejected", &sf.Rejected},
+
+			// Always fetch:
+			{"id", "", &sf.ID},
+			{"repo_id", "", &sf.RepoID},
+			{"pusher_id", "", &sf.PusherID},
+		},
+	}
+	return sf.fields
+}
+
+func (sf *SecretFinding) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*SecretFinding, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(sf.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(sf.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var findings []*SecretFinding
+	for rows.Next() {
+		var sf SecretFinding
+		if err := rows.Scan(database.Scan(ctx, &sf)...); err != nil {
+			panic(err)
+		}
+		findings = append(findings, &sf)
+	}
+
+	if len(findings) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(findings[len(findings)-1].ID),
+			Search: cur.Search,
+		}
+		findings = findings[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return findings, cur
+}
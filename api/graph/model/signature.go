@@ -0,0 +1,147 @@
+package model
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+
+	"git.sr.ht/~sircmpwn/core-go/auth"
+	"git.sr.ht/~sircmpwn/core-go/client"
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/sigverify"
+)
+
+type ObjectSignature struct {
+	Format  SignatureFormat `json:"format"`
+	Armored string          `json:"armored"`
+
+	// The signed data, i.e. the object without its signature
+	data []byte
+	// The email address of the committer or tagger
+	email string
+
+	once   sync.Once
+	status SignatureStatus
+	signer string
+	err    error
+}
+
+// Returns the signature with the given armored text, or nil if it is empty or
+// in an unknown format.
+func parseSignature(armored string, data []byte, email string) *ObjectSignature {
+	format := sigverify.DetectFormat(armored)
+	if format == "" {
+		return nil
+	}
+	return &ObjectSignature{
+		Format:  SignatureFormat(format),
+		Armored: armored,
+		data:    data,
+		email:   email,
+	}
+}
+
+// Returns the contents of an object as stored, without its header. Signatures
+// are verified against these, as re-encoding the object with go-git may drop
+// headers which it does not know.
+func readRawObject(repo *RepoWrapper, hash plumbing.Hash) ([]byte, error) {
+	repo.Lock()
+	defer repo.Unlock()
+	obj, err := repo.Storer.EncodedObject(plumbing.AnyObject, hash)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// Returns the fingerprint of the signing key, in hexadecimal for PGP keys
+// (or the key ID, if the signature does not include the fingerprint), or as
+// "SHA256:<base64>" for SSH keys. Returns nil if the signature is malformed.
+func (sig *ObjectSignature) KeyID() *string {
+	s, err := sigverify.Parse(sig.Armored)
+	if err != nil {
+		return nil
+	}
+	keyID := s.KeyID()
+	if keyID == "" {
+		return nil
+	}
+	return &keyID
+}
+
+// Verifies the signature against the keys which users have registered. See
+// sigverify.Signature.Verify.
+func (sig *ObjectSignature) Status(ctx context.Context) (SignatureStatus, error) {
+	sig.once.Do(func() { sig.err = sig.verify(ctx) })
+	return sig.status, sig.err
+}
+
+// Returns the username of the user who registered the signing key, if the
+// signature is verified.
+func (sig *ObjectSignature) SignerUsername(ctx context.Context) (*string, error) {
+	if status, err := sig.Status(ctx); err != nil {
+		return nil, err
+	} else if status != SignatureStatusVerified {
+		return nil, nil
+	}
+	return &sig.signer, nil
+}
+
+func (sig *ObjectSignature) verify(ctx context.Context) error {
+	s, err := sigverify.Parse(sig.Armored)
+	if err != nil {
+		sig.status = SignatureStatusInvalid
+		return nil
+	}
+	status, signer, err := s.Verify(signatureKeysForContext(ctx),
+		sig.data, sig.email)
+	if err != nil {
+		return err
+	}
+	sig.status, sig.signer = SignatureStatus(status), signer
+	return nil
+}
+
+var signatureKeysCtxKey = &contextKey{"signatureKeys"}
+
+type contextKey struct {
+	name string
+}
+
+// Returns a context in which the keys looked up to verify signatures are
+// cached, for the duration of a request.
+func ContextWithSignatureKeys(ctx context.Context) context.Context {
+	return context.WithValue(ctx, signatureKeysCtxKey,
+		sigverify.NewCache(signatureKeys(ctx)))
+}
+
+func signatureKeysForContext(ctx context.Context) sigverify.Keys {
+	if keys, ok := ctx.Value(signatureKeysCtxKey).(sigverify.Keys); ok {
+		return keys
+	}
+	return signatureKeys(ctx)
+}
+
+// Looks up PGP keys on meta.sr.ht as the authenticated user, and SSH keys in
+// the database.
+func signatureKeys(ctx context.Context) sigverify.Keys {
+	return &sigverify.SourceHutKeys{
+		Context: ctx,
+		Query: func(ctx context.Context, query string,
+			variables map[string]interface{}, resp interface{}) error {
+			return client.Execute(ctx, auth.ForContext(ctx).Username,
+				"meta.sr.ht", client.GraphQLQuery{
+					Query:     query,
+					Variables: variables,
+				}, resp)
+		},
+		DB: database.DBForContext(ctx),
+	}
+}
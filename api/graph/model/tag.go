@@ -0,0 +1,72 @@
+package model
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/sigverify"
+)
+
+type Tag struct {
+	Type    ObjectType `json:"type"`
+	ID      string     `json:"id"`
+	ShortID string     `json:"shortId"`
+	Raw     string     `json:"raw"`
+	Name    string     `json:"name"`
+
+	message string
+
+	tag  *object.Tag
+	repo *RepoWrapper
+}
+
+func (Tag) IsObject() {}
+
+// Returns the tagged object, which may itself be a tag.
+func (t *Tag) Target() (Object, error) {
+	return LookupObject(t.repo, t.tag.Target)
+}
+
+func (t *Tag) Tagger() *Signature {
+	return &Signature{
+		Name:  t.tag.Tagger.Name,
+		Email: t.tag.Tagger.Email,
+		Time:  t.tag.Tagger.When,
+	}
+}
+
+func (t *Tag) Message() *string {
+	if t.message == "" {
+		return nil
+	}
+	return &t.message
+}
+
+func (t *Tag) Signature() (*ObjectSignature, error) {
+	raw, err := readRawObject(t.repo, t.tag.Hash)
+	if err != nil {
+		return nil, err
+	}
+	data, armored := sigverify.SplitTag(raw)
+	return parseSignature(armored, data, t.tag.Tagger.Email), nil
+}
+
+func TagFromObject(repo *RepoWrapper, obj *object.Tag) *Tag {
+	// go-git only splits PGP signatures from the message, and the message
+	// follows a blank line in the raw tag
+	message := obj.Message
+	if obj.PGPSignature == "" {
+		data, _ := sigverify.SplitTag([]byte("\n" + obj.Message))
+		message = string(data[1:])
+	}
+	return &Tag{
+		Type:    ObjectTypeTag,
+		ID:      obj.ID().String(),
+		ShortID: obj.ID().String()[:7],
+		Name:    obj.Name,
+
+		message: message,
+
+		tag:  obj,
+		repo: repo,
+	}
+}
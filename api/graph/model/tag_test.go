@@ -0,0 +1,208 @@
+package model
+
+import (
+	"context"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/sigverify"
+)
+
+func TestLookupObjectTag(t *testing.T) {
+	dir, run := testRepo(t)
+	run("commit", "--quiet", "--allow-empty", "-m", "First")
+	run("tag", "-a", "-m", "Version 1.0\n\nThe first release.", "v1.0")
+	run("tag", "-a", "-m", "Nested", "nested", "v1.0")
+	run("tag", "-a", "-m", "Tree", "tree", "HEAD^{tree}")
+
+	gitRepo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := WrapRepo(gitRepo)
+	lookup := func(rev string) Object {
+		t.Helper()
+		obj, err := LookupObject(repo, plumbing.NewHash(run("rev-parse", rev)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return obj
+	}
+
+	tag, ok := lookup("v1.0").(*Tag)
+	if !ok {
+		t.Fatalf("expected a tag, got %T", lookup("v1.0"))
+	}
+	if tag.Name != "v1.0" || tag.Message() == nil ||
+		*tag.Message() != "Version 1.0\n\nThe first release.\n" {
+		t.Errorf("unexpected tag %s: %v", tag.Name, tag.Message())
+	}
+	if tagger := tag.Tagger(); tagger.Name != "Example" ||
+		tagger.Email != "example@example.org" {
+		t.Errorf("unexpected tagger %s <%s>", tagger.Name, tagger.Email)
+	}
+	if sig, err := tag.Signature(); err != nil {
+		t.Fatal(err)
+	} else if sig != nil {
+		t.Errorf("expected no signature")
+	}
+	if target, err := tag.Target(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := target.(*Commit); !ok {
+		t.Errorf("expected v1.0 to point to a commit, got %T", target)
+	}
+
+	// Tags are not peeled
+	if target, err := lookup("nested").(*Tag).Target(); err != nil {
+		t.Fatal(err)
+	} else if tag, ok := target.(*Tag); !ok || tag.Name != "v1.0" {
+		t.Errorf("expected nested to point to v1.0, got %T", target)
+	}
+	if target, err := lookup("tree").(*Tag).Target(); err != nil {
+		t.Fatal(err)
+	} else if _, ok := target.(*Tree); !ok {
+		t.Errorf("expected tree to point to a tree, got %T", target)
+	}
+}
+
+// Like testRepo, but configures git to sign with a new SSH key, whose path is
+// returned.
+func testSigningRepo(t *testing.T) (string, func(args ...string) string, string) {
+	t.Helper()
+	dir, run := testRepo(t)
+	key := path.Join(dir, ".git", "signing-key")
+	out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "",
+		"-f", key).CombinedOutput()
+	if err != nil {
+		t.Skipf("ssh-keygen: %v: %s", err, out)
+	}
+	run("config", "gpg.format", "ssh")
+	run("config", "user.signingKey", key)
+	return dir, run, key
+}
+
+// Returns a context in which signatures are verified with testSignatureKeys.
+func testSignatureContext() context.Context {
+	return context.WithValue(context.Background(), signatureKeysCtxKey,
+		sigverify.Keys(testSignatureKeys{}))
+}
+
+func TestLookupObjectSignedTag(t *testing.T) {
+	dir, run, key := testSigningRepo(t)
+	run("commit", "--quiet", "--allow-empty", "-m", "First")
+	run("tag", "-s", "-m", "Signed release", "v1.0")
+
+	gitRepo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := LookupObject(WrapRepo(gitRepo),
+		plumbing.NewHash(run("rev-parse", "v1.0")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := obj.(*Tag)
+	if tag.Message() == nil || *tag.Message() != "Signed release\n" {
+		t.Errorf("unexpected message %v", tag.Message())
+	}
+	sig, err := tag.Signature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig == nil || sig.Format != SignatureFormatSSH {
+		t.Fatalf("expected an SSH signature, got %+v", sig)
+	}
+	want, err := exec.Command("ssh-keygen", "-l", "-f", key+".pub").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID := sig.KeyID(); keyID == nil ||
+		*keyID != strings.Fields(string(want))[1] {
+		t.Errorf("unexpected key ID %v, want %s", keyID, want)
+	}
+	ctx := testSignatureContext()
+	if status, err := sig.Status(ctx); err != nil {
+		t.Fatal(err)
+	} else if status != SignatureStatusVerified {
+		t.Errorf("got status %s, want VERIFIED", status)
+	}
+	if signer, err := sig.SignerUsername(ctx); err != nil {
+		t.Fatal(err)
+	} else if signer == nil || *signer != "alice" {
+		t.Errorf("got signer %v, want alice", signer)
+	}
+}
+
+// Attributes all SSH keys to alice.
+type testSignatureKeys struct{}
+
+func (testSignatureKeys) PGPKeyByFingerprint(string) (string, string, error) {
+	return "", "", nil
+}
+
+func (testSignatureKeys) PGPKeysByEmail(string) ([]string, string, error) {
+	return nil, "", nil
+}
+
+func (testSignatureKeys) SSHKeyByFingerprint(string) (string, error) {
+	return "alice", nil
+}
+
+func TestCommitSignature(t *testing.T) {
+	dir, run, _ := testSigningRepo(t)
+	run("commit", "--quiet", "--allow-empty", "-m", "First")
+	run("checkout", "--quiet", "-b", "topic")
+	run("commit", "--quiet", "--allow-empty", "-m", "Topic")
+	run("tag", "-s", "-m", "Topic release", "v1.0")
+	run("checkout", "--quiet", "-")
+	// The merge commit has mergetag and encoding headers, which are signed
+	run("-c", "i18n.commitEncoding=ISO-8859-1", "merge", "--quiet",
+		"--no-ff", "-S", "-m", "Merge v1.0", "v1.0")
+	raw := run("cat-file", "commit", "HEAD")
+	if !strings.Contains(raw, "\nmergetag ") ||
+		!strings.Contains(raw, "\nencoding ") {
+		t.Fatalf("expected mergetag and encoding headers:\n%s", raw)
+	}
+
+	gitRepo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := WrapRepo(gitRepo)
+	repo.Lock()
+	commit, err := repo.ResolveCommit("HEAD")
+	repo.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := CommitFromObject(repo, commit).Signature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig == nil || sig.Format != SignatureFormatSSH {
+		t.Fatalf("expected an SSH signature, got %+v", sig)
+	}
+	if status, err := sig.Status(testSignatureContext()); err != nil {
+		t.Fatal(err)
+	} else if status != SignatureStatusVerified {
+		t.Errorf("got status %s, want VERIFIED", status)
+	}
+
+	// Unsigned commits have no signature
+	repo.Lock()
+	commit, err = repo.ResolveCommit("HEAD^2")
+	repo.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig, err := CommitFromObject(repo, commit).Signature(); err != nil {
+		t.Fatal(err)
+	} else if sig != nil {
+		t.Errorf("expected no signature, got %+v", sig)
+	}
+}
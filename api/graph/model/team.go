@@ -0,0 +1,190 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"git.sr.ht/~sircmpwn/core-go/model"
+)
+
+type Team struct {
+	ID          int       `json:"id"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+
+	OrgID int
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (team *Team) As(alias string) *Team {
+	team.alias = alias
+	return team
+}
+
+func (team *Team) Alias() string {
+	return team.alias
+}
+
+func (team *Team) Table() string {
+	return "team"
+}
+
+func (team *Team) Fields() *database.ModelFields {
+	if team.fields != nil {
+		return team.fields
+	}
+	team.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &team.ID},
+			{"created", "created", &team.Created},
+			{"updated", "updated", &team.Updated},
+			{"name", "name", &team.Name},
+			{"description", "description", &team.Description},
+
+			// Always fetch:
+			{"id", "", &team.ID},
+			{"name", "", &team.Name},
+			{"org_id", "", &team.OrgID},
+		},
+	}
+	return team.fields
+}
+
+func (team *Team) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*Team, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(team.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(team.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var teams []*Team
+	for rows.Next() {
+		var team Team
+		if err := rows.Scan(database.Scan(ctx, &team)...); err != nil {
+			panic(err)
+		}
+		teams = append(teams, &team)
+	}
+
+	if len(teams) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(teams[len(teams)-1].ID),
+			Search: cur.Search,
+		}
+		teams = teams[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return teams, cur
+}
+
+type TeamMember struct {
+	ID      int       `json:"id"`
+	Created time.Time `json:"created"`
+
+	TeamID int
+	UserID int
+
+	alias  string
+	fields *database.ModelFields
+}
+
+func (tm *TeamMember) As(alias string) *TeamMember {
+	tm.alias = alias
+	return tm
+}
+
+func (tm *TeamMember) Alias() string {
+	return tm.alias
+}
+
+func (tm *TeamMember) Table() string {
+	return "team_member"
+}
+
+func (tm *TeamMember) Fields() *database.ModelFields {
+	if tm.fields != nil {
+		return tm.fields
+	}
+	tm.fields = &database.ModelFields{
+		Fields: []*database.FieldMap{
+			{"id", "id", &tm.ID},
+			{"created", "created", &tm.Created},
+
+			// Always fetch:
+			{"id", "", &tm.ID},
+			{"team_id", "", &tm.TeamID},
+			{"user_id", "", &tm.UserID},
+		},
+	}
+	return tm.fields
+}
+
+func (tm *TeamMember) QueryWithCursor(ctx context.Context,
+	runner sq.BaseRunner, q sq.SelectBuilder,
+	cur *model.Cursor) ([]*TeamMember, *model.Cursor) {
+	var (
+		err  error
+		rows *sql.Rows
+	)
+
+	if cur.Next != "" {
+		next, _ := strconv.Atoi(cur.Next)
+		q = q.Where(database.WithAlias(tm.alias, "id")+"<= ?", next)
+	}
+	q = q.
+		OrderBy(database.WithAlias(tm.alias, "id") + " DESC").
+		Limit(uint64(cur.Count + 1))
+
+	if rows, err = q.RunWith(runner).QueryContext(ctx); err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+
+	var members []*TeamMember
+	for rows.Next() {
+		var tm TeamMember
+		if err := rows.Scan(database.Scan(ctx, &tm)...); err != nil {
+			panic(err)
+		}
+		members = append(members, &tm)
+	}
+
+	if len(members) > cur.Count {
+		cur = &model.Cursor{
+			Count:  cur.Count,
+			Next:   strconv.Itoa(members[len(members)-1].ID),
+			Search: cur.Search,
+		}
+		members = members[:cur.Count]
+	} else {
+		cur = nil
+	}
+
+	return members, cur
+}
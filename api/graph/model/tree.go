@@ -1,9 +1,12 @@
 package model
 
 import (
+	"context"
 	"sort"
+	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
@@ -52,23 +55,100 @@ func (tree *Tree) Entry(path string) *TreeEntry {
 	}
 }
 
-func (tree *Tree) GetEntries() []*TreeEntry {
-	entries := tree.tree.Entries[:]
-	sort.SliceStable(entries, func(a, b int) bool {
-		return entries[a].Name < entries[b].Name
-	})
+// Returns up to limit entries of the tree, sorted by name, starting with the
+// first whose name is not less than from. If recursive is true, subtrees are
+// replaced with their entries, named by their path relative to this tree, and
+// only as much of the tree is read as is needed to fill the page. If glob is
+// not empty, only entries whose names match it are returned.
+func (tree *Tree) GetEntries(ctx context.Context, glob string, recursive bool,
+	from string, limit int) ([]*TreeEntry, error) {
+	tree.repo.Lock()
+	defer tree.repo.Unlock()
 
-	qlents := make([]*TreeEntry, len(entries))
-	for i, ent := range entries {
-		qlents[i] = &TreeEntry{
-			Name: ent.Name,
+	var qlents []*TreeEntry
+	add := func(name string, ent *object.TreeEntry) {
+		if glob != "" && !MatchGlob(glob, name) {
+			return
+		}
+		qlents = append(qlents, &TreeEntry{
+			Name: name,
 			Mode: int(ent.Mode),
 			hash: ent.Hash,
 			repo: tree.repo,
-		}
+		})
+	}
+
+	if recursive {
+		err := walkTree(ctx, tree.tree, "", from,
+			func(name string, ent *object.TreeEntry) bool {
+				add(name, ent)
+				return len(qlents) < limit
+			})
+		return qlents, err
+	}
+
+	// Subtrees are sorted as if their names ended with a slash, so the
+	// entries of a single tree are sorted again by name
+	for i := range tree.tree.Entries {
+		add(tree.tree.Entries[i].Name, &tree.tree.Entries[i])
+	}
+	sort.SliceStable(qlents, func(a, b int) bool {
+		return qlents[a].Name < qlents[b].Name
+	})
+	i := sort.Search(len(qlents), func(n int) bool {
+		return qlents[n].Name >= from
+	})
+	qlents = qlents[i:]
+	if len(qlents) > limit {
+		qlents = qlents[:limit]
 	}
+	return qlents, nil
+}
+
+// Calls fn for each entry of the tree and its subtrees other than the subtrees
+// themselves, in order of their paths, starting with the first whose path is
+// not less than from. Subtrees whose paths all come before from are not read.
+// Stops early if fn returns false. The caller must hold the lock.
+func walkTree(ctx context.Context, tree *object.Tree, prefix, from string,
+	fn func(name string, ent *object.TreeEntry) bool) error {
+	_, err := walkSubtree(ctx, tree, prefix, from, fn)
+	return err
+}
+
+func walkSubtree(ctx context.Context, tree *object.Tree, prefix, from string,
+	fn func(name string, ent *object.TreeEntry) bool) (bool, error) {
+	// Depth-first traversal in the order of the entries of each tree visits
+	// paths in sorted order, as subtrees sort as if their names ended with a
+	// slash.
+	for i := range tree.Entries {
+		ent := &tree.Entries[i]
+		name := prefix + ent.Name
+		if ent.Mode != filemode.Dir {
+			if name < from {
+				continue
+			}
+			if !fn(name, ent) {
+				return false, nil
+			}
+			continue
+		}
 
-	return qlents
+		dir := name + "/"
+		if from > dir && !strings.HasPrefix(from, dir) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		subtree, err := tree.Tree(ent.Name)
+		if err != nil {
+			return false, err
+		}
+		if ok, err := walkSubtree(ctx, subtree, dir, from, fn); err != nil || !ok {
+			return ok, err
+		}
+	}
+	return true, nil
 }
 
 func TreeFromObject(repo *RepoWrapper, obj *object.Tree) *Tree {
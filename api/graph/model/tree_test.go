@@ -0,0 +1,90 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTreeGetEntries(t *testing.T) {
+	files := map[string]string{
+		"a-b":       "1",
+		"a/z":       "2",
+		"a/y.txt":   "3",
+		"a.txt":     "4",
+		"b/c/d.txt": "5",
+		"b/c.txt":   "6",
+		"ba":        "7",
+	}
+	commits := testCommits(t, files)
+	tree, err := commits[0].Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	qltree := TreeFromObject(WrapRepo(nil), tree)
+	ctx := context.Background()
+
+	var want []string
+	for name := range files {
+		want = append(want, name)
+	}
+	sort.Strings(want)
+
+	// Page by page, in order of the paths
+	for limit := 1; limit <= len(files)+1; limit++ {
+		var (
+			got  []string
+			from string
+		)
+		for {
+			entries, err := qltree.GetEntries(ctx, "", true, from, limit+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, ent := range entries {
+				if i < limit {
+					got = append(got, ent.Name)
+				}
+			}
+			if len(entries) <= limit {
+				break
+			}
+			from = entries[limit].Name
+		}
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("limit %d: got %v, want %v", limit, got, want)
+		}
+	}
+
+	entries, err := qltree.GetEntries(ctx, "**/*.txt", true, "a/z", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ent := range entries {
+		names = append(names, ent.Name)
+	}
+	if got := strings.Join(names, " "); got != "b/c.txt b/c/d.txt" {
+		t.Errorf("got %q", got)
+	}
+
+	// Not recursive: subtrees are sorted by their names alone
+	entries, err = qltree.GetEntries(ctx, "", false, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, ent := range entries {
+		names = append(names, ent.Name)
+	}
+	if got := strings.Join(names, " "); got != "a a-b a.txt b ba" {
+		t.Errorf("got %q", got)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := qltree.GetEntries(cancelled, "", true, "", 10); err == nil {
+		t.Error("expected an error from a cancelled context")
+	}
+}
@@ -1,13 +1,38 @@
 package graph
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
 	"regexp"
+	"strconv"
+
+	"git.sr.ht/~sircmpwn/core-go/auth"
+	"git.sr.ht/~sircmpwn/core-go/client"
+	"git.sr.ht/~sircmpwn/core-go/database"
+	"git.sr.ht/~sircmpwn/core-go/valid"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph/model"
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/loaders"
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/repos"
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/netutil"
 )
 
 type Resolver struct{}
 
 var (
 	repoNameRE = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	orgNameRE  = regexp.MustCompile(`^[a-z_][a-z0-9_-]+$`)
+	teamNameRE = regexp.MustCompile(`^[a-z_][a-z0-9_-]+$`)
+	trailerRE  = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
 )
 
 var allowedCloneSchemes = map[string]struct{}{
@@ -24,3 +49,213 @@ const (
 	CloneComplete   CloneStatus = "COMPLETE"
 	CloneError      CloneStatus = "ERROR"
 )
+
+// Configures a newly initialized bare repository for use with git.sr.ht,
+// installing the hooks and exporting it to git-daemon if it is not private.
+func initRepository(gitrepo *git.Repository, repoPath string, repoID int,
+	postUpdate string, visibility model.Visibility) error {
+	gitconfig, err := gitrepo.Config()
+	if err != nil {
+		return err
+	}
+	gitconfig.Raw.SetOption("core", "", "repositoryformatversion", "0")
+	gitconfig.Raw.SetOption("core", "", "filemode", "true")
+	gitconfig.Raw.SetOption("srht", "", "repo-id", strconv.Itoa(repoID))
+	gitconfig.Raw.SetOption("receive", "", "denyDeleteCurrent", "ignore")
+	gitconfig.Raw.SetOption("receive", "", "advertisePushOptions", "true")
+	if err := gitrepo.Storer.SetConfig(gitconfig); err != nil {
+		return err
+	}
+
+	hookdir := path.Join(repoPath, "hooks")
+	if err := os.Mkdir(hookdir, os.ModePerm); err != nil {
+		return err
+	}
+	for _, hook := range []string{"pre-receive", "update", "post-update"} {
+		if err := os.Symlink(postUpdate, path.Join(hookdir, hook)); err != nil {
+			return err
+		}
+	}
+
+	export := path.Join(repoPath, "git-daemon-export-ok")
+	if visibility != model.VisibilityPrivate {
+		_, err := os.Create(export)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Push mirrors are pushed to with HTTP basic authentication, so only HTTP(S)
+// URLs are supported. Credentials are stored separately from the URL.
+func validatePushMirrorURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return valid.Errorf(ctx, "url", "Invalid URL: %s", err)
+	} else if u.Scheme != "https" && u.Scheme != "http" {
+		return valid.Errorf(ctx, "url", "Unsupported protocol %q", u.Scheme)
+	} else if u.Host == "" {
+		return valid.Errorf(ctx, "url", "Cannot use URL without host")
+	} else if u.User != nil {
+		return valid.Errorf(ctx, "url",
+			"Credentials must be given with the username and password parameters")
+	}
+
+	// Pushes are made from within our network, so they must not be able to
+	// reach internal services
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return valid.Errorf(ctx, "url", "Unable to resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if netutil.IsPrivateIP(addr.IP) {
+			return valid.Errorf(ctx, "url",
+				"Cannot push to %s, which is not a public address", u.Hostname())
+		}
+	}
+	return nil
+}
+
+// Returns true if meta.sr.ht has a user with the given name, whether or not
+// they have used git.sr.ht yet.
+func metaUserExists(ctx context.Context, username string) (bool, error) {
+	var resp struct {
+		Data struct {
+			User *struct {
+				ID int `json:"id"`
+			} `json:"userByName"`
+		} `json:"data"`
+		Errors []gqlerror.Error `json:"errors"`
+	}
+	if err := client.Execute(ctx, auth.ForContext(ctx).Username,
+		"meta.sr.ht", client.GraphQLQuery{
+			Query: `
+			query UserByName($username: String!) {
+				userByName(username: $username) { id }
+			}`,
+			Variables: map[string]interface{}{
+				"username": username,
+			},
+		}, &resp); err != nil {
+		return false, err
+	} else if len(resp.Errors) > 0 {
+		return false, fmt.Errorf("Failed to look up user: %s",
+			resp.Errors[0].Message)
+	}
+	return resp.Data.User != nil, nil
+}
+
+// Returns the name of the organization which owns the repository, or of the
+// user who owns it if it does not belong to an organization.
+func repoOwnerName(ctx context.Context, repo *model.Repository) (string, error) {
+	if repo.OrgID != nil {
+		org, err := loaders.ForContext(ctx).OrganizationsByID.Load(*repo.OrgID)
+		if err != nil || org == nil {
+			return "", fmt.Errorf("Failed to look up organization %d: %v",
+				*repo.OrgID, err)
+		}
+		return org.Name, nil
+	}
+	user, err := loaders.ForContext(ctx).UsersByID.Load(repo.OwnerID)
+	if err != nil || user == nil {
+		return "", fmt.Errorf("Failed to look up user %d: %v", repo.OwnerID, err)
+	}
+	return user.Username, nil
+}
+
+// Loads a repository which the authenticated user may push to, along with the
+// context for pushes to it on their behalf.
+func loadWritableRepo(ctx context.Context,
+	repoID int) (*model.Repository, *repos.PushContext, error) {
+	user := auth.ForContext(ctx)
+	var (
+		repo      model.Repository
+		ownerName string
+	)
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		r := (&model.Repository{}).As(`repo`)
+		row := sq.
+			Select(`repo.id`, `repo.name`, `repo.path`, `repo.owner_id`,
+				`repo.org_id`, `repo.visibility`, `repo.mirror_url`,
+				`COALESCE(org.name, owner.username)`).
+			From(`repository repo`).
+			Join(`"user" owner ON owner.id = repo.owner_id`).
+			LeftJoin(`organization org ON org.id = repo.org_id`).
+			Where(`repo.id = ?`, repoID).
+			Where(r.WritableBy(user.UserID)).
+			PlaceholderFormat(sq.Dollar).
+			RunWith(tx).
+			QueryRowContext(ctx)
+		return row.Scan(&repo.ID, &repo.Name, &repo.Path, &repo.OwnerID,
+			&repo.OrgID, &repo.RawVisibility, &repo.MirrorURL, &ownerName)
+	}); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("No repository by ID %d found for this user", repoID)
+		}
+		return nil, nil, err
+	}
+	if repo.MirrorURL != nil {
+		return nil, nil, fmt.Errorf("This repository is a mirror and does not accept pushes")
+	}
+
+	return &repo, &repos.PushContext{
+		Repo: repos.PushRepo{
+			ID:           repo.ID,
+			Name:         repo.Name,
+			OwnerID:      repo.OwnerID,
+			OwnerName:    ownerName,
+			OrgID:        repo.OrgID,
+			Path:         repo.Path,
+			AbsolutePath: repo.Path,
+			Visibility:   repo.RawVisibility,
+		},
+		User: repos.PushUser{
+			CanonicalName: "~" + user.Username,
+			Name:          user.Username,
+		},
+	}, nil
+}
+
+// Creates a reference to the given object on behalf of the authenticated
+// user. Fails if the reference already exists.
+func createRef(ctx context.Context, repo *model.Repository,
+	pctx *repos.PushContext, name plumbing.ReferenceName,
+	id plumbing.Hash) (*model.Reference, error) {
+	if err := repos.UpdateRef(ctx, pctx, string(name), "", id.String()); err != nil {
+		return nil, err
+	}
+	return &model.Reference{
+		Repo: repo,
+		Ref:  plumbing.NewHashReference(name, id),
+	}, nil
+}
+
+// Deletes a reference on behalf of the authenticated user and returns it.
+func deleteRef(ctx context.Context, repoID int,
+	name plumbing.ReferenceName) (*model.Reference, error) {
+	repo, pctx, err := loadWritableRepo(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	ref, err := gitRepo.Reference(name, false)
+	gitRepo.Unlock()
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, fmt.Errorf("No reference %s found", name)
+	} else if err != nil {
+		return nil, err
+	}
+	if ref.Type() != plumbing.HashReference {
+		return nil, fmt.Errorf("Reference %s is a symbolic reference", name)
+	}
+	if err := repos.UpdateRef(ctx, pctx, string(name),
+		ref.Hash().String(), ""); err != nil {
+		return nil, err
+	}
+	return &model.Reference{Repo: repo, Ref: ref}, nil
+}
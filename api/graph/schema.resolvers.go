@@ -17,12 +17,13 @@ import (
 	"net/url"
 	"os"
 	"path"
+	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 
 	"git.sr.ht/~sircmpwn/core-go/auth"
 	"git.sr.ht/~sircmpwn/core-go/config"
+	"git.sr.ht/~sircmpwn/core-go/crypto"
 	"git.sr.ht/~sircmpwn/core-go/database"
 	coremodel "git.sr.ht/~sircmpwn/core-go/model"
 	"git.sr.ht/~sircmpwn/core-go/server"
@@ -38,7 +39,6 @@ import (
 	git "github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/storer"
 	"github.com/lib/pq"
 	minio "github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
@@ -69,11 +69,61 @@ func (r *artifactResolver) URL(ctx context.Context, obj *model.Artifact) (string
 	return fmt.Sprintf("https://%s/%s/%s/%s", upstream, bucket, prefix, obj.Filename), nil
 }
 
+func (r *binaryBlobResolver) Base64(ctx context.Context, obj *model.BinaryBlob, rangeArg *model.ByteRange) (string, error) {
+	return obj.Base64Range(rangeArg)
+}
+
 func (r *commitResolver) Diff(ctx context.Context, obj *model.Commit) (string, error) {
-	return obj.DiffContext(ctx), nil
+	return obj.DiffContext(ctx)
+}
+
+func (r *commitResolver) StructuredDiff(ctx context.Context, obj *model.Commit, base *string, context *int) (*model.Diff, error) {
+	contextLines := 3
+	if context != nil {
+		contextLines = *context
+	}
+	if contextLines < 0 {
+		return nil, valid.Errorf(ctx, "context", "Context must not be negative")
+	}
+	return obj.StructuredDiffContext(ctx, base, contextLines)
+}
+
+func (r *comparisonResolver) Commits(ctx context.Context, obj *model.Comparison, cursor *coremodel.Cursor) (*model.CommitCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	commits, err := obj.Log(ctx, cursor.Next, cursor.Count+1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(commits) > cursor.Count {
+		cursor = &coremodel.Cursor{
+			Count:  cursor.Count,
+			Next:   commits[cursor.Count].ID,
+			Search: "",
+		}
+		commits = commits[:cursor.Count]
+	} else {
+		cursor = nil
+	}
+
+	return &model.CommitCursor{commits, cursor}, nil
+}
+
+func (r *comparisonResolver) Diff(ctx context.Context, obj *model.Comparison, context *int) (*model.Diff, error) {
+	contextLines := 3
+	if context != nil {
+		contextLines = *context
+	}
+	if contextLines < 0 {
+		return nil, valid.Errorf(ctx, "context", "Context must not be negative")
+	}
+	return obj.DiffContext(ctx, contextLines)
 }
 
-func (r *mutationResolver) CreateRepository(ctx context.Context, name string, visibility model.Visibility, description *string, cloneURL *string) (*model.Repository, error) {
+func (r *mutationResolver) CreateRepository(ctx context.Context, name string, visibility model.Visibility, description *string, cloneURL *string, owner *string, mirror *bool) (*model.Repository, error) {
 	if !repoNameRE.MatchString(name) {
 		return nil, valid.Errorf(ctx, "name", "Invalid repository name '%s' (must match %s)",
 			name, repoNameRE.String())
@@ -84,6 +134,18 @@ func (r *mutationResolver) CreateRepository(ctx context.Context, name string, vi
 	if name == ".git" || name == ".hg" {
 		return nil, valid.Errorf(ctx, "name", "Invalid repository name '%s' (must not be .git or .hg)", name)
 	}
+	var mirrorURL, mirrorUsername *string
+	var mirrorPassword []byte
+	if mirror != nil && *mirror {
+		if cloneURL == nil {
+			return nil, valid.Errorf(ctx, "cloneUrl", "A clone URL is required for mirrors")
+		}
+		remote, username, password := repos.SplitMirrorURL(*cloneURL)
+		mirrorURL, mirrorUsername = &remote, username
+		if password != nil {
+			mirrorPassword = crypto.Encrypt([]byte(*password))
+		}
+	}
 
 	conf := config.ForContext(ctx)
 	repoStore, ok := conf.Get("git.sr.ht", "repos")
@@ -96,7 +158,22 @@ func (r *mutationResolver) CreateRepository(ctx context.Context, name string, vi
 	}
 
 	user := auth.ForContext(ctx)
-	repoPath := path.Join(repoStore, "~"+user.Username, name)
+	ownerName := "~" + user.Username
+	var orgID *int
+	if owner != nil && *owner != ownerName {
+		if !strings.HasPrefix(*owner, "~") {
+			return nil, valid.Errorf(ctx, "owner", "Unknown entity '%s'", *owner)
+		}
+		org, err := loaders.ForContext(ctx).OrganizationsByName.Load((*owner)[1:])
+		if err != nil {
+			return nil, err
+		} else if org == nil {
+			return nil, valid.Errorf(ctx, "owner", "No such organization '%s'", *owner)
+		}
+		orgID = &org.ID
+		ownerName = org.CanonicalName()
+	}
+	repoPath := path.Join(repoStore, ownerName, name)
 
 	var (
 		repoCreated bool
@@ -136,18 +213,28 @@ func (r *mutationResolver) CreateRepository(ctx context.Context, name string, vi
 		row := tx.QueryRowContext(ctx, `
 			INSERT INTO repository (
 				created, updated, name, description, path, visibility, owner_id,
-				clone_status
-			) VALUES (
+				clone_status, org_id, mirror_url, mirror_username,
+				mirror_encrypted_password
+			) SELECT
 				NOW() at time zone 'utc',
 				NOW() at time zone 'utc',
-				$1, $2, $3, $4, $5, $6
+				$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+			WHERE $7::integer IS NULL OR EXISTS (
+				SELECT 1 FROM organization_member
+				WHERE org_id = $7 AND user_id = $5
+					AND role IN ('admin', 'member')
 			) RETURNING 
 				id, created, updated, name, description, visibility,
-				path, owner_id;
-		`, name, description, repoPath, dvis, user.UserID, cloneStatus)
+				path, owner_id, org_id, mirror_url;
+		`, name, description, repoPath, dvis, user.UserID, cloneStatus, orgID,
+			mirrorURL, mirrorUsername, mirrorPassword)
 		if err := row.Scan(&repo.ID, &repo.Created, &repo.Updated, &repo.Name,
 			&repo.Description, &repo.RawVisibility,
-			&repo.Path, &repo.OwnerID); err != nil {
+			&repo.Path, &repo.OwnerID, &repo.OrgID, &repo.MirrorURL); err != nil {
+			if err == sql.ErrNoRows {
+				return valid.Errorf(ctx, "owner",
+					"You are not permitted to create repositories for %s", ownerName)
+			}
 			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
 				return valid.Errorf(ctx, "name", "A repository with this name already exists.")
 			}
@@ -160,36 +247,10 @@ func (r *mutationResolver) CreateRepository(ctx context.Context, name string, vi
 		}
 		repoCreated = true
 
-		gitconfig, err := gitrepo.Config()
-		if err != nil {
-			return err
-		}
-		gitconfig.Raw.SetOption("core", "", "repositoryformatversion", "0")
-		gitconfig.Raw.SetOption("core", "", "filemode", "true")
-		gitconfig.Raw.SetOption("srht", "", "repo-id", strconv.Itoa(repo.ID))
-		gitconfig.Raw.SetOption("receive", "", "denyDeleteCurrent", "ignore")
-		gitconfig.Raw.SetOption("receive", "", "advertisePushOptions", "true")
-		if err := gitrepo.Storer.SetConfig(gitconfig); err != nil {
-			return err
-		}
-
-		hookdir := path.Join(repoPath, "hooks")
-		if err := os.Mkdir(hookdir, os.ModePerm); err != nil {
+		if err := initRepository(gitrepo, repoPath, repo.ID,
+			postUpdate, repo.Visibility()); err != nil {
 			return err
 		}
-		for _, hook := range []string{"pre-receive", "update", "post-update"} {
-			if err := os.Symlink(postUpdate, path.Join(hookdir, hook)); err != nil {
-				return err
-			}
-		}
-
-		export := path.Join(repoPath, "git-daemon-export-ok")
-		if repo.Visibility() != model.VisibilityPrivate {
-			_, err := os.Create(export)
-			if err != nil {
-				return err
-			}
-		}
 
 		if cloneURL != nil {
 			u, err := url.Parse(*cloneURL)
@@ -285,8 +346,6 @@ func (r *mutationResolver) UpdateRepository(ctx context.Context, id int, input m
 	}()
 
 	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
-		user := auth.ForContext(ctx)
-
 		query := sq.Update(repo.Table()).
 			PlaceholderFormat(sq.Dollar)
 
@@ -315,7 +374,10 @@ func (r *mutationResolver) UpdateRepository(ctx context.Context, id int, input m
 					NOW() at time zone 'utc',
 					orig.name, orig.path, orig.owner_id, orig.id
 				FROM repository orig
-				WHERE id = $1 AND owner_id = $2
+				WHERE id = $1 AND ((org_id IS NULL AND owner_id = $2) OR org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $2 AND role = 'admin'
+				))
 				RETURNING path;
 			`, id, auth.ForContext(ctx).UserID)
 			if err := row.Scan(&origPath); err != nil {
@@ -329,13 +391,7 @@ func (r *mutationResolver) UpdateRepository(ctx context.Context, id int, input m
 				return
 			}
 
-			conf := config.ForContext(ctx)
-			repoStore, ok := conf.Get("git.sr.ht", "repos")
-			if !ok || repoStore == "" {
-				panic(fmt.Errorf("Configuration error: [git.sr.ht]repos is unset"))
-			}
-
-			repoPath := path.Join(repoStore, "~"+user.Username, name)
+			repoPath := path.Join(path.Dir(origPath), name)
 			err := os.Rename(origPath, repoPath)
 			if errors.Is(err, os.ErrExist) {
 				valid.Error("A repository with this name already exists.").
@@ -378,16 +434,16 @@ func (r *mutationResolver) UpdateRepository(ctx context.Context, id int, input m
 
 		query = query.
 			Where(`id = ?`, id).
-			Where(`owner_id = ?`, auth.ForContext(ctx).UserID).
+			Where(repo.ManageableBy(auth.ForContext(ctx).UserID)).
 			Set(`updated`, sq.Expr(`now() at time zone 'utc'`)).
 			Suffix(`RETURNING
 				id, created, updated, name, description, visibility,
-				path, owner_id`)
+				path, owner_id, org_id`)
 
 		row := query.RunWith(tx).QueryRowContext(ctx)
 		if err := row.Scan(&repo.ID, &repo.Created, &repo.Updated,
 			&repo.Name, &repo.Description, &repo.RawVisibility,
-			&repo.Path, &repo.OwnerID); err != nil {
+			&repo.Path, &repo.OwnerID, &repo.OrgID); err != nil {
 			if err == sql.ErrNoRows {
 				return fmt.Errorf("No repository by ID %d found for this user", id)
 			}
@@ -430,6 +486,28 @@ func (r *mutationResolver) UpdateRepository(ctx context.Context, id int, input m
 			}
 		}
 
+		if moved {
+			// Forks refer to this repository's objects by path
+			rows, err := tx.QueryContext(ctx,
+				`SELECT path FROM repository WHERE forked_from = $1;`, repo.ID)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var fork string
+				if err := rows.Scan(&fork); err != nil {
+					return err
+				}
+				if err := repos.SetAlternate(fork, repo.Path); err != nil {
+					return err
+				}
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+		}
+
 		webhooks.DeliverRepoEvent(ctx, model.WebhookEventRepoUpdate, &repo)
 		webhooks.DeliverLegacyRepoUpdate(ctx, &repo)
 		return nil
@@ -446,6 +524,111 @@ func (r *mutationResolver) UpdateRepository(ctx context.Context, id int, input m
 	return &repo, nil
 }
 
+func (r *mutationResolver) ForkRepository(ctx context.Context, id int, name *string) (*model.Repository, error) {
+	upstream, err := loaders.ForContext(ctx).RepositoriesByID.Load(id)
+	if err != nil {
+		return nil, err
+	} else if upstream == nil {
+		return nil, fmt.Errorf("No repository by ID %d found", id)
+	}
+
+	forkName := upstream.Name
+	if name != nil {
+		forkName = *name
+	}
+	if !repoNameRE.MatchString(forkName) {
+		return nil, valid.Errorf(ctx, "name", "Invalid repository name '%s' (must match %s)",
+			forkName, repoNameRE.String())
+	}
+	if forkName == "." || forkName == ".." {
+		return nil, valid.Errorf(ctx, "name", "Invalid repository name '%s' (must not be . or ..)", forkName)
+	}
+	if forkName == ".git" || forkName == ".hg" {
+		return nil, valid.Errorf(ctx, "name", "Invalid repository name '%s' (must not be .git or .hg)", forkName)
+	}
+
+	conf := config.ForContext(ctx)
+	repoStore, ok := conf.Get("git.sr.ht", "repos")
+	if !ok || repoStore == "" {
+		panic(fmt.Errorf("Configuration error: [git.sr.ht]repos is unset"))
+	}
+	postUpdate, ok := conf.Get("git.sr.ht", "post-update-script")
+	if !ok {
+		panic(fmt.Errorf("Configuration error: [git.sr.ht]post-update is unset"))
+	}
+
+	user := auth.ForContext(ctx)
+	repoPath := path.Join(repoStore, "~"+user.Username, forkName)
+
+	var (
+		repoCreated bool
+		repo        model.Repository
+	)
+	defer func() {
+		if err := recover(); err != nil {
+			if repoCreated {
+				err := os.RemoveAll(repoPath)
+				if err != nil {
+					panic(err)
+				}
+			}
+			panic(err)
+		}
+	}()
+
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO repository (
+				created, updated, name, description, path, visibility, owner_id,
+				clone_status, forked_from
+			) VALUES (
+				NOW() at time zone 'utc',
+				NOW() at time zone 'utc',
+				$1, $2, $3, $4, $5, $6, $7
+			) RETURNING
+				id, created, updated, name, description, visibility,
+				path, owner_id, org_id, forked_from;
+		`, forkName, upstream.Description, repoPath, upstream.RawVisibility,
+			user.UserID, CloneNone, upstream.ID)
+		if err := row.Scan(&repo.ID, &repo.Created, &repo.Updated, &repo.Name,
+			&repo.Description, &repo.RawVisibility, &repo.Path, &repo.OwnerID,
+			&repo.OrgID, &repo.ForkedFromID); err != nil {
+			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+				return valid.Errorf(ctx, "name", "A repository with this name already exists.")
+			}
+			return err
+		}
+
+		gitrepo, err := git.PlainInit(repoPath, true)
+		if err != nil {
+			return err
+		}
+		repoCreated = true
+
+		if err := initRepository(gitrepo, repoPath, repo.ID,
+			postUpdate, repo.Visibility()); err != nil {
+			return err
+		}
+		if err := repos.Fork(ctx, upstream.Path, repoPath); err != nil {
+			return err
+		}
+
+		webhooks.DeliverRepoEvent(ctx, model.WebhookEventRepoCreated, &repo)
+		webhooks.DeliverLegacyRepoCreate(ctx, &repo)
+		return nil
+	}); err != nil {
+		if repoCreated {
+			err := os.RemoveAll(repoPath)
+			if err != nil {
+				panic(err)
+			}
+		}
+		return nil, err
+	}
+
+	return &repo, nil
+}
+
 func (r *mutationResolver) DeleteRepository(ctx context.Context, id int) (*model.Repository, error) {
 	var repo model.Repository
 
@@ -467,17 +650,47 @@ func (r *mutationResolver) DeleteRepository(ctx context.Context, id int) (*model
 			return err
 		}
 
+		// Forks borrow objects from this repository, so they need their own
+		// copies before it is removed from disk. This has to be looked up
+		// before the deletion clears their forked_from column.
+		rows, err = tx.QueryContext(ctx, `
+			WITH RECURSIVE forks (id, path, depth) AS (
+				SELECT id, path, 1 FROM repository WHERE forked_from = $1
+				UNION
+				SELECT repo.id, repo.path, forks.depth + 1
+				FROM repository repo
+				JOIN forks ON repo.forked_from = forks.id
+			)
+			SELECT path FROM forks ORDER BY depth DESC;`, id)
+		if err != nil {
+			return err
+		}
+		var forks []string
+		for rows.Next() {
+			var fork string
+			if err := rows.Scan(&fork); err != nil {
+				return err
+			}
+			forks = append(forks, fork)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
 		row := tx.QueryRowContext(ctx, `
 			DELETE FROM repository
-			WHERE id = $1 AND owner_id = $2
+			WHERE id = $1 AND ((org_id IS NULL AND owner_id = $2) OR org_id IN (
+				SELECT org_id FROM organization_member
+				WHERE user_id = $2 AND role = 'admin'
+			))
 			RETURNING
 				id, created, updated, name, description, visibility,
-				path, owner_id;
+				path, owner_id, org_id;
 		`, id, auth.ForContext(ctx).UserID)
 
 		if err := row.Scan(&repo.ID, &repo.Created, &repo.Updated,
 			&repo.Name, &repo.Description, &repo.RawVisibility,
-			&repo.Path, &repo.OwnerID); err != nil {
+			&repo.Path, &repo.OwnerID, &repo.OrgID); err != nil {
 			if err == sql.ErrNoRows {
 				return fmt.Errorf("No repository by ID %d found for this user", id)
 			}
@@ -487,13 +700,16 @@ func (r *mutationResolver) DeleteRepository(ctx context.Context, id int) (*model
 		webhooks.DeliverRepoEvent(ctx, model.WebhookEventRepoDeleted, &repo)
 		webhooks.DeliverLegacyRepoDeleted(ctx, &repo)
 
-		if err := os.RemoveAll(repo.Path); err != nil {
+		if err := repos.Delete(ctx, repo.Path, forks); err != nil {
 			return err
 		}
 
 		if len(artifacts) > 0 {
-			username := auth.ForContext(ctx).Username
-			repos.DeleteArtifacts(ctx, username, repo.Name, artifacts)
+			ownerName, err := repoOwnerName(ctx, &repo)
+			if err != nil {
+				return err
+			}
+			repos.DeleteArtifacts(ctx, ownerName, repo.Name, artifacts)
 		}
 		return nil
 	}); err != nil {
@@ -519,7 +735,12 @@ func (r *mutationResolver) UpdateACL(ctx context.Context, repoID int, mode model
 			WITH grantee AS (
 				SELECT u.id uid, repo.id rid
 				FROM "user" u, repository repo
-				WHERE u.username = $3 AND repo.id = $1 AND repo.owner_id = $2
+				WHERE u.username = $3 AND repo.id = $1 AND (
+					(repo.org_id IS NULL AND repo.owner_id = $2) OR repo.org_id IN (
+						SELECT org_id FROM organization_member
+						WHERE user_id = $2 AND role = 'admin'
+					)
+				)
 			)
 			INSERT INTO access (created, updated, mode, user_id, repo_id)
 			SELECT
@@ -553,7 +774,12 @@ func (r *mutationResolver) DeleteACL(ctx context.Context, id int) (*model.ACL, e
 		row := tx.QueryRowContext(ctx, `
 			DELETE FROM access
 			USING repository repo
-			WHERE repo_id = repo.id AND repo.owner_id = $1 AND access.id = $2
+			WHERE repo_id = repo.id AND access.id = $2 AND (
+				(repo.org_id IS NULL AND repo.owner_id = $1) OR repo.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $1 AND role = 'admin'
+				)
+			)
 			RETURNING access.id, access.created, mode, repo_id, user_id;
 		`, auth.ForContext(ctx).UserID, id)
 		if err := row.Scan(&acl.ID, &acl.Created, &acl.RawAccessMode,
@@ -570,67 +796,742 @@ func (r *mutationResolver) DeleteACL(ctx context.Context, id int) (*model.ACL, e
 	return &acl, nil
 }
 
-func (r *mutationResolver) UploadArtifact(ctx context.Context, repoID int, revspec string, file graphql.Upload) (*model.Artifact, error) {
-	conf := config.ForContext(ctx)
-	upstream, _ := conf.Get("objects", "s3-upstream")
-	accessKey, _ := conf.Get("objects", "s3-access-key")
-	secretKey, _ := conf.Get("objects", "s3-secret-key")
-	bucket, _ := conf.Get("git.sr.ht", "s3-bucket")
-	prefix, _ := conf.Get("git.sr.ht", "s3-prefix")
-	if upstream == "" || accessKey == "" || secretKey == "" || bucket == "" {
-		return nil, fmt.Errorf("Object storage is not enabled for this server")
-	}
-
-	mc, err := minio.New(upstream, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: true,
-	})
-	if err != nil {
-		panic(err)
+func (r *mutationResolver) UpdateTeamACL(ctx context.Context, repoID int, mode model.AccessMode, teamID int) (*model.TeamACL, error) {
+	var acl model.TeamACL
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		// Only teams of the organization which owns the repository may be
+		// granted access to it
+		row := tx.QueryRowContext(ctx, `
+			WITH grantee AS (
+				SELECT team.id tid, repo.id rid
+				FROM team
+				JOIN repository repo ON repo.org_id = team.org_id
+				WHERE team.id = $3 AND repo.id = $1 AND repo.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $2 AND role = 'admin'
+				)
+			)
+			INSERT INTO team_access (created, updated, mode, team_id, repo_id)
+			SELECT
+				NOW() at time zone 'utc', NOW() at time zone 'utc',
+				$4, grantee.tid, grantee.rid
+			FROM grantee
+			ON CONFLICT ON CONSTRAINT uq_team_access_team_id_repo_id
+			DO UPDATE SET mode = $4, updated = NOW() at time zone 'utc'
+			RETURNING id, created, mode, repo_id, team_id;`,
+			repoID, auth.ForContext(ctx).UserID,
+			teamID, strings.ToLower(string(mode)))
+		if err := row.Scan(&acl.ID, &acl.Created, &acl.RawAccessMode,
+			&acl.RepoID, &acl.TeamID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No such repository or team found")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
-	repo, err := loaders.ForContext(ctx).RepositoriesByID.Load(repoID)
-	if err != nil {
-		return nil, fmt.Errorf("Repository %d not found", repoID)
-	}
-	if repo.OwnerID != auth.ForContext(ctx).UserID {
-		return nil, fmt.Errorf("Access denied for repo %d", repoID)
-	}
+	return &acl, nil
+}
 
-	gitRepo := repo.Repo()
-	gitRepo.Lock()
-	hash, err := gitRepo.ResolveRevision(plumbing.Revision(revspec))
-	gitRepo.Unlock()
-	if err != nil {
+func (r *mutationResolver) DeleteTeamACL(ctx context.Context, id int) (*model.TeamACL, error) {
+	var acl model.TeamACL
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM team_access ta
+			USING repository repo
+			WHERE ta.repo_id = repo.id AND ta.id = $2 AND repo.org_id IN (
+				SELECT org_id FROM organization_member
+				WHERE user_id = $1 AND role = 'admin'
+			)
+			RETURNING ta.id, ta.created, ta.mode, ta.repo_id, ta.team_id;
+		`, auth.ForContext(ctx).UserID, id)
+		if err := row.Scan(&acl.ID, &acl.Created, &acl.RawAccessMode,
+			&acl.RepoID, &acl.TeamID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No such repository or ACL entry found")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
 		return nil, err
 	}
+	return &acl, nil
+}
 
-	s3path := path.Join(prefix, "artifacts",
-		"~"+auth.ForContext(ctx).Username, repo.Name, file.Filename)
-
-	err = mc.MakeBucket(ctx, bucket, minio.MakeBucketOptions{})
-	if s3err, ok := err.(minio.ErrorResponse); !ok ||
-		(s3err.Code != "BucketAlreadyExists" && s3err.Code != "BucketAlreadyOwnedByYou") {
-		panic(err)
+func (r *mutationResolver) CreateOrganization(ctx context.Context, name string, description *string) (*model.Organization, error) {
+	if !orgNameRE.MatchString(name) {
+		return nil, valid.Errorf(ctx, "name", "Invalid organization name '%s' (must match %s)",
+			name, orgNameRE.String())
 	}
-
-	core := minio.Core{mc}
-	uid, err := core.NewMultipartUpload(ctx, bucket,
-		s3path, minio.PutObjectOptions{
-			ContentType: "application/octet-stream",
-		})
-	if err != nil {
+	// Organizations share a namespace with users, including those who have
+	// not used git.sr.ht yet
+	if exists, err := metaUserExists(ctx, name); err != nil {
 		return nil, err
+	} else if exists {
+		return nil, valid.Errorf(ctx, "name", "This name is already in use.")
 	}
 
-	defer func() {
-		if err := recover(); err != nil {
-			core.AbortMultipartUpload(context.Background(), bucket, s3path, uid)
-			panic(err)
+	var org model.Organization
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO organization (created, updated, name, description)
+			SELECT
+				NOW() at time zone 'utc', NOW() at time zone 'utc', $1, $2
+			WHERE NOT EXISTS (SELECT 1 FROM "user" WHERE username = $1)
+			RETURNING id, created, updated, name, description;
+		`, name, description)
+		if err := row.Scan(&org.ID, &org.Created, &org.Updated,
+			&org.Name, &org.Description); err != nil {
+			if err == sql.ErrNoRows ||
+				strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+				return valid.Errorf(ctx, "name", "This name is already in use.")
+			}
+			return err
 		}
-	}()
 
-	var artifact model.Artifact
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO organization_member (
+				created, updated, org_id, user_id, role
+			) VALUES (
+				NOW() at time zone 'utc', NOW() at time zone 'utc',
+				$1, $2, 'admin'
+			);
+		`, org.ID, auth.ForContext(ctx).UserID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *mutationResolver) DeleteOrganization(ctx context.Context, id int) (*model.Organization, error) {
+	var org model.Organization
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM organization
+			WHERE id = $1 AND id IN (
+				SELECT org_id FROM organization_member
+				WHERE user_id = $2 AND role = 'admin'
+			)
+			RETURNING id, created, updated, name, description;
+		`, id, auth.ForContext(ctx).UserID)
+		if err := row.Scan(&org.ID, &org.Created, &org.Updated,
+			&org.Name, &org.Description); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No organization by ID %d found for this user", id)
+			}
+			if strings.Contains(err.Error(), "violates foreign key constraint") {
+				return valid.Errorf(ctx, "id",
+					"Organizations which own repositories cannot be deleted")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+func (r *mutationResolver) UpdateOrganizationMember(ctx context.Context, orgID int, entity string, role model.OrganizationRole) (*model.OrganizationMember, error) {
+	if len(entity) == 0 || entity[0] != '~' {
+		return nil, fmt.Errorf("Unknown entity '%s'", entity)
+	}
+	entity = entity[1:]
+
+	if entity == auth.ForContext(ctx).Username {
+		return nil, fmt.Errorf("Cannot edit your own organization role")
+	}
+
+	var member model.OrganizationMember
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			WITH member AS (
+				SELECT u.id uid, org.id oid
+				FROM "user" u, organization org
+				WHERE u.username = $3 AND org.id = $1 AND org.id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $2 AND role = 'admin'
+				)
+			)
+			INSERT INTO organization_member (
+				created, updated, org_id, user_id, role
+			)
+			SELECT
+				NOW() at time zone 'utc', NOW() at time zone 'utc',
+				member.oid, member.uid, $4
+			FROM member
+			ON CONFLICT ON CONSTRAINT uq_organization_member_org_id_user_id
+			DO UPDATE SET role = $4, updated = NOW() at time zone 'utc'
+			RETURNING id, created, role, org_id, user_id;`,
+			orgID, auth.ForContext(ctx).UserID,
+			entity, strings.ToLower(string(role)))
+		if err := row.Scan(&member.ID, &member.Created, &member.RawRole,
+			&member.OrgID, &member.UserID); err != nil {
+			if err == sql.ErrNoRows {
+				// TODO: Fetch user details from meta.sr.ht
+				return fmt.Errorf("No such organization or user found")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *mutationResolver) DeleteOrganizationMember(ctx context.Context, id int) (*model.OrganizationMember, error) {
+	var member model.OrganizationMember
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM organization_member om
+			WHERE om.id = $2 AND (
+				(om.user_id = $1 AND om.role != 'admin') OR
+				(om.user_id != $1 AND om.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $1 AND role = 'admin'
+				))
+			)
+			RETURNING om.id, om.created, om.role, om.org_id, om.user_id;
+		`, auth.ForContext(ctx).UserID, id)
+		if err := row.Scan(&member.ID, &member.Created, &member.RawRole,
+			&member.OrgID, &member.UserID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No such organization member found")
+			}
+			return err
+		}
+
+		// Team memberships grant no access once the user leaves
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM team_member tm
+			USING team
+			WHERE tm.team_id = team.id AND team.org_id = $1 AND tm.user_id = $2;
+		`, member.OrgID, member.UserID)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *mutationResolver) CreateTeam(ctx context.Context, orgID int, name string, description *string) (*model.Team, error) {
+	if !teamNameRE.MatchString(name) {
+		return nil, valid.Errorf(ctx, "name", "Invalid team name '%s' (must match %s)",
+			name, teamNameRE.String())
+	}
+
+	var team model.Team
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO team (created, updated, org_id, name, description)
+			SELECT
+				NOW() at time zone 'utc', NOW() at time zone 'utc',
+				org.id, $3, $4
+			FROM organization org
+			WHERE org.id = $1 AND org.id IN (
+				SELECT org_id FROM organization_member
+				WHERE user_id = $2 AND role = 'admin'
+			)
+			RETURNING id, created, updated, org_id, name, description;
+		`, orgID, auth.ForContext(ctx).UserID, name, description)
+		if err := row.Scan(&team.ID, &team.Created, &team.Updated,
+			&team.OrgID, &team.Name, &team.Description); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No organization by ID %d found for this user", orgID)
+			}
+			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+				return valid.Errorf(ctx, "name", "A team with this name already exists.")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (r *mutationResolver) DeleteTeam(ctx context.Context, id int) (*model.Team, error) {
+	var team model.Team
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM team
+			WHERE id = $1 AND org_id IN (
+				SELECT org_id FROM organization_member
+				WHERE user_id = $2 AND role = 'admin'
+			)
+			RETURNING id, created, updated, org_id, name, description;
+		`, id, auth.ForContext(ctx).UserID)
+		if err := row.Scan(&team.ID, &team.Created, &team.Updated,
+			&team.OrgID, &team.Name, &team.Description); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No team by ID %d found for this user", id)
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (r *mutationResolver) AddTeamMember(ctx context.Context, teamID int, entity string) (*model.TeamMember, error) {
+	if len(entity) == 0 || entity[0] != '~' {
+		return nil, fmt.Errorf("Unknown entity '%s'", entity)
+	}
+	entity = entity[1:]
+
+	var member model.TeamMember
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO team_member (created, team_id, user_id)
+			SELECT NOW() at time zone 'utc', team.id, u.id
+			FROM team, "user" u
+			WHERE team.id = $1 AND u.username = $3 AND team.org_id IN (
+				SELECT org_id FROM organization_member
+				WHERE user_id = $2 AND role = 'admin'
+			) AND u.id IN (
+				SELECT user_id FROM organization_member
+				WHERE org_id = team.org_id
+			)
+			RETURNING id, created, team_id, user_id;
+		`, teamID, auth.ForContext(ctx).UserID, entity)
+		if err := row.Scan(&member.ID, &member.Created,
+			&member.TeamID, &member.UserID); err != nil {
+			if err == sql.ErrNoRows {
+				// TODO: Fetch user details from meta.sr.ht
+				return fmt.Errorf("No such team or organization member found")
+			}
+			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+				return valid.Errorf(ctx, "entity", "~%s is already a member of this team.", entity)
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *mutationResolver) DeleteTeamMember(ctx context.Context, id int) (*model.TeamMember, error) {
+	var member model.TeamMember
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM team_member tm
+			USING team
+			WHERE tm.team_id = team.id AND tm.id = $2 AND (
+				tm.user_id = $1 OR team.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $1 AND role = 'admin'
+				)
+			)
+			RETURNING tm.id, tm.created, tm.team_id, tm.user_id;
+		`, auth.ForContext(ctx).UserID, id)
+		if err := row.Scan(&member.ID, &member.Created,
+			&member.TeamID, &member.UserID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No such team member found")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *mutationResolver) UpdateProtectedRef(ctx context.Context, repoID int, input model.ProtectedRefInput) (*model.ProtectedRef, error) {
+	if !strings.HasPrefix(input.Pattern, "refs/") {
+		return nil, valid.Errorf(ctx, "pattern",
+			"Invalid pattern '%s' (must begin with refs/)", input.Pattern)
+	}
+
+	var names []string
+	for _, entity := range input.AllowedUsers {
+		if len(entity) == 0 || entity[0] != '~' {
+			return nil, valid.Errorf(ctx, "allowedUsers",
+				"Unknown entity '%s'", entity)
+		}
+		names = append(names, entity[1:])
+	}
+	users, errs := loaders.ForContext(ctx).UsersByName.LoadAll(names)
+	userIDs := make([]int, len(users))
+	for i, user := range users {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if user == nil {
+			// TODO: Fetch user details from meta.sr.ht
+			return nil, valid.Errorf(ctx, "allowedUsers",
+				"No such user '~%s' found", names[i])
+		}
+		userIDs[i] = user.ID
+	}
+
+	var pr model.ProtectedRef
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO protected_ref (
+				created, updated, repo_id, pattern,
+				allow_force_push, allow_deletion, allowed_users,
+				require_signatures
+			)
+			SELECT
+				NOW() at time zone 'utc', NOW() at time zone 'utc',
+				repo.id, $3, $4, $5, $6, $7
+			FROM repository repo
+			WHERE repo.id = $1 AND (
+				(repo.org_id IS NULL AND repo.owner_id = $2) OR repo.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $2 AND role = 'admin'
+				)
+			)
+			ON CONFLICT ON CONSTRAINT uq_protected_ref_repo_id_pattern
+			DO UPDATE SET
+				allow_force_push = $4,
+				allow_deletion = $5,
+				allowed_users = $6,
+				require_signatures = $7,
+				updated = NOW() at time zone 'utc'
+			RETURNING
+				id, created, updated, pattern,
+				allow_force_push, allow_deletion, allowed_users,
+				require_signatures, repo_id;`,
+			repoID, auth.ForContext(ctx).UserID, input.Pattern,
+			input.AllowForcePush, input.AllowDeletion, pq.Array(userIDs),
+			input.RequireSignatures)
+		if err := row.Scan(&pr.ID, &pr.Created, &pr.Updated, &pr.Pattern,
+			&pr.AllowForcePush, &pr.AllowDeletion, &pr.AllowedUserIDs,
+			&pr.RequireSignatures, &pr.RepoID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No repository by ID %d found for this user", repoID)
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (r *mutationResolver) DeleteProtectedRef(ctx context.Context, id int) (*model.ProtectedRef, error) {
+	var pr model.ProtectedRef
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM protected_ref
+			USING repository repo
+			WHERE repo_id = repo.id AND protected_ref.id = $2 AND (
+				(repo.org_id IS NULL AND repo.owner_id = $1) OR repo.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $1 AND role = 'admin'
+				)
+			)
+			RETURNING
+				protected_ref.id, protected_ref.created, protected_ref.updated,
+				pattern, allow_force_push, allow_deletion, allowed_users,
+				require_signatures, repo_id;
+		`, auth.ForContext(ctx).UserID, id)
+		if err := row.Scan(&pr.ID, &pr.Created, &pr.Updated, &pr.Pattern,
+			&pr.AllowForcePush, &pr.AllowDeletion, &pr.AllowedUserIDs,
+			&pr.RequireSignatures, &pr.RepoID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No such repository or protected ref found")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &pr, nil
+}
+
+func (r *mutationResolver) UpdatePushPolicy(ctx context.Context, repoID int, input model.PushPolicyInput) (*model.PushPolicy, error) {
+	for _, trailer := range input.RequiredTrailers {
+		if !trailerRE.MatchString(trailer) {
+			return nil, valid.Errorf(ctx, "requiredTrailers",
+				"Invalid trailer '%s'", trailer)
+		}
+	}
+	if input.MessagePattern != nil {
+		if _, err := regexp.Compile(*input.MessagePattern); err != nil {
+			return nil, valid.Errorf(ctx, "messagePattern",
+				"Invalid message pattern: %v", err)
+		}
+	}
+	if input.MaxSubjectLength != nil && *input.MaxSubjectLength <= 0 {
+		return nil, valid.Errorf(ctx, "maxSubjectLength",
+			"Maximum subject length must be positive")
+	}
+	domains := make([]string, len(input.CommitterDomains))
+	for i, domain := range input.CommitterDomains {
+		if domain == "" || strings.ContainsAny(domain, "@ ") {
+			return nil, valid.Errorf(ctx, "committerDomains",
+				"Invalid domain '%s'", domain)
+		}
+		domains[i] = strings.ToLower(domain)
+	}
+	for _, pattern := range input.NoMergeRefs {
+		if !strings.HasPrefix(pattern, "refs/") {
+			return nil, valid.Errorf(ctx, "noMergeRefs",
+				"Invalid pattern '%s' (must begin with refs/)", pattern)
+		}
+	}
+	if input.MaxBlobSizeKiB != nil && *input.MaxBlobSizeKiB <= 0 {
+		return nil, valid.Errorf(ctx, "maxBlobSizeKiB",
+			"Maximum file size must be positive")
+	}
+	var secretScanning *string
+	if input.SecretScanning != nil {
+		mode := strings.ToLower(input.SecretScanning.String())
+		secretScanning = &mode
+	}
+	if input.MaxRepoSizeMiB != nil && *input.MaxRepoSizeMiB <= 0 {
+		return nil, valid.Errorf(ctx, "maxRepoSizeMiB",
+			"Maximum repository size must be positive")
+	}
+	// Sizes are stored in bytes
+	var maxBlobSize, maxRepoSize *int64
+	if input.MaxBlobSizeKiB != nil {
+		size := int64(*input.MaxBlobSizeKiB) << 10
+		maxBlobSize = &size
+	}
+	if input.MaxRepoSizeMiB != nil {
+		size := int64(*input.MaxRepoSizeMiB) << 20
+		maxRepoSize = &size
+	}
+	for _, pattern := range input.ForbiddenPaths {
+		if strings.TrimPrefix(pattern, "/") == "" {
+			return nil, valid.Errorf(ctx, "forbiddenPaths",
+				"Invalid pattern '%s'", pattern)
+		}
+	}
+
+	var pp model.PushPolicy
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO push_policy (
+				created, updated, repo_id, required_trailers,
+				message_pattern, max_subject_length, committer_domains,
+				no_merge_refs, max_blob_size, forbidden_paths, max_repo_size,
+				secret_scanning
+			)
+			SELECT
+				NOW() at time zone 'utc', NOW() at time zone 'utc',
+				repo.id, $3, $4, $5, $6, $7, $8, $9, $10, $11
+			FROM repository repo
+			WHERE repo.id = $1 AND (
+				(repo.org_id IS NULL AND repo.owner_id = $2) OR repo.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $2 AND role = 'admin'
+				)
+			)
+			ON CONFLICT ON CONSTRAINT uq_push_policy_repo_id
+			DO UPDATE SET
+				required_trailers = $3,
+				message_pattern = $4,
+				max_subject_length = $5,
+				committer_domains = $6,
+				no_merge_refs = $7,
+				max_blob_size = $8,
+				forbidden_paths = $9,
+				max_repo_size = $10,
+				secret_scanning = $11,
+				updated = NOW() at time zone 'utc'
+			RETURNING
+				id, created, updated, required_trailers, message_pattern,
+				max_subject_length, committer_domains, no_merge_refs,
+				max_blob_size, forbidden_paths, max_repo_size, secret_scanning,
+				repo_id;`,
+			repoID, auth.ForContext(ctx).UserID,
+			pq.Array(input.RequiredTrailers), input.MessagePattern,
+			input.MaxSubjectLength, pq.Array(domains),
+			pq.Array(input.NoMergeRefs), maxBlobSize,
+			pq.Array(input.ForbiddenPaths), maxRepoSize, secretScanning)
+		if err := row.Scan(&pp.ID, &pp.Created, &pp.Updated,
+			&pp.RawRequiredTrailers, &pp.MessagePattern, &pp.MaxSubjectLength,
+			&pp.RawCommitterDomains, &pp.RawNoMergeRefs, &pp.RawMaxBlobSize,
+			&pp.RawForbiddenPaths, &pp.RawMaxRepoSize, &pp.RawSecretScanning,
+			&pp.RepoID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No repository by ID %d found for this user", repoID)
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &pp, nil
+}
+
+func (r *mutationResolver) AddPushMirror(ctx context.Context, repoID int, url string, username *string, password *string) (*model.PushMirror, error) {
+	if err := validatePushMirrorURL(ctx, url); err != nil {
+		return nil, err
+	}
+
+	var encryptedPassword []byte
+	if password != nil {
+		encryptedPassword = crypto.Encrypt([]byte(*password))
+	}
+
+	var pm model.PushMirror
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO push_mirror (
+				created, updated, repo_id, url, username, encrypted_password
+			)
+			SELECT
+				NOW() at time zone 'utc', NOW() at time zone 'utc',
+				repo.id, $3, $4, $5
+			FROM repository repo
+			WHERE repo.id = $1 AND (
+				(repo.org_id IS NULL AND repo.owner_id = $2) OR repo.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $2 AND role = 'admin'
+				)
+			)
+			RETURNING id, created, updated, url, username, repo_id;`,
+			repoID, auth.ForContext(ctx).UserID, url, username,
+			encryptedPassword)
+		if err := row.Scan(&pm.ID, &pm.Created, &pm.Updated, &pm.URL,
+			&pm.Username, &pm.RepoID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No repository by ID %d found for this user", repoID)
+			}
+			if strings.Contains(err.Error(), "duplicate key value violates unique constraint") {
+				return valid.Errorf(ctx, "url", "This repository already has a push mirror with this URL")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &pm, nil
+}
+
+func (r *mutationResolver) DeletePushMirror(ctx context.Context, id int) (*model.PushMirror, error) {
+	var pm model.PushMirror
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM push_mirror
+			USING repository repo
+			WHERE repo_id = repo.id AND push_mirror.id = $2 AND (
+				(repo.org_id IS NULL AND repo.owner_id = $1) OR repo.org_id IN (
+					SELECT org_id FROM organization_member
+					WHERE user_id = $1 AND role = 'admin'
+				)
+			)
+			RETURNING
+				push_mirror.id, push_mirror.created, push_mirror.updated,
+				url, username, repo_id;
+		`, auth.ForContext(ctx).UserID, id)
+		if err := row.Scan(&pm.ID, &pm.Created, &pm.Updated, &pm.URL,
+			&pm.Username, &pm.RepoID); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No such repository or push mirror found")
+			}
+			return err
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &pm, nil
+}
+
+func (r *mutationResolver) UploadArtifact(ctx context.Context, repoID int, revspec string, file graphql.Upload) (*model.Artifact, error) {
+	conf := config.ForContext(ctx)
+	upstream, _ := conf.Get("objects", "s3-upstream")
+	accessKey, _ := conf.Get("objects", "s3-access-key")
+	secretKey, _ := conf.Get("objects", "s3-secret-key")
+	bucket, _ := conf.Get("git.sr.ht", "s3-bucket")
+	prefix, _ := conf.Get("git.sr.ht", "s3-prefix")
+	if upstream == "" || accessKey == "" || secretKey == "" || bucket == "" {
+		return nil, fmt.Errorf("Object storage is not enabled for this server")
+	}
+
+	mc, err := minio.New(upstream, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: true,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	repo, err := loaders.ForContext(ctx).RepositoriesByID.Load(repoID)
+	if err != nil || repo == nil {
+		return nil, fmt.Errorf("Repository %d not found", repoID)
+	}
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		r := (&model.Repository{}).As(`repo`)
+		var ok bool
+		return database.
+			Select(ctx, `true`).
+			From(`repository repo`).
+			Where(`repo.id = ?`, repoID).
+			Where(r.ManageableBy(auth.ForContext(ctx).UserID)).
+			RunWith(tx).
+			QueryRowContext(ctx).
+			Scan(&ok)
+	}); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Access denied for repo %d", repoID)
+	} else if err != nil {
+		return nil, err
+	}
+	ownerName, err := repoOwnerName(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	hash, err := gitRepo.ResolveRevision(plumbing.Revision(revspec))
+	gitRepo.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s3path := path.Join(prefix, "artifacts",
+		"~"+ownerName, repo.Name, file.Filename)
+
+	err = mc.MakeBucket(ctx, bucket, minio.MakeBucketOptions{})
+	if s3err, ok := err.(minio.ErrorResponse); !ok ||
+		(s3err.Code != "BucketAlreadyExists" && s3err.Code != "BucketAlreadyOwnedByYou") {
+		panic(err)
+	}
+
+	core := minio.Core{mc}
+	uid, err := core.NewMultipartUpload(ctx, bucket,
+		s3path, minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			core.AbortMultipartUpload(context.Background(), bucket, s3path, uid)
+			panic(err)
+		}
+	}()
+
+	var artifact model.Artifact
 	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
 		// To guarantee atomicity, we do the following:
 		// 1. Upload all parts as an S3 multipart upload, but don't complete
@@ -675,86 +1576,309 @@ func (r *mutationResolver) UploadArtifact(ctx context.Context, repoID int, revsp
 			})
 			partNum++
 		}
-
-		checksum := "sha256:" + hex.EncodeToString(sha.Sum(nil))
-		row := tx.QueryRowContext(ctx, `
-			INSERT INTO artifacts (
-				created, user_id, repo_id, commit, filename, checksum, size
-			) VALUES (
-				NOW() at time zone 'utc',
-				$1, $2, $3, $4, $5, $6
-			) RETURNING id, created, filename, checksum, size, commit`,
-			repo.OwnerID, repo.ID, hash.String(), file.Filename,
-			checksum, file.Size)
-		if err := row.Scan(&artifact.ID, &artifact.Created, &artifact.Filename,
-			&artifact.Checksum, &artifact.Size, &artifact.Commit); err != nil {
-			if err.Error() == "pq: duplicate key value violates unique constraint \"repo_artifact_filename_unique\"" {
-				return fmt.Errorf("An artifact by this name already exists for this repository (artifact names must be unique for within each repository)")
-			}
-			return err
+
+		checksum := "sha256:" + hex.EncodeToString(sha.Sum(nil))
+		row := tx.QueryRowContext(ctx, `
+			INSERT INTO artifacts (
+				created, user_id, repo_id, commit, filename, checksum, size
+			) VALUES (
+				NOW() at time zone 'utc',
+				$1, $2, $3, $4, $5, $6
+			) RETURNING id, created, filename, checksum, size, commit`,
+			repo.OwnerID, repo.ID, hash.String(), file.Filename,
+			checksum, file.Size)
+		if err := row.Scan(&artifact.ID, &artifact.Created, &artifact.Filename,
+			&artifact.Checksum, &artifact.Size, &artifact.Commit); err != nil {
+			if err.Error() == "pq: duplicate key value violates unique constraint \"repo_artifact_filename_unique\"" {
+				return fmt.Errorf("An artifact by this name already exists for this repository (artifact names must be unique for within each repository)")
+			}
+			return err
+		}
+
+		_, err := core.CompleteMultipartUpload(ctx, bucket, s3path, uid, parts)
+		return err
+	}); err != nil {
+		if err != nil {
+			core.AbortMultipartUpload(context.Background(), bucket, s3path, uid)
+		}
+		return nil, err
+	}
+
+	return &artifact, nil
+}
+
+func (r *mutationResolver) DeleteArtifact(ctx context.Context, id int) (*model.Artifact, error) {
+	conf := config.ForContext(ctx)
+	upstream, _ := conf.Get("objects", "s3-upstream")
+	accessKey, _ := conf.Get("objects", "s3-access-key")
+	secretKey, _ := conf.Get("objects", "s3-secret-key")
+	bucket, _ := conf.Get("git.sr.ht", "s3-bucket")
+	prefix, _ := conf.Get("git.sr.ht", "s3-prefix")
+	if upstream == "" || accessKey == "" || secretKey == "" || bucket == "" {
+		return nil, fmt.Errorf("Object storage is not enabled for this server")
+	}
+
+	mc, err := minio.New(upstream, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: true,
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	var artifact model.Artifact
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		var repoName, ownerName string
+		row := tx.QueryRowContext(ctx, `
+			DELETE FROM artifacts
+			USING repository repo
+			WHERE
+				repo_id = repo.id AND (
+					(repo.org_id IS NULL AND repo.owner_id = $1) OR
+					repo.org_id IN (
+						SELECT org_id FROM organization_member
+						WHERE user_id = $1 AND role = 'admin'
+					)
+				) AND
+				artifacts.id = $2
+			RETURNING
+				artifacts.id, artifacts.created, filename, checksum,
+				size, commit, repo.name, COALESCE(
+					(SELECT name FROM organization WHERE id = repo.org_id),
+					(SELECT username FROM "user" WHERE id = repo.owner_id)
+				);`,
+			auth.ForContext(ctx).UserID, id)
+		if err := row.Scan(&artifact.ID, &artifact.Created, &artifact.Filename,
+			&artifact.Checksum, &artifact.Size, &artifact.Commit,
+			&repoName, &ownerName); err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("No such artifact for this user")
+			}
+			return err
+		}
+
+		s3path := path.Join(prefix, "artifacts",
+			"~"+ownerName, repoName, artifact.Filename)
+		return mc.RemoveObject(ctx, bucket, s3path, minio.RemoveObjectOptions{})
+	}); err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+func (r *mutationResolver) CreateBlob(ctx context.Context, repoID int, text *string, base64 *string) (model.Blob, error) {
+	if (text == nil) == (base64 == nil) {
+		return nil, valid.Errorf(ctx, "text", "Exactly one of text or base64 must be specified")
+	}
+	repo, _, err := loadWritableRepo(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := model.WriteBlob(repo.Repo(), text, base64)
+	if err != nil {
+		return nil, err
+	}
+	return blob.(model.Blob), nil
+}
+
+func (r *mutationResolver) CreateTree(ctx context.Context, repoID int, base *string, entries []*model.TreeEntryInput) (*model.Tree, error) {
+	repo, _, err := loadWritableRepo(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	var baseTree string
+	if base != nil {
+		baseTree = *base
+	}
+	return model.WriteTree(repo.Repo(), baseTree, entries)
+}
+
+func (r *mutationResolver) CreateCommit(ctx context.Context, repoID int, input model.CommitInput) (*model.Commit, error) {
+	repo, _, err := loadWritableRepo(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Author == nil {
+		user := auth.ForContext(ctx)
+		input.Author = &model.SignatureInput{
+			Name:  user.Username,
+			Email: user.Email,
+		}
+	}
+	return model.WriteCommit(repo.Repo(), &input)
+}
+
+func (r *mutationResolver) UpdateReference(ctx context.Context, repoID int, name string, old *string, new *string) (*model.Reference, error) {
+	if err := repos.CheckRefFormat(name); err != nil {
+		return nil, valid.Errorf(ctx, "name",
+			"Invalid reference name '%s' (%v)", name, err)
+	}
+	var oldID, newID string
+	if old != nil {
+		if _, err := model.ParseHash(*old); err != nil {
+			return nil, valid.Errorf(ctx, "old", "%v", err)
+		}
+		oldID = *old
+	}
+	if new != nil {
+		if _, err := model.ParseHash(*new); err != nil {
+			return nil, valid.Errorf(ctx, "new", "%v", err)
+		}
+		newID = *new
+	}
+	if oldID == "" && newID == "" {
+		return nil, valid.Errorf(ctx, "new", "The old and new IDs must not both be null")
+	}
+
+	repo, pctx, err := loadWritableRepo(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	if newID != "" {
+		if _, err := model.LookupObject(repo.Repo(), plumbing.NewHash(newID)); err != nil {
+			return nil, valid.Errorf(ctx, "new", "No object %s found", newID)
+		}
+	}
+	if err := repos.UpdateRef(ctx, pctx, name, oldID, newID); err != nil {
+		return nil, err
+	}
+	if newID == "" {
+		return nil, nil
+	}
+
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	ref, err := gitRepo.Reference(plumbing.ReferenceName(name), false)
+	gitRepo.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return &model.Reference{Repo: repo, Ref: ref}, nil
+}
+
+func (r *mutationResolver) CommitFiles(ctx context.Context, repoID int, branch string, expectedHead string, message string, changes []*model.FileChange, author *model.SignatureInput) (*model.Commit, error) {
+	if strings.HasPrefix(branch, "refs/") {
+		return nil, valid.Errorf(ctx, "branch",
+			"Invalid branch name '%s' (must not begin with refs/)", branch)
+	}
+	parent, err := model.ParseHash(expectedHead)
+	if err != nil {
+		return nil, valid.Errorf(ctx, "expectedHead", "%v", err)
+	}
+	if len(changes) == 0 {
+		return nil, valid.Errorf(ctx, "changes", "At least one change is required")
+	}
+	for _, change := range changes {
+		n := 0
+		if change.Content != nil {
+			n++
+		}
+		if change.Base64 != nil {
+			n++
+		}
+		if change.Delete != nil && *change.Delete {
+			n++
+		}
+		if n != 1 {
+			return nil, valid.Errorf(ctx, "changes",
+				"Exactly one of content, base64 or delete must be specified for '%s'",
+				change.Path)
 		}
+	}
 
-		_, err := core.CompleteMultipartUpload(ctx, bucket, s3path, uid, parts)
-		return err
-	}); err != nil {
-		if err != nil {
-			core.AbortMultipartUpload(context.Background(), bucket, s3path, uid)
+	repo, pctx, err := loadWritableRepo(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	if author == nil {
+		user := auth.ForContext(ctx)
+		author = &model.SignatureInput{
+			Name:  user.Username,
+			Email: user.Email,
 		}
+	}
+	commit, err := model.WriteFileChanges(repo.Repo(), parent, message, author, changes)
+	if err != nil {
 		return nil, err
 	}
+	if err := repos.UpdateRef(ctx, pctx, string(plumbing.NewBranchReferenceName(branch)),
+		expectedHead, commit.ID); err != nil {
+		return nil, err
+	}
+	return commit, nil
+}
 
-	return &artifact, nil
+func (r *mutationResolver) CreateBranch(ctx context.Context, repoID int, name string, revspec string) (*model.Reference, error) {
+	if name == "" || strings.HasPrefix(name, "refs/") {
+		return nil, valid.Errorf(ctx, "name",
+			"Invalid branch name '%s' (must not begin with refs/)", name)
+	}
+	refName := plumbing.NewBranchReferenceName(name)
+	if err := repos.CheckRefFormat(refName.String()); err != nil {
+		return nil, valid.Errorf(ctx, "name",
+			"Invalid branch name '%s' (%v)", name, err)
+	}
+
+	repo, pctx, err := loadWritableRepo(ctx, repoID)
+	if err != nil {
+		return nil, err
+	}
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	commit, err := gitRepo.ResolveCommit(revspec)
+	gitRepo.Unlock()
+	if err != nil {
+		return nil, valid.Errorf(ctx, "revspec", "No commit found for '%s'", revspec)
+	}
+	return createRef(ctx, repo, pctx, refName, commit.Hash)
 }
 
-func (r *mutationResolver) DeleteArtifact(ctx context.Context, id int) (*model.Artifact, error) {
-	conf := config.ForContext(ctx)
-	upstream, _ := conf.Get("objects", "s3-upstream")
-	accessKey, _ := conf.Get("objects", "s3-access-key")
-	secretKey, _ := conf.Get("objects", "s3-secret-key")
-	bucket, _ := conf.Get("git.sr.ht", "s3-bucket")
-	prefix, _ := conf.Get("git.sr.ht", "s3-prefix")
-	if upstream == "" || accessKey == "" || secretKey == "" || bucket == "" {
-		return nil, fmt.Errorf("Object storage is not enabled for this server")
+func (r *mutationResolver) DeleteBranch(ctx context.Context, repoID int, name string) (*model.Reference, error) {
+	return deleteRef(ctx, repoID, plumbing.NewBranchReferenceName(name))
+}
+
+func (r *mutationResolver) CreateTag(ctx context.Context, repoID int, name string, revspec string, message *string, tagger *model.SignatureInput) (*model.Reference, error) {
+	if name == "" || strings.HasPrefix(name, "refs/") {
+		return nil, valid.Errorf(ctx, "name",
+			"Invalid tag name '%s' (must not begin with refs/)", name)
+	}
+	refName := plumbing.NewTagReferenceName(name)
+	if err := repos.CheckRefFormat(refName.String()); err != nil {
+		return nil, valid.Errorf(ctx, "name",
+			"Invalid tag name '%s' (%v)", name, err)
 	}
 
-	mc, err := minio.New(upstream, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: true,
-	})
+	repo, pctx, err := loadWritableRepo(ctx, repoID)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	gitRepo := repo.Repo()
+	gitRepo.Lock()
+	commit, err := gitRepo.ResolveCommit(revspec)
+	gitRepo.Unlock()
+	if err != nil {
+		return nil, valid.Errorf(ctx, "revspec", "No commit found for '%s'", revspec)
 	}
 
-	var artifact model.Artifact
-	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
-		var repoName string
-		row := tx.QueryRowContext(ctx, `
-			DELETE FROM artifacts
-			USING repository repo
-			WHERE
-				repo_id = repo.id AND
-				repo.owner_id = $1 AND
-				artifacts.id = $2
-			RETURNING
-				artifacts.id, artifacts.created, filename, checksum,
-				size, commit, repo.name;`,
-			auth.ForContext(ctx).UserID, id)
-		if err := row.Scan(&artifact.ID, &artifact.Created, &artifact.Filename,
-			&artifact.Checksum, &artifact.Size, &artifact.Commit,
-			&repoName); err != nil {
-			if err == sql.ErrNoRows {
-				return fmt.Errorf("No such artifact for this user")
+	target := commit.Hash
+	if message != nil {
+		if tagger == nil {
+			user := auth.ForContext(ctx)
+			tagger = &model.SignatureInput{
+				Name:  user.Username,
+				Email: user.Email,
 			}
-			return err
 		}
-
-		s3path := path.Join(prefix, "artifacts",
-			"~"+auth.ForContext(ctx).Username, repoName, artifact.Filename)
-		return mc.RemoveObject(ctx, bucket, s3path, minio.RemoveObjectOptions{})
-	}); err != nil {
-		return nil, err
+		if target, err = model.WriteTag(gitRepo, name, commit.Hash,
+			*message, tagger); err != nil {
+			return nil, err
+		}
 	}
-	return &artifact, nil
+	return createRef(ctx, repo, pctx, refName, target)
+}
+
+func (r *mutationResolver) DeleteTag(ctx context.Context, repoID int, name string) (*model.Reference, error) {
+	return deleteRef(ctx, repoID, plumbing.NewTagReferenceName(name))
 }
 
 func (r *mutationResolver) CreateWebhook(ctx context.Context, config model.UserWebhookInput) (model.WebhookSubscription, error) {
@@ -859,6 +1983,212 @@ func (r *mutationResolver) DeleteWebhook(ctx context.Context, id int) (model.Web
 	return &sub, nil
 }
 
+func (r *objectSignatureResolver) Signer(ctx context.Context, obj *model.ObjectSignature) (*model.User, error) {
+	username, err := obj.SignerUsername(ctx)
+	if err != nil || username == nil {
+		return nil, err
+	}
+	return loaders.ForContext(ctx).UsersByName.Load(*username)
+}
+
+func (r *organizationResolver) Members(ctx context.Context, obj *model.Organization, cursor *coremodel.Cursor) (*model.OrganizationMemberCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var members []*model.OrganizationMember
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		om := (&model.OrganizationMember{}).As(`om`)
+		query := database.
+			Select(ctx, om).
+			From(`organization_member om`).
+			Where(`om.org_id = ?`, obj.ID).
+			Where(`EXISTS (
+				SELECT 1 FROM organization_member viewer
+				WHERE viewer.org_id = om.org_id AND viewer.user_id = ?
+			)`, auth.ForContext(ctx).UserID)
+		members, cursor = om.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.OrganizationMemberCursor{members, cursor}, nil
+}
+
+func (r *organizationResolver) Team(ctx context.Context, obj *model.Organization, name string) (*model.Team, error) {
+	var team model.Team
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		row := database.
+			Select(ctx, &team).
+			From(`team`).
+			Where(`team.org_id = ?`, obj.ID).
+			Where(`team.name = ?`, name).
+			RunWith(tx).
+			QueryRowContext(ctx)
+		if err := row.Scan(database.Scan(ctx, &team)...); err != nil {
+			return err
+		}
+		return nil
+	}); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &team, nil
+}
+
+func (r *organizationResolver) Teams(ctx context.Context, obj *model.Organization, cursor *coremodel.Cursor) (*model.TeamCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var teams []*model.Team
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		team := (&model.Team{}).As(`team`)
+		query := database.
+			Select(ctx, team).
+			From(`team`).
+			Where(`team.org_id = ?`, obj.ID)
+		teams, cursor = team.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.TeamCursor{teams, cursor}, nil
+}
+
+func (r *organizationResolver) Repository(ctx context.Context, obj *model.Organization, name string) (*model.Repository, error) {
+	return loaders.ForContext(ctx).RepositoriesByOwnerRepoName.Load(loaders.OwnerRepoName{obj.Name, name})
+}
+
+func (r *organizationResolver) Repositories(ctx context.Context, obj *model.Organization, cursor *coremodel.Cursor, filter *coremodel.Filter) (*model.RepositoryCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(filter)
+	}
+
+	var repos []*model.Repository
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, repo).
+			From(`repository repo`).
+			Where(sq.And{
+				sq.Or{
+					repo.AccessibleBy(auth.ForContext(ctx).UserID),
+					sq.Expr(`repo.visibility = 'public'`),
+				},
+				sq.Expr(`repo.org_id = ?`, obj.ID),
+			})
+		repos, cursor = repo.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return &model.RepositoryCursor{repos, cursor}, nil
+}
+
+func (r *organizationMemberResolver) Organization(ctx context.Context, obj *model.OrganizationMember) (*model.Organization, error) {
+	return loaders.ForContext(ctx).OrganizationsByID.Load(obj.OrgID)
+}
+
+func (r *organizationMemberResolver) User(ctx context.Context, obj *model.OrganizationMember) (*model.User, error) {
+	return loaders.ForContext(ctx).UsersByID.Load(obj.UserID)
+}
+
+func (r *protectedRefResolver) Repository(ctx context.Context, obj *model.ProtectedRef) (*model.Repository, error) {
+	return loaders.ForContext(ctx).RepositoriesByID.Load(obj.RepoID)
+}
+
+func (r *protectedRefResolver) AllowedUsers(ctx context.Context, obj *model.ProtectedRef) ([]*model.User, error) {
+	ids := make([]int, len(obj.AllowedUserIDs))
+	for i, id := range obj.AllowedUserIDs {
+		ids[i] = int(id)
+	}
+	users, errs := loaders.ForContext(ctx).UsersByID.LoadAll(ids)
+	var results []*model.User
+	for i, user := range users {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if user != nil {
+			results = append(results, user)
+		}
+	}
+	return results, nil
+}
+
+func (r *pushMirrorResolver) Repository(ctx context.Context, obj *model.PushMirror) (*model.Repository, error) {
+	return loaders.ForContext(ctx).RepositoriesByID.Load(obj.RepoID)
+}
+
+func (r *pushMirrorResolver) Attempts(ctx context.Context, obj *model.PushMirror, cursor *coremodel.Cursor) (*model.PushMirrorAttemptCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var attempts []*model.PushMirrorAttempt
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		pma := (&model.PushMirrorAttempt{}).As(`pma`)
+		query := database.
+			Select(ctx, pma).
+			From(`push_mirror_attempt pma`).
+			Where(`pma.push_mirror_id = ?`, obj.ID)
+		attempts, cursor = pma.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.PushMirrorAttemptCursor{attempts, cursor}, nil
+}
+
+func (r *pushMirrorAttemptResolver) Mirror(ctx context.Context, obj *model.PushMirrorAttempt) (*model.PushMirror, error) {
+	var pm *model.PushMirror
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		pm = (&model.PushMirror{}).As(`pm`)
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, pm).
+			From(`push_mirror pm`).
+			Join(`repository repo ON pm.repo_id = repo.id`).
+			Where(`pm.id = ?`, obj.PushMirrorID).
+			Where(repo.ManageableBy(auth.ForContext(ctx).UserID))
+		row := query.RunWith(tx).QueryRowContext(ctx)
+		return row.Scan(database.Scan(ctx, pm)...)
+	}); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return pm, nil
+}
+
+func (r *pushPolicyResolver) Repository(ctx context.Context, obj *model.PushPolicy) (*model.Repository, error) {
+	return loaders.ForContext(ctx).RepositoriesByID.Load(obj.RepoID)
+}
+
 func (r *queryResolver) Version(ctx context.Context) (*model.Version, error) {
 	conf := config.ForContext(ctx)
 	upstream, _ := conf.Get("objects", "s3-upstream")
@@ -900,32 +2230,62 @@ func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
 	}, nil
 }
 
-func (r *queryResolver) User(ctx context.Context, username string) (*model.User, error) {
-	return loaders.ForContext(ctx).UsersByName.Load(username)
+func (r *queryResolver) User(ctx context.Context, username string) (*model.User, error) {
+	return loaders.ForContext(ctx).UsersByName.Load(username)
+}
+
+func (r *queryResolver) Repositories(ctx context.Context, cursor *coremodel.Cursor, filter *coremodel.Filter) (*model.RepositoryCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(filter)
+	}
+
+	var repos []*model.Repository
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, repo).
+			From(`repository repo`).
+			Where(`repo.owner_id = ?`, auth.ForContext(ctx).UserID).
+			Where(`repo.org_id IS NULL`)
+		repos, cursor = repo.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.RepositoryCursor{repos, cursor}, nil
+}
+
+func (r *queryResolver) Organization(ctx context.Context, name string) (*model.Organization, error) {
+	return loaders.ForContext(ctx).OrganizationsByName.Load(name)
 }
 
-func (r *queryResolver) Repositories(ctx context.Context, cursor *coremodel.Cursor, filter *coremodel.Filter) (*model.RepositoryCursor, error) {
+func (r *queryResolver) Organizations(ctx context.Context, cursor *coremodel.Cursor) (*model.OrganizationCursor, error) {
 	if cursor == nil {
-		cursor = coremodel.NewCursor(filter)
+		cursor = coremodel.NewCursor(nil)
 	}
 
-	var repos []*model.Repository
+	var orgs []*model.Organization
 	if err := database.WithTx(ctx, &sql.TxOptions{
 		Isolation: 0,
 		ReadOnly:  true,
 	}, func(tx *sql.Tx) error {
-		repo := (&model.Repository{}).As(`repo`)
+		org := (&model.Organization{}).As(`org`)
 		query := database.
-			Select(ctx, repo).
-			From(`repository repo`).
-			Where(`repo.owner_id = ?`, auth.ForContext(ctx).UserID)
-		repos, cursor = repo.QueryWithCursor(ctx, tx, query, cursor)
+			Select(ctx, org).
+			From(`organization org`).
+			Join(`organization_member om ON om.org_id = org.id`).
+			Where(`om.user_id = ?`, auth.ForContext(ctx).UserID)
+		orgs, cursor = org.QueryWithCursor(ctx, tx, query, cursor)
 		return nil
 	}); err != nil {
 		return nil, err
 	}
 
-	return &model.RepositoryCursor{repos, cursor}, nil
+	return &model.OrganizationCursor{orgs, cursor}, nil
 }
 
 func (r *queryResolver) UserWebhooks(ctx context.Context, cursor *coremodel.Cursor) (*model.WebhookSubscriptionCursor, error) {
@@ -1046,6 +2406,9 @@ func (r *referenceResolver) Artifacts(ctx context.Context, obj *model.Reference,
 }
 
 func (r *repositoryResolver) Owner(ctx context.Context, obj *model.Repository) (model.Entity, error) {
+	if obj.OrgID != nil {
+		return loaders.ForContext(ctx).OrganizationsByID.Load(*obj.OrgID)
+	}
 	return loaders.ForContext(ctx).UsersByID.Load(obj.OwnerID)
 }
 
@@ -1060,12 +2423,13 @@ func (r *repositoryResolver) AccessControlList(ctx context.Context, obj *model.R
 		ReadOnly:  true,
 	}, func(tx *sql.Tx) error {
 		acl := (&model.ACL{}).As(`acl`)
+		repo := (&model.Repository{}).As(`repo`)
 		query := database.
 			Select(ctx, acl).
 			From(`access acl`).
 			Join(`repository repo ON acl.repo_id = repo.id`).
 			Where(`acl.repo_id = ?`, obj.ID).
-			Where(`repo.owner_id = ?`, auth.ForContext(ctx).UserID)
+			Where(repo.ManageableBy(auth.ForContext(ctx).UserID))
 		acls, cursor = acl.QueryWithCursor(ctx, tx, query, cursor)
 		return nil
 	}); err != nil {
@@ -1075,6 +2439,174 @@ func (r *repositoryResolver) AccessControlList(ctx context.Context, obj *model.R
 	return &model.ACLCursor{acls, cursor}, nil
 }
 
+func (r *repositoryResolver) TeamAccessControlList(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor) (*model.TeamACLCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var acls []*model.TeamACL
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		acl := (&model.TeamACL{}).As(`acl`)
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, acl).
+			From(`team_access acl`).
+			Join(`repository repo ON acl.repo_id = repo.id`).
+			Where(`acl.repo_id = ?`, obj.ID).
+			Where(repo.ManageableBy(auth.ForContext(ctx).UserID))
+		acls, cursor = acl.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.TeamACLCursor{acls, cursor}, nil
+}
+
+func (r *repositoryResolver) ProtectedRefs(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor) (*model.ProtectedRefCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var refs []*model.ProtectedRef
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		pr := (&model.ProtectedRef{}).As(`pr`)
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, pr).
+			From(`protected_ref pr`).
+			Join(`repository repo ON pr.repo_id = repo.id`).
+			Where(`pr.repo_id = ?`, obj.ID).
+			Where(repo.ManageableBy(auth.ForContext(ctx).UserID))
+		refs, cursor = pr.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.ProtectedRefCursor{refs, cursor}, nil
+}
+
+func (r *repositoryResolver) PushPolicy(ctx context.Context, obj *model.Repository) (*model.PushPolicy, error) {
+	var pp *model.PushPolicy
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		pp = (&model.PushPolicy{}).As(`pp`)
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, pp).
+			From(`push_policy pp`).
+			Join(`repository repo ON pp.repo_id = repo.id`).
+			Where(`pp.repo_id = ?`, obj.ID).
+			Where(repo.WritableBy(auth.ForContext(ctx).UserID))
+		row := query.RunWith(tx).QueryRowContext(ctx)
+		return row.Scan(database.Scan(ctx, pp)...)
+	}); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return pp, nil
+}
+
+func (r *repositoryResolver) SecretFindings(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor) (*model.SecretFindingCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var findings []*model.SecretFinding
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		sf := (&model.SecretFinding{}).As(`sf`)
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, sf).
+			From(`secret_finding sf`).
+			Join(`repository repo ON sf.repo_id = repo.id`).
+			Where(`sf.repo_id = ?`, obj.ID).
+			Where(repo.ManageableBy(auth.ForContext(ctx).UserID))
+		findings, cursor = sf.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.SecretFindingCursor{findings, cursor}, nil
+}
+
+func (r *repositoryResolver) PushMirrors(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor) (*model.PushMirrorCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var mirrors []*model.PushMirror
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		pm := (&model.PushMirror{}).As(`pm`)
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, pm).
+			From(`push_mirror pm`).
+			Join(`repository repo ON pm.repo_id = repo.id`).
+			Where(`pm.repo_id = ?`, obj.ID).
+			Where(repo.ManageableBy(auth.ForContext(ctx).UserID))
+		mirrors, cursor = pm.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.PushMirrorCursor{mirrors, cursor}, nil
+}
+
+func (r *repositoryResolver) ForkedFrom(ctx context.Context, obj *model.Repository) (*model.Repository, error) {
+	if obj.ForkedFromID == nil {
+		return nil, nil
+	}
+	return loaders.ForContext(ctx).RepositoriesByID.Load(*obj.ForkedFromID)
+}
+
+func (r *repositoryResolver) Forks(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor) (*model.RepositoryCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var repos []*model.Repository
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		repo := (&model.Repository{}).As(`repo`)
+		query := database.
+			Select(ctx, repo).
+			From(`repository repo`).
+			Where(`repo.forked_from = ?`, obj.ID).
+			Where(sq.Or{
+				repo.AccessibleBy(auth.ForContext(ctx).UserID),
+				sq.Expr(`repo.visibility = 'public'`),
+			})
+		repos, cursor = repo.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.RepositoryCursor{repos, cursor}, nil
+}
+
 func (r *repositoryResolver) Objects(ctx context.Context, obj *model.Repository, ids []string) ([]model.Object, error) {
 	var objects []model.Object
 	for _, id := range ids {
@@ -1137,56 +2669,65 @@ func (r *repositoryResolver) References(ctx context.Context, obj *model.Reposito
 	return &model.ReferenceCursor{refs, cursor}, nil
 }
 
-func (r *repositoryResolver) Log(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor, from *string) (*model.CommitCursor, error) {
+func (r *repositoryResolver) Branches(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor, prefix *string, orderBy *model.ReferenceOrder) (*model.BranchCursor, error) {
 	if cursor == nil {
 		cursor = coremodel.NewCursor(nil)
-		if from != nil {
-			cursor.Next = *from
-		}
+	}
+	var pfx string
+	if prefix != nil {
+		pfx = *prefix
+	}
+	order := model.ReferenceOrderName
+	if orderBy != nil {
+		order = *orderBy
 	}
 
-	repo := obj.Repo()
-	opts := &git.LogOptions{
-		Order: git.LogOrderCommitterTime,
+	branches, cursor, err := model.BranchesWithCursor(ctx, obj, cursor, pfx, order)
+	if err != nil {
+		return nil, err
 	}
-	if cursor.Next != "" {
-		repo.Lock()
-		rev, err := repo.ResolveRevision(plumbing.Revision(cursor.Next))
-		repo.Unlock()
-		if err != nil {
-			return nil, err
-		}
-		if rev == nil {
-			return nil, fmt.Errorf("No such revision")
-		}
-		opts.From = *rev
+	return &model.BranchCursor{branches, cursor}, nil
+}
+
+func (r *repositoryResolver) Tags(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor, prefix *string, orderBy *model.ReferenceOrder) (*model.TagReferenceCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+	var pfx string
+	if prefix != nil {
+		pfx = *prefix
+	}
+	order := model.ReferenceOrderName
+	if orderBy != nil {
+		order = *orderBy
 	}
 
-	repo.Lock()
-	log, err := repo.Log(opts)
-	repo.Unlock()
+	tags, cursor, err := model.TagsWithCursor(ctx, obj, cursor, pfx, order)
 	if err != nil {
 		return nil, err
 	}
+	return &model.TagReferenceCursor{tags, cursor}, nil
+}
 
-	var commits []*model.Commit
-	log.ForEach(func(c *object.Commit) error {
-		commits = append(commits, model.CommitFromObject(repo, c))
-		if len(commits) == cursor.Count+1 {
-			return storer.ErrStop
+func (r *repositoryResolver) Log(ctx context.Context, obj *model.Repository, cursor *coremodel.Cursor, from *string, path *string, follow *bool, filter *coremodel.Filter) (*model.CommitCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(filter)
+		if filter != nil && filter.Search != nil {
+			cursor.Search = *filter.Search
 		}
-		return nil
-	})
+	}
 
-	if len(commits) > cursor.Count {
-		cursor = &coremodel.Cursor{
-			Count:  cursor.Count,
-			Next:   commits[cursor.Count].ID,
-			Search: "",
-		}
-		commits = commits[:cursor.Count]
-	} else {
-		cursor = nil
+	var fromRev, pathName string
+	if from != nil {
+		fromRev = *from
+	}
+	if path != nil {
+		pathName = *path
+	}
+	commits, cursor, err := model.LogWithCursor(ctx, obj.Repo(), cursor,
+		fromRev, pathName, follow != nil && *follow)
+	if err != nil {
+		return nil, err
 	}
 
 	return &model.CommitCursor{commits, cursor}, nil
@@ -1246,24 +2787,148 @@ func (r *repositoryResolver) RevparseSingle(ctx context.Context, obj *model.Repo
 	return commit, nil
 }
 
-func (r *treeResolver) Entries(ctx context.Context, obj *model.Tree, cursor *coremodel.Cursor) (*model.TreeEntryCursor, error) {
+func (r *repositoryResolver) Blame(ctx context.Context, obj *model.Repository, revspec *string, path string, start *int, lines *int) (*model.Blame, error) {
+	rev := "HEAD"
+	if revspec != nil {
+		rev = *revspec
+	}
+	first, count := 1, 100
+	if start != nil {
+		first = *start
+	}
+	if lines != nil {
+		count = *lines
+	}
+	if first < 1 {
+		return nil, valid.Errorf(ctx, "start", "Start must be at least 1")
+	}
+	if count < 1 || count > 1000 {
+		return nil, valid.Errorf(ctx, "lines", "Lines must be between 1 and 1000")
+	}
+	return model.BlameContext(ctx, obj, rev, path, first, count)
+}
+
+func (r *repositoryResolver) Search(ctx context.Context, obj *model.Repository, revspec *string, query string, regex *bool, path *string, cursor *coremodel.Cursor) (*model.SearchResultCursor, error) {
 	if cursor == nil {
-		// TODO: Filter?
 		cursor = coremodel.NewCursor(nil)
 	}
 
-	entries := obj.GetEntries()
-
-	if cursor.Next != "" {
-		i := sort.Search(len(entries), func(n int) bool {
-			return entries[n].Name > cursor.Next
-		})
-		if i != len(entries) {
-			entries = entries[i+1:]
-		} else {
-			entries = nil
+	rev := "HEAD"
+	if revspec != nil {
+		rev = *revspec
+	}
+	if query == "" {
+		return nil, valid.Errorf(ctx, "query", "Query must not be empty")
+	}
+	expr := regexp.QuoteMeta(query)
+	if regex != nil && *regex {
+		expr = query
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, valid.Errorf(ctx, "query", "Invalid regular expression: %v", err)
 		}
 	}
+	var glob string
+	if path != nil {
+		glob = *path
+	}
+
+	results, cursor, err := model.SearchWithCursor(ctx, obj, cursor, rev, expr, glob)
+	if err != nil {
+		return nil, err
+	}
+	return &model.SearchResultCursor{results, cursor}, nil
+}
+
+func (r *repositoryResolver) Compare(ctx context.Context, obj *model.Repository, base string, head string) (*model.Comparison, error) {
+	return model.CompareRevisions(obj, base, head)
+}
+
+func (r *secretFindingResolver) Repository(ctx context.Context, obj *model.SecretFinding) (*model.Repository, error) {
+	return loaders.ForContext(ctx).RepositoriesByID.Load(obj.RepoID)
+}
+
+func (r *secretFindingResolver) Pusher(ctx context.Context, obj *model.SecretFinding) (*model.User, error) {
+	if obj.PusherID == nil {
+		return nil, nil
+	}
+	return loaders.ForContext(ctx).UsersByID.Load(*obj.PusherID)
+}
+
+func (r *teamResolver) Organization(ctx context.Context, obj *model.Team) (*model.Organization, error) {
+	return loaders.ForContext(ctx).OrganizationsByID.Load(obj.OrgID)
+}
+
+func (r *teamResolver) CanonicalName(ctx context.Context, obj *model.Team) (string, error) {
+	org, err := loaders.ForContext(ctx).OrganizationsByID.Load(obj.OrgID)
+	if err != nil {
+		return "", err
+	}
+	return org.CanonicalName() + "/" + obj.Name, nil
+}
+
+func (r *teamResolver) Members(ctx context.Context, obj *model.Team, cursor *coremodel.Cursor) (*model.TeamMemberCursor, error) {
+	if cursor == nil {
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var members []*model.TeamMember
+	if err := database.WithTx(ctx, &sql.TxOptions{
+		Isolation: 0,
+		ReadOnly:  true,
+	}, func(tx *sql.Tx) error {
+		tm := (&model.TeamMember{}).As(`tm`)
+		query := database.
+			Select(ctx, tm).
+			From(`team_member tm`).
+			Where(`tm.team_id = ?`, obj.ID).
+			Where(`EXISTS (
+				SELECT 1 FROM organization_member viewer
+				WHERE viewer.org_id = ? AND viewer.user_id = ?
+			)`, obj.OrgID, auth.ForContext(ctx).UserID)
+		members, cursor = tm.QueryWithCursor(ctx, tx, query, cursor)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.TeamMemberCursor{members, cursor}, nil
+}
+
+func (r *teamACLResolver) Repository(ctx context.Context, obj *model.TeamACL) (*model.Repository, error) {
+	return loaders.ForContext(ctx).RepositoriesByID.Load(obj.RepoID)
+}
+
+func (r *teamACLResolver) Team(ctx context.Context, obj *model.TeamACL) (*model.Team, error) {
+	return loaders.ForContext(ctx).TeamsByID.Load(obj.TeamID)
+}
+
+func (r *teamMemberResolver) Team(ctx context.Context, obj *model.TeamMember) (*model.Team, error) {
+	return loaders.ForContext(ctx).TeamsByID.Load(obj.TeamID)
+}
+
+func (r *teamMemberResolver) User(ctx context.Context, obj *model.TeamMember) (*model.User, error) {
+	return loaders.ForContext(ctx).UsersByID.Load(obj.UserID)
+}
+
+func (r *textBlobResolver) Text(ctx context.Context, obj *model.TextBlob, rangeArg *model.ByteRange) (string, error) {
+	return obj.TextRange(rangeArg)
+}
+
+func (r *treeResolver) Entries(ctx context.Context, obj *model.Tree, cursor *coremodel.Cursor, glob *string, recursive *bool) (*model.TreeEntryCursor, error) {
+	if cursor == nil {
+		// TODO: Filter?
+		cursor = coremodel.NewCursor(nil)
+	}
+
+	var pattern string
+	if glob != nil {
+		pattern = *glob
+	}
+	entries, err := obj.GetEntries(ctx, pattern,
+		recursive != nil && *recursive, cursor.Next, cursor.Count+1)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(entries) > cursor.Count {
 		cursor = &coremodel.Cursor{
@@ -1297,14 +2962,13 @@ func (r *userResolver) Repositories(ctx context.Context, obj *model.User, cursor
 		query := database.
 			Select(ctx, repo).
 			From(`repository repo`).
-			LeftJoin(`access ON repo.id = access.repo_id`).
 			Where(sq.And{
 				sq.Or{
-					sq.Expr(`? IN (access.user_id, repo.owner_id)`,
-						auth.ForContext(ctx).UserID),
+					repo.AccessibleBy(auth.ForContext(ctx).UserID),
 					sq.Expr(`repo.visibility = 'public'`),
 				},
 				sq.Expr(`repo.owner_id = ?`, obj.ID),
+				sq.Expr(`repo.org_id IS NULL`),
 			})
 		repos, cursor = repo.QueryWithCursor(ctx, tx, query, cursor)
 		return nil
@@ -1392,12 +3056,43 @@ func (r *Resolver) ACL() api.ACLResolver { return &aCLResolver{r} }
 // Artifact returns api.ArtifactResolver implementation.
 func (r *Resolver) Artifact() api.ArtifactResolver { return &artifactResolver{r} }
 
+// BinaryBlob returns api.BinaryBlobResolver implementation.
+func (r *Resolver) BinaryBlob() api.BinaryBlobResolver { return &binaryBlobResolver{r} }
+
 // Commit returns api.CommitResolver implementation.
 func (r *Resolver) Commit() api.CommitResolver { return &commitResolver{r} }
 
+// Comparison returns api.ComparisonResolver implementation.
+func (r *Resolver) Comparison() api.ComparisonResolver { return &comparisonResolver{r} }
+
 // Mutation returns api.MutationResolver implementation.
 func (r *Resolver) Mutation() api.MutationResolver { return &mutationResolver{r} }
 
+// ObjectSignature returns api.ObjectSignatureResolver implementation.
+func (r *Resolver) ObjectSignature() api.ObjectSignatureResolver { return &objectSignatureResolver{r} }
+
+// Organization returns api.OrganizationResolver implementation.
+func (r *Resolver) Organization() api.OrganizationResolver { return &organizationResolver{r} }
+
+// OrganizationMember returns api.OrganizationMemberResolver implementation.
+func (r *Resolver) OrganizationMember() api.OrganizationMemberResolver {
+	return &organizationMemberResolver{r}
+}
+
+// ProtectedRef returns api.ProtectedRefResolver implementation.
+func (r *Resolver) ProtectedRef() api.ProtectedRefResolver { return &protectedRefResolver{r} }
+
+// PushMirror returns api.PushMirrorResolver implementation.
+func (r *Resolver) PushMirror() api.PushMirrorResolver { return &pushMirrorResolver{r} }
+
+// PushMirrorAttempt returns api.PushMirrorAttemptResolver implementation.
+func (r *Resolver) PushMirrorAttempt() api.PushMirrorAttemptResolver {
+	return &pushMirrorAttemptResolver{r}
+}
+
+// PushPolicy returns api.PushPolicyResolver implementation.
+func (r *Resolver) PushPolicy() api.PushPolicyResolver { return &pushPolicyResolver{r} }
+
 // Query returns api.QueryResolver implementation.
 func (r *Resolver) Query() api.QueryResolver { return &queryResolver{r} }
 
@@ -1407,6 +3102,21 @@ func (r *Resolver) Reference() api.ReferenceResolver { return &referenceResolver
 // Repository returns api.RepositoryResolver implementation.
 func (r *Resolver) Repository() api.RepositoryResolver { return &repositoryResolver{r} }
 
+// SecretFinding returns api.SecretFindingResolver implementation.
+func (r *Resolver) SecretFinding() api.SecretFindingResolver { return &secretFindingResolver{r} }
+
+// Team returns api.TeamResolver implementation.
+func (r *Resolver) Team() api.TeamResolver { return &teamResolver{r} }
+
+// TeamACL returns api.TeamACLResolver implementation.
+func (r *Resolver) TeamACL() api.TeamACLResolver { return &teamACLResolver{r} }
+
+// TeamMember returns api.TeamMemberResolver implementation.
+func (r *Resolver) TeamMember() api.TeamMemberResolver { return &teamMemberResolver{r} }
+
+// TextBlob returns api.TextBlobResolver implementation.
+func (r *Resolver) TextBlob() api.TextBlobResolver { return &textBlobResolver{r} }
+
 // Tree returns api.TreeResolver implementation.
 func (r *Resolver) Tree() api.TreeResolver { return &treeResolver{r} }
 
@@ -1423,11 +3133,25 @@ func (r *Resolver) WebhookDelivery() api.WebhookDeliveryResolver { return &webho
 
 type aCLResolver struct{ *Resolver }
 type artifactResolver struct{ *Resolver }
+type binaryBlobResolver struct{ *Resolver }
 type commitResolver struct{ *Resolver }
+type comparisonResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type objectSignatureResolver struct{ *Resolver }
+type organizationResolver struct{ *Resolver }
+type organizationMemberResolver struct{ *Resolver }
+type protectedRefResolver struct{ *Resolver }
+type pushMirrorResolver struct{ *Resolver }
+type pushMirrorAttemptResolver struct{ *Resolver }
+type pushPolicyResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type referenceResolver struct{ *Resolver }
 type repositoryResolver struct{ *Resolver }
+type secretFindingResolver struct{ *Resolver }
+type teamResolver struct{ *Resolver }
+type teamACLResolver struct{ *Resolver }
+type teamMemberResolver struct{ *Resolver }
+type textBlobResolver struct{ *Resolver }
 type treeResolver struct{ *Resolver }
 type userResolver struct{ *Resolver }
 type userWebhookSubscriptionResolver struct{ *Resolver }
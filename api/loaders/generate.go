@@ -3,8 +3,11 @@
 
 package loaders
 
+//go:generate ./gen OrganizationsByIDLoader int api/graph/model.Organization
+//go:generate ./gen OrganizationsByNameLoader string api/graph/model.Organization
 //go:generate ./gen RepositoriesByIDLoader int api/graph/model.Repository
 //go:generate ./gen RepositoriesByOwnerRepoNameLoader OwnerRepoName api/graph/model.Repository
 //go:generate ./gen RepositoriesByOwnerIDRepoNameLoader OwnerIDRepoName api/graph/model.Repository
+//go:generate ./gen TeamsByIDLoader int api/graph/model.Team
 //go:generate ./gen UsersByIDLoader int api/graph/model.User
 //go:generate ./gen UsersByNameLoader string api/graph/model.User
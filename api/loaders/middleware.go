@@ -26,6 +26,9 @@ type contextKey struct {
 type Loaders struct {
 	UsersByID                     UsersByIDLoader
 	UsersByName                   UsersByNameLoader
+	OrganizationsByID             OrganizationsByIDLoader
+	OrganizationsByName           OrganizationsByNameLoader
+	TeamsByID                     TeamsByIDLoader
 	RepositoriesByID              RepositoriesByIDLoader
 	RepositoriesByOwnerRepoName   RepositoriesByOwnerRepoNameLoader
 	RepositoriesByOwnerIDRepoName RepositoriesByOwnerIDRepoNameLoader
@@ -129,15 +132,14 @@ func fetchRepositoriesByID(ctx context.Context) func(ids []int) ([]*model.Reposi
 				rows *sql.Rows
 			)
 			auser := auth.ForContext(ctx)
+			repo := (&model.Repository{}).As(`repo`)
 			query := database.
-				Select(ctx, (&model.Repository{}).As(`repo`)).
-				Distinct().
+				Select(ctx, repo).
 				From(`repository repo`).
-				LeftJoin(`access ON repo.id = access.repo_id`).
 				Where(sq.And{
 					sq.Expr(`repo.id = ANY(?)`, pq.Array(ids)),
 					sq.Or{
-						sq.Expr(`? IN (access.user_id, repo.owner_id)`, auser.UserID),
+						repo.AccessibleBy(auser.UserID),
 						sq.Expr(`repo.visibility != 'private'`),
 					},
 				})
@@ -169,6 +171,135 @@ func fetchRepositoriesByID(ctx context.Context) func(ids []int) ([]*model.Reposi
 	}
 }
 
+func fetchOrganizationsByID(ctx context.Context) func(ids []int) ([]*model.Organization, []error) {
+	return func(ids []int) ([]*model.Organization, []error) {
+		orgs := make([]*model.Organization, len(ids))
+		if err := database.WithTx(ctx, &sql.TxOptions{
+			Isolation: 0,
+			ReadOnly:  true,
+		}, func(tx *sql.Tx) error {
+			var (
+				err  error
+				rows *sql.Rows
+			)
+			query := database.
+				Select(ctx, (&model.Organization{}).As(`org`)).
+				From(`organization org`).
+				Where(sq.Expr(`org.id = ANY(?)`, pq.Array(ids)))
+			if rows, err = query.RunWith(tx).QueryContext(ctx); err != nil {
+				panic(err)
+			}
+			defer rows.Close()
+
+			orgsById := map[int]*model.Organization{}
+			for rows.Next() {
+				var org model.Organization
+				if err := rows.Scan(database.Scan(ctx, &org)...); err != nil {
+					panic(err)
+				}
+				orgsById[org.ID] = &org
+			}
+			if err = rows.Err(); err != nil {
+				panic(err)
+			}
+
+			for i, id := range ids {
+				orgs[i] = orgsById[id]
+			}
+			return nil
+		}); err != nil {
+			panic(err)
+		}
+		return orgs, nil
+	}
+}
+
+func fetchOrganizationsByName(ctx context.Context) func(names []string) ([]*model.Organization, []error) {
+	return func(names []string) ([]*model.Organization, []error) {
+		orgs := make([]*model.Organization, len(names))
+		if err := database.WithTx(ctx, &sql.TxOptions{
+			Isolation: 0,
+			ReadOnly:  true,
+		}, func(tx *sql.Tx) error {
+			var (
+				err  error
+				rows *sql.Rows
+			)
+			query := database.
+				Select(ctx, (&model.Organization{}).As(`org`)).
+				From(`organization org`).
+				Where(sq.Expr(`org.name = ANY(?)`, pq.Array(names)))
+			if rows, err = query.RunWith(tx).QueryContext(ctx); err != nil {
+				panic(err)
+			}
+			defer rows.Close()
+
+			orgsByName := map[string]*model.Organization{}
+			for rows.Next() {
+				org := model.Organization{}
+				if err := rows.Scan(database.Scan(ctx, &org)...); err != nil {
+					panic(err)
+				}
+				orgsByName[org.Name] = &org
+			}
+			if err = rows.Err(); err != nil {
+				panic(err)
+			}
+
+			for i, name := range names {
+				orgs[i] = orgsByName[name]
+			}
+			return nil
+		}); err != nil {
+			panic(err)
+		}
+		return orgs, nil
+	}
+}
+
+func fetchTeamsByID(ctx context.Context) func(ids []int) ([]*model.Team, []error) {
+	return func(ids []int) ([]*model.Team, []error) {
+		teams := make([]*model.Team, len(ids))
+		if err := database.WithTx(ctx, &sql.TxOptions{
+			Isolation: 0,
+			ReadOnly:  true,
+		}, func(tx *sql.Tx) error {
+			var (
+				err  error
+				rows *sql.Rows
+			)
+			query := database.
+				Select(ctx, (&model.Team{}).As(`team`)).
+				From(`team`).
+				Where(sq.Expr(`team.id = ANY(?)`, pq.Array(ids)))
+			if rows, err = query.RunWith(tx).QueryContext(ctx); err != nil {
+				panic(err)
+			}
+			defer rows.Close()
+
+			teamsById := map[int]*model.Team{}
+			for rows.Next() {
+				var team model.Team
+				if err := rows.Scan(database.Scan(ctx, &team)...); err != nil {
+					panic(err)
+				}
+				teamsById[team.ID] = &team
+			}
+			if err = rows.Err(); err != nil {
+				panic(err)
+			}
+
+			for i, id := range ids {
+				teams[i] = teamsById[id]
+			}
+			return nil
+		}); err != nil {
+			panic(err)
+		}
+		return teams, nil
+	}
+}
+
 type OwnerRepoName struct {
 	Owner    string
 	RepoName string
@@ -189,24 +320,29 @@ func fetchRepositoriesByOwnerRepoName(ctx context.Context) func([]OwnerRepoName)
 				err  error
 				rows *sql.Rows
 			)
+			repo := (&model.Repository{}).As(`repo`)
 			query := database.
 				Select(ctx).
 				Prefix(`WITH owner_repo_names AS (
 					SELECT owner, repo_name
 					FROM unnest(?::owner_repo_name[]))`, pq.GenericArray{ownerRepoNames}).
-				Columns(database.Columns(ctx, (&model.Repository{}).As(`repo`))...).
+				Columns(database.Columns(ctx, repo)...).
 				Columns(`o.owner`).
-				Distinct().
 				From(`owner_repo_names o`).
-				Join(`"user" u on o.owner = u.username`).
+				LeftJoin(`"user" u on o.owner = u.username`).
+				LeftJoin(`organization org on o.owner = org.name`).
 				Join(`repository repo ON o.repo_name = repo.name
-					AND u.id = repo.owner_id`).
-				LeftJoin(`access ON repo.id = access.repo_id`).
+					AND (
+						(repo.org_id IS NULL AND u.id = repo.owner_id)
+						OR repo.org_id = org.id
+					)`).
 				Where(sq.Or{
-					sq.Expr(`? IN (access.user_id, repo.owner_id)`,
-						auth.ForContext(ctx).UserID),
+					repo.AccessibleBy(auth.ForContext(ctx).UserID),
 					sq.Expr(`repo.visibility != 'private'`),
-				})
+				}).
+				// A name which belongs to both a user and an organization is
+				// ambiguous, so neither's repositories are returned
+				Where(`(u.id IS NULL OR org.id IS NULL)`)
 			if rows, err = query.RunWith(tx).QueryContext(ctx); err != nil {
 				panic(err)
 			}
@@ -257,21 +393,20 @@ func fetchRepositoriesByOwnerIDRepoName(ctx context.Context) func([]OwnerIDRepoN
 				err  error
 				rows *sql.Rows
 			)
+			repo := (&model.Repository{}).As(`repo`)
 			query := database.
 				Select(ctx).
 				Prefix(`WITH owner_id_repo_names AS (
 					SELECT owner_id, repo_name
 					FROM unnest(?::owner_id_repo_name[]))`, pq.GenericArray{ownerIDRepoNames}).
-				Columns(database.Columns(ctx, (&model.Repository{}).As(`repo`))...).
+				Columns(database.Columns(ctx, repo)...).
 				Columns(`o.owner_id`).
-				Distinct().
 				From(`owner_id_repo_names o`).
 				Join(`repository repo ON o.repo_name = repo.name
-					AND o.owner_id = repo.owner_id`).
-				LeftJoin(`access ON repo.id = access.repo_id`).
+					AND o.owner_id = repo.owner_id
+					AND repo.org_id IS NULL`).
 				Where(sq.Or{
-					sq.Expr(`? IN (access.user_id, repo.owner_id)`,
-						auth.ForContext(ctx).UserID),
+					repo.AccessibleBy(auth.ForContext(ctx).UserID),
 					sq.Expr(`repo.visibility != 'private'`),
 				})
 			if rows, err = query.RunWith(tx).QueryContext(ctx); err != nil {
@@ -306,7 +441,8 @@ func fetchRepositoriesByOwnerIDRepoName(ctx context.Context) func([]OwnerIDRepoN
 
 func Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), loadersCtxKey, &Loaders{
+		ctx := model.ContextWithSignatureKeys(r.Context())
+		ctx = context.WithValue(ctx, loadersCtxKey, &Loaders{
 			UsersByID: UsersByIDLoader{
 				maxBatch: 100,
 				wait:     1 * time.Millisecond,
@@ -317,6 +453,21 @@ func Middleware(next http.Handler) http.Handler {
 				wait:     1 * time.Millisecond,
 				fetch:    fetchUsersByName(r.Context()),
 			},
+			OrganizationsByID: OrganizationsByIDLoader{
+				maxBatch: 100,
+				wait:     1 * time.Millisecond,
+				fetch:    fetchOrganizationsByID(r.Context()),
+			},
+			OrganizationsByName: OrganizationsByNameLoader{
+				maxBatch: 100,
+				wait:     1 * time.Millisecond,
+				fetch:    fetchOrganizationsByName(r.Context()),
+			},
+			TeamsByID: TeamsByIDLoader{
+				maxBatch: 100,
+				wait:     1 * time.Millisecond,
+				fetch:    fetchTeamsByID(r.Context()),
+			},
 			RepositoriesByID: RepositoriesByIDLoader{
 				maxBatch: 100,
 				wait:     1 * time.Millisecond,
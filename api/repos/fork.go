@@ -0,0 +1,131 @@
+package repos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	work "git.sr.ht/~sircmpwn/dowork"
+)
+
+// Populates a newly initialized repository at forkPath as a fork of the
+// repository at upstreamPath. Objects are shared with the upstream repository
+// via git alternates, so only the references are copied.
+func Fork(ctx context.Context, upstreamPath, forkPath string) error {
+	if err := SetAlternate(forkPath, upstreamPath); err != nil {
+		return err
+	}
+
+	// All of the objects are already available via the alternate, so this
+	// only copies the references.
+	fetch := exec.CommandContext(ctx, "git", "-C", forkPath,
+		"fetch", "--quiet", "--no-tags", upstreamPath,
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	if out, err := fetch.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch: %v: %s", err, string(out))
+	}
+
+	head, err := exec.CommandContext(ctx, "git", "-C", upstreamPath,
+		"symbolic-ref", "--quiet", "HEAD").Output()
+	if err != nil {
+		// Detached or missing HEAD; keep the default
+		return nil
+	}
+	symref := exec.CommandContext(ctx, "git", "-C", forkPath,
+		"symbolic-ref", "HEAD", strings.TrimSpace(string(head)))
+	if out, err := symref.CombinedOutput(); err != nil {
+		return fmt.Errorf("git symbolic-ref: %v: %s", err, string(out))
+	}
+	return nil
+}
+
+// Configures the repository at repoPath to borrow objects from the repository
+// at upstreamPath, replacing any existing alternates.
+func SetAlternate(repoPath, upstreamPath string) error {
+	alternates := path.Join(repoPath, "objects", "info", "alternates")
+	if err := os.MkdirAll(path.Dir(alternates), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(alternates,
+		[]byte(path.Join(upstreamPath, "objects")+"\n"), 0644)
+}
+
+// Copies any objects which the repository at repoPath borrows from its
+// alternates into its own object store, then removes the alternates. This
+// must be done for each fork before its upstream repository is deleted.
+func Dissociate(ctx context.Context, repoPath string) error {
+	alternates := path.Join(repoPath, "objects", "info", "alternates")
+	if _, err := os.Stat(alternates); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	repack := exec.CommandContext(ctx, "git", "-C", repoPath,
+		"repack", "-a", "-d", "--quiet")
+	if out, err := repack.CombinedOutput(); err != nil {
+		return fmt.Errorf("git repack: %v: %s", err, string(out))
+	}
+	return os.Remove(alternates)
+}
+
+// Removes the repository at repoPath from disk. Forks borrow objects from the
+// repository, so if there are any, it is moved out of the way and removed
+// only after each of forkPaths has been dissociated from it, which can take a
+// while and is scheduled for later. Forks of forks must precede their own
+// upstream in forkPaths.
+func Delete(ctx context.Context, repoPath string, forkPaths []string) error {
+	if len(forkPaths) == 0 {
+		return os.RemoveAll(repoPath)
+	}
+	queue, ok := ctx.Value(ctxKey).(*work.Queue)
+	if !ok {
+		panic("No repos worker for this context")
+	}
+
+	trash, err := ioutil.TempDir(path.Dir(repoPath), ".deleted-")
+	if err != nil {
+		return err
+	}
+	movedPath := path.Join(trash, path.Base(repoPath))
+	if err := os.Rename(repoPath, movedPath); err != nil {
+		return err
+	}
+	for _, forkPath := range forkPaths {
+		alternates := path.Join(forkPath, "objects", "info", "alternates")
+		upstream, err := ioutil.ReadFile(alternates)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(upstream)) != path.Join(repoPath, "objects") {
+			continue
+		}
+		if err := SetAlternate(forkPath, movedPath); err != nil {
+			return err
+		}
+	}
+
+	task := work.NewTask(func(ctx context.Context) error {
+		for _, forkPath := range forkPaths {
+			dissociateCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+			err := Dissociate(dissociateCtx, forkPath)
+			cancel()
+			if err != nil {
+				// Leave the upstream in place so that the fork can be repaired
+				log.Printf("Failed to dissociate %s from %s: %v",
+					forkPath, repoPath, err)
+				return err
+			}
+		}
+		return os.RemoveAll(trash)
+	})
+	queue.Enqueue(task)
+	log.Printf("Enqueued dissociation of %d forks of %s", len(forkPaths), repoPath)
+	return nil
+}
@@ -0,0 +1,189 @@
+package repos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"git.sr.ht/~sircmpwn/core-go/config"
+	"git.sr.ht/~sircmpwn/core-go/crypto"
+	"git.sr.ht/~sircmpwn/core-go/database"
+	work "git.sr.ht/~sircmpwn/dowork"
+)
+
+// How often to check for mirrors which are due to be synchronized. Note that
+// a warm shutdown waits for the next check.
+const mirrorPollInterval = time.Minute
+
+// The longest a single mirror may take to synchronize.
+const mirrorFetchTimeout = 10 * time.Minute
+
+type mirror struct {
+	ID                int
+	Path              string
+	RemoteURL         string
+	Username          *string
+	EncryptedPassword []byte
+}
+
+// Schedules periodic synchronization of mirrors on the given queue, which
+// should be dedicated to mirrors. Each run claims any mirrors which have not
+// been synchronized within the configured [git.sr.ht]mirror-interval and
+// enqueues a task to synchronize each of them, then schedules the next run.
+func ScheduleMirrors(queue *work.Queue) {
+	scheduleMirrors(queue, time.Now())
+}
+
+func scheduleMirrors(queue *work.Queue, notBefore time.Time) {
+	task := work.NewTask(func(ctx context.Context) error {
+		mirrors, err := claimMirrors(ctx)
+		if err != nil {
+			log.Printf("Error claiming mirrors: %v", err)
+		}
+		for _, m := range mirrors {
+			m := m
+			queue.Enqueue(work.NewTask(func(ctx context.Context) error {
+				return syncMirror(ctx, m)
+			}))
+		}
+		scheduleMirrors(queue, time.Now().Add(mirrorPollInterval))
+		return nil
+	}).NotBefore(notBefore)
+	// Fails only if the queue is shutting down
+	queue.Enqueue(task)
+}
+
+func claimMirrors(ctx context.Context) ([]mirror, error) {
+	interval := time.Hour
+	conf := config.ForContext(ctx)
+	if s, ok := conf.Get("git.sr.ht", "mirror-interval"); ok && s != "" {
+		var err error
+		if interval, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("Invalid [git.sr.ht]mirror-interval: %v", err)
+		}
+	}
+
+	// Mirrors are claimed by bumping their last sync time up front, so that
+	// they aren't picked up again by this or other API servers in the
+	// meantime.
+	var mirrors []mirror
+	if err := database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+			UPDATE repository
+			SET mirror_last_sync = NOW() at time zone 'utc'
+			WHERE id IN (
+				SELECT id FROM repository
+				WHERE mirror_url IS NOT NULL
+					AND clone_status != 'IN_PROGRESS'
+					AND (mirror_last_sync IS NULL OR mirror_last_sync <
+						NOW() at time zone 'utc' - $1 * interval '1 second')
+				ORDER BY mirror_last_sync NULLS FIRST
+				LIMIT 100
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, path, mirror_url, mirror_username,
+				mirror_encrypted_password;
+		`, int64(interval.Seconds()))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var m mirror
+			if err := rows.Scan(&m.ID, &m.Path, &m.RemoteURL,
+				&m.Username, &m.EncryptedPassword); err != nil {
+				return err
+			}
+			mirrors = append(mirrors, m)
+		}
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+	return mirrors, nil
+}
+
+func syncMirror(ctx context.Context, m mirror) error {
+	var mirrorError sql.NullString
+	var password *string
+	if m.EncryptedPassword != nil {
+		p := string(crypto.DecryptWithoutExpiration(m.EncryptedPassword))
+		password = &p
+	}
+	remote := JoinMirrorURL(m.RemoteURL, m.Username, password)
+	fetchCtx, cancel := context.WithTimeout(ctx, mirrorFetchTimeout)
+	defer cancel()
+	if err := FetchMirror(fetchCtx, m.Path, remote); err != nil {
+		log.Printf("Error synchronizing mirror %s: %v", m.Path, err)
+		mirrorError.String = err.Error()
+		mirrorError.Valid = true
+	}
+	return database.WithTx(ctx, nil, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE repository
+			SET mirror_last_sync = NOW() at time zone 'utc', mirror_error = $2
+			WHERE id = $1;`, m.ID, mirrorError)
+		return err
+	})
+}
+
+// Removes any credentials from a mirror's remote URL, so that it can be shown
+// to users, and returns them separately.
+func SplitMirrorURL(remote string) (string, *string, *string) {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil {
+		return remote, nil, nil
+	}
+	username := u.User.Username()
+	var password *string
+	if p, ok := u.User.Password(); ok {
+		password = &p
+	}
+	u.User = nil
+	return u.String(), &username, password
+}
+
+// Adds the credentials split off by SplitMirrorURL back to the remote URL.
+func JoinMirrorURL(remote string, username, password *string) string {
+	if username == nil {
+		return remote
+	}
+	u, err := url.Parse(remote)
+	if err != nil {
+		return remote
+	}
+	if password != nil {
+		u.User = url.UserPassword(*username, *password)
+	} else {
+		u.User = url.User(*username)
+	}
+	return u.String()
+}
+
+// Updates the branches and tags of the repository at repoPath to match those
+// of the remote repository, which may be given as a URL or as the path to a
+// local repository. Branches and tags which no longer exist on the remote are
+// removed.
+func FetchMirror(ctx context.Context, repoPath, remote string) error {
+	fetch := exec.CommandContext(ctx, "git", "-C", repoPath,
+		"fetch", "--quiet", "--prune", "--no-tags", remote,
+		"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+	fetch.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if out, err := fetch.CombinedOutput(); err != nil {
+		// The error is shown to users, so keep any credentials out of it
+		msg := strings.TrimSpace(string(out))
+		if u, perr := url.Parse(remote); perr == nil && u.User != nil {
+			if password, ok := u.User.Password(); ok && password != "" {
+				msg = strings.ReplaceAll(msg, password, "xxxxx")
+			}
+		}
+		return fmt.Errorf("git fetch: %v: %s", err, msg)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package repos
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Describes a push to gitsrht-update-hook, in the same form as gitsrht-shell
+// and the git HTTP backend provide.
+type PushContext struct {
+	Repo PushRepo `json:"repo"`
+	User PushUser `json:"user"`
+}
+
+type PushRepo struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	OwnerID int    `json:"owner_id"`
+	// The name of the organization which owns the repository, if any, or of
+	// the owner
+	OwnerName    string `json:"owner_name"`
+	OrgID        *int   `json:"org_id,omitempty"`
+	Path         string `json:"path"`
+	AbsolutePath string `json:"absolute_path"`
+	Visibility   string `json:"visibility"`
+	Autocreated  bool   `json:"autocreated"`
+}
+
+type PushUser struct {
+	CanonicalName string `json:"canonical_name"`
+	Name          string `json:"name"`
+}
+
+// The hooks of a reference update are allowed this long to complete.
+const updateRefTimeout = 5 * time.Minute
+
+// Updates a reference from the old object ID to the new one, failing if the
+// reference's current ID is not the old ID. An empty old ID requires that the
+// reference does not exist, and an empty new ID deletes it.
+//
+// The repository pushes the update to itself, so that the hooks run as for
+// any other push: protected references are enforced, and webhooks and builds
+// are triggered. The push is not bound to ctx, since interrupting the hooks
+// when a request times out would leave their work half done.
+func UpdateRef(ctx context.Context, pctx *PushContext,
+	name, oldID, newID string) error {
+	pushCtx, cancel := context.WithTimeout(context.Background(),
+		updateRefTimeout)
+	defer cancel()
+
+	pushContext, err := json.Marshal(pctx)
+	if err != nil {
+		panic(err)
+	}
+	pushUuid := uuid.New().String()
+	log.Printf("Updating %s in %s as push %s", name, pctx.Repo.Path, pushUuid)
+
+	refspec := newID + ":" + name
+	if newID == "" {
+		refspec = ":" + name
+	}
+	push := exec.CommandContext(pushCtx, "git", "-C", pctx.Repo.Path,
+		"push", "--porcelain", "--force-with-lease="+name+":"+oldID,
+		".", refspec)
+	push.Env = append(os.Environ(),
+		fmt.Sprintf("SRHT_PUSH=%s", pushUuid),
+		fmt.Sprintf("SRHT_PUSH_CTX=%s", string(pushContext)))
+	var stdout, stderr bytes.Buffer
+	push.Stdout = &stdout
+	push.Stderr = &stderr
+	failed := false
+	if err := push.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return err
+		}
+		failed = true
+	}
+
+	// Porcelain status lines are "<flag>\t<from>:<to>\t<summary>"
+	reason := strings.TrimSpace(stderr.String())
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 3 {
+			continue
+		}
+		switch parts[0] {
+		case "!":
+			reason = parts[2]
+		case "=":
+			// The lease is not checked if the reference is up to date
+			if oldID != newID {
+				failed = true
+				reason = "[rejected] (stale info)"
+			}
+		}
+	}
+	if !failed {
+		return nil
+	}
+	// Includes any reasons given by the pre-receive hook
+	var messages []string
+	scanner = bufio.NewScanner(&stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "remote:") || strings.Contains(line, "\033") {
+			continue
+		}
+		if line = strings.TrimSpace(strings.TrimPrefix(line, "remote:")); line != "" {
+			messages = append(messages, line)
+		}
+	}
+	if len(messages) != 0 {
+		reason += ": " + strings.Join(messages, "; ")
+	}
+	return fmt.Errorf("Failed to update %s: %s", name, reason)
+}
+
+// Checks that a full reference name, such as refs/heads/master, is acceptable
+// to git, following the rules of git-check-ref-format(1). The error describes
+// the problem in a form suitable for users.
+func CheckRefFormat(name string) error {
+	if !strings.HasPrefix(name, "refs/") {
+		return errors.New("must begin with refs/")
+	}
+	if name == "@" {
+		return errors.New("must not be '@'")
+	}
+	if strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") {
+		return errors.New("must not end with '/' or '.'")
+	}
+	for _, seq := range []string{"..", "@{", "//"} {
+		if strings.Contains(name, seq) {
+			return fmt.Errorf("must not contain '%s'", seq)
+		}
+	}
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f {
+			return errors.New("must not contain control characters")
+		}
+		if strings.ContainsRune(" ~^:?*[\\", c) {
+			return fmt.Errorf("must not contain '%c'", c)
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return errors.New("no component may begin with '.'")
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return errors.New("no component may end with '.lock'")
+		}
+	}
+	return nil
+}
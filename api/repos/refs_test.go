@@ -0,0 +1,107 @@
+package repos
+
+import (
+	"context"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestUpdateRef(t *testing.T) {
+	dir := tempDir(t)
+	repo := path.Join(dir, "repo.git")
+	work := path.Join(dir, "work")
+	runGit(t, dir, "init", "--quiet", "--bare", repo)
+	runGit(t, dir, "init", "--quiet", work)
+	runGit(t, work, "commit", "--quiet", "--allow-empty", "-m", "First")
+	first := runGit(t, work, "rev-parse", "HEAD")
+	runGit(t, work, "commit", "--quiet", "--allow-empty", "-m", "Second")
+	second := runGit(t, work, "rev-parse", "HEAD")
+	runGit(t, work, "push", "--quiet", repo, "HEAD:refs/heads/master")
+
+	pctx := &PushContext{Repo: PushRepo{Path: repo}}
+	// The update is not interrupted if the request is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := UpdateRef(ctx, pctx, "refs/heads/feature", "", first); err != nil {
+		t.Fatal(err)
+	}
+	if got := runGit(t, repo, "rev-parse", "refs/heads/feature"); got != first {
+		t.Fatalf("feature is %s, want %s", got, first)
+	}
+
+	// The old ID must match
+	err := UpdateRef(context.Background(), pctx, "refs/heads/feature",
+		second, first)
+	if err == nil || !strings.Contains(err.Error(), "stale info") {
+		t.Fatalf("expected a stale info error, got %v", err)
+	}
+	if err := UpdateRef(context.Background(), pctx, "refs/heads/feature",
+		"", second); err == nil {
+		t.Fatal("expected creating an existing reference to fail")
+	}
+	if err := UpdateRef(context.Background(), pctx, "refs/heads/feature",
+		first, second); err != nil {
+		t.Fatal(err)
+	}
+	if got := runGit(t, repo, "rev-parse", "refs/heads/feature"); got != second {
+		t.Fatalf("feature is %s, want %s", got, second)
+	}
+
+	if err := UpdateRef(context.Background(), pctx, "refs/heads/feature",
+		second, ""); err != nil {
+		t.Fatal(err)
+	}
+	if refs := refs(t, repo); len(refs) != 1 ||
+		!strings.HasPrefix(refs[0], "refs/heads/master ") {
+		t.Fatalf("expected only master to remain, got %v", refs)
+	}
+}
+
+func TestCheckRefFormat(t *testing.T) {
+	for _, name := range []string{
+		"refs/heads/master",
+		"refs/heads/feature/topic-1.2",
+		"refs/tags/v1.0",
+		"refs/heads/ünïcode",
+		"refs/heads/a.lockb",
+	} {
+		if err := CheckRefFormat(name); err != nil {
+			t.Errorf("CheckRefFormat(%q) = %v, want nil", name, err)
+		}
+		if err := exec.Command("git", "check-ref-format", name).Run(); err != nil {
+			t.Errorf("git check-ref-format rejects %q", name)
+		}
+	}
+	for _, name := range []string{
+		"",
+		"master",
+		"refs/heads/",
+		"refs/heads//master",
+		"refs/heads/master.",
+		"refs/heads/.hidden",
+		"refs/heads/topic/.hidden",
+		"refs/heads/master.lock",
+		"refs/heads/master.lock/topic",
+		"refs/heads/a..b",
+		"refs/heads/a@{1}",
+		"refs/heads/a b",
+		"refs/heads/a~1",
+		"refs/heads/a^",
+		"refs/heads/a:b",
+		"refs/heads/a?",
+		"refs/heads/a*",
+		"refs/heads/a[b",
+		"refs/heads/a\\b",
+		"refs/heads/a\tb",
+		"refs/heads/a\x7fb",
+	} {
+		if err := CheckRefFormat(name); err == nil {
+			t.Errorf("CheckRefFormat(%q) = nil, want an error", name)
+		}
+		if err := exec.Command("git", "check-ref-format", name).Run(); err == nil {
+			t.Errorf("git check-ref-format accepts %q", name)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	work "git.sr.ht/~sircmpwn/dowork"
 	"github.com/99designs/gqlgen/graphql"
 
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/githttp"
 	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph"
 	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph/api"
 	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph/model"
@@ -33,10 +34,11 @@ func main() {
 	}
 
 	reposQueue := work.NewQueue("repos")
+	mirrorsQueue := work.NewQueue("mirrors")
 	webhookQueue := webhooks.NewQueue(schema)
 	legacyWebhooks := webhooks.NewLegacyQueue()
 
-	server.NewServer("git.sr.ht", appConfig).
+	srv := server.NewServer("git.sr.ht", appConfig).
 		WithDefaultMiddleware().
 		WithMiddleware(
 			loaders.Middleware,
@@ -45,6 +47,9 @@ func main() {
 			webhooks.LegacyMiddleware(legacyWebhooks),
 		).
 		WithSchema(schema, scopes).
-		WithQueues(reposQueue, webhookQueue.Queue, legacyWebhooks.Queue).
-		Run()
+		WithQueues(reposQueue, mirrorsQueue, webhookQueue.Queue,
+			legacyWebhooks.Queue)
+	githttp.Routes(srv.Router())
+	repos.ScheduleMirrors(mirrorsQueue)
+	srv.Run()
 }
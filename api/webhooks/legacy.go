@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"git.sr.ht/~sircmpwn/core-go/auth"
@@ -11,6 +12,7 @@ import (
 	sq "github.com/Masterminds/squirrel"
 
 	"git.sr.ht/~sircmpwn/git.sr.ht/api/graph/model"
+	"git.sr.ht/~sircmpwn/git.sr.ht/api/loaders"
 )
 
 type RepoWebhookPayload struct {
@@ -27,18 +29,19 @@ type RepoWebhookPayload struct {
 	} `json:"owner"`
 }
 
-func DeliverLegacyRepoCreate(ctx context.Context, repo *model.Repository) {
-	q := webhooks.LegacyForContext(ctx)
-	payload := RepoWebhookPayload{
-		ID:          repo.ID,
-		Created:     repo.Created,
-		Updated:     repo.Created,
-		Name:        repo.Name,
-		Description: repo.Description,
-		Visibility:  repo.RawVisibility,
+func setLegacyOwner(ctx context.Context,
+	payload *RepoWebhookPayload, repo *model.Repository) {
+	if repo.OrgID != nil {
+		org, err := loaders.ForContext(ctx).OrganizationsByID.Load(*repo.OrgID)
+		if err != nil || org == nil {
+			panic(fmt.Errorf("Failed to look up organization for repo %d: %v",
+				repo.ID, err))
+		}
+		payload.Owner.CanonicalName = org.CanonicalName()
+		payload.Owner.Name = org.Name
+		return
 	}
 
-	// TODO: User groups
 	user := auth.ForContext(ctx)
 	if user.UserID != repo.OwnerID {
 		// At the time of writing, the only consumers of this function are in a
@@ -48,6 +51,20 @@ func DeliverLegacyRepoCreate(ctx context.Context, repo *model.Repository) {
 	}
 	payload.Owner.CanonicalName = "~" + user.Username
 	payload.Owner.Name = user.Username
+}
+
+func DeliverLegacyRepoCreate(ctx context.Context, repo *model.Repository) {
+	q := webhooks.LegacyForContext(ctx)
+	payload := RepoWebhookPayload{
+		ID:          repo.ID,
+		Created:     repo.Created,
+		Updated:     repo.Created,
+		Name:        repo.Name,
+		Description: repo.Description,
+		Visibility:  repo.RawVisibility,
+	}
+
+	setLegacyOwner(ctx, &payload, repo)
 
 	encoded, err := json.Marshal(&payload)
 	if err != nil {
@@ -72,16 +89,7 @@ func DeliverLegacyRepoUpdate(ctx context.Context, repo *model.Repository) {
 		Visibility:  repo.RawVisibility,
 	}
 
-	// TODO: User groups
-	user := auth.ForContext(ctx)
-	if user.UserID != repo.OwnerID {
-		// At the time of writing, the only consumers of this function are in a
-		// context where the authenticated user is the owner of this repo. We
-		// can skip the database round-trip if we just grab their auth context.
-		panic(errors.New("TODO: look up user details for this repo"))
-	}
-	payload.Owner.CanonicalName = "~" + user.Username
-	payload.Owner.Name = user.Username
+	setLegacyOwner(ctx, &payload, repo)
 
 	encoded, err := json.Marshal(&payload)
 	if err != nil {
@@ -2,6 +2,7 @@ module git.sr.ht/~sircmpwn/git.sr.ht/gitsrht-shell
 
 require (
 	git.sr.ht/~sircmpwn/core-go v0.0.0-20220113153027-e7ae287d2fec
+	git.sr.ht/~sircmpwn/git.sr.ht/internal v0.0.0-00010101000000-000000000000
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
 	github.com/kr/text v0.2.0 // indirect
 	github.com/lib/pq v1.8.0
@@ -12,3 +13,5 @@ require (
 )
 
 go 1.13
+
+replace git.sr.ht/~sircmpwn/git.sr.ht/internal => ../internal
@@ -21,13 +21,8 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/vaughan0/go-ini"
 	"github.com/vektah/gqlparser/gqlerror"
-)
 
-const (
-	ACCESS_NONE   = 0
-	ACCESS_READ   = 1
-	ACCESS_WRITE  = 2
-	ACCESS_MANAGE = 4
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/access"
 )
 
 func main() {
@@ -145,17 +140,17 @@ func main() {
 	cmd[len(cmd)-1] = absPath
 
 	// Check what kind of access they're interested in
-	needsAccess := ACCESS_READ
+	needsAccess := access.READ
 	if cmd[0] == "git-receive-pack" {
-		needsAccess = ACCESS_WRITE
+		needsAccess = access.WRITE
 	}
 
-	// Fetch the necessary info from SQL. This first query fetches:
+	// Fetch the necessary info from SQL:
 	//
-	// 1. Repository information, such as visibility (public|unlisted|private)
-	// 2. Information about the repository owner's account
-	// 3. Information about the pusher's account
-	// 4. Any access control policies for that repo that apply to the pusher
+	// 1. Information about the pusher's account
+	// 2. Repository information, such as visibility (public|unlisted|private),
+	//    and any access control policies for that repo that apply to the
+	//    pusher. See the access package.
 	pgcs, ok := config.Get("git.sr.ht", "connection-string")
 	if !ok {
 		logger.Fatalf("No connection string configured for git.sr.ht: %v", err)
@@ -165,201 +160,133 @@ func main() {
 		logger.Fatalf("Failed to open a database connection: %v", err)
 	}
 
-	// Note: when updating push access logic, also update scm.sr.ht/access.py
 	var (
-		repoId              int
-		repoName            string
-		repoOwnerId         int
-		repoOwnerName       string
-		repoVisibility      string
 		pusherType          string
 		pusherSuspendNotice *string
-		accessGrant         *string
 		autocreated         bool
 	)
+	if err := db.QueryRow(`
+		SELECT user_type, suspension_notice FROM "user" WHERE id = $1;
+	`, pusherId).Scan(&pusherType, &pusherSuspendNotice); err != nil {
+		log.Println("A temporary error has occured. Please try again.")
+		logger.Fatalf("Error occured looking up pusher: %v", err)
+	}
+
 	logger.Printf("Looking up repo: pusher ID %d, repo path %s", pusherId, path)
-	row := db.QueryRow(`
-		SELECT
-			repo.id,
-			repo.name,
-			repo.owner_id,
-			owner.username,
-			repo.visibility,
-			pusher.user_type,
-			pusher.suspension_notice,
-			access.mode
-		FROM repository repo
-		JOIN "user" owner  ON owner.id  = repo.owner_id
-		JOIN "user" pusher ON pusher.id = $1
-		LEFT JOIN access
-			ON (access.repo_id = repo.id AND access.user_id = $1)
-		WHERE
-			repo.path = $2;
-	`, pusherId, path)
-	if err := row.Scan(&repoId, &repoName, &repoOwnerId, &repoOwnerName,
-		&repoVisibility, &pusherType, &pusherSuspendNotice, &accessGrant); err != nil {
-
-		logger.Printf("Lookup failed: %v", err)
-		logger.Println("Looking up redirect")
-
-		// If looking up the repo failed, it might have been renamed. Look for a
-		// corresponding redirect, and grab all of the same information that we
-		// need for the new repo while we're at it.
-		row = db.QueryRow(`
-			SELECT
-				repo.id,
-				repo.name,
-				repo.owner_id,
-				owner.username,
-				repo.visibility,
-				pusher.user_type,
-				pusher.suspension_notice,
-				access.mode
-			FROM repository repo
-			JOIN "user" owner  ON owner.id  = repo.owner_id
-			JOIN "user" pusher ON pusher.id = $1
-			JOIN redirect      ON redirect.new_repo_id = repo.id
-			LEFT JOIN access
-				ON (access.repo_id = repo.id AND access.user_id = $1)
-			WHERE
-				redirect.path = $2;
-		`, pusherId, path)
-
-		if err := row.Scan(&repoId, &repoName, &repoOwnerId, &repoOwnerName,
-			&repoVisibility, &pusherType, &pusherSuspendNotice,
-			&accessGrant); err == sql.ErrNoRows {
-
-			logger.Printf("Lookup failed: %v", err)
-
-			// There wasn't a repo or a redirect by this name, so maybe the user
-			// is pushing to a repo that doesn't exist. If so, autocreate it.
-			//
-			// If an error occurs at this step, we just log it internally and
-			// tell the user we couldn't find the repo they're asking after.
-			repoName = gopath.Base(path)
-			repoOwnerName = gopath.Base(gopath.Dir(path))
-			if repoOwnerName != "" {
-				repoOwnerName = repoOwnerName[1:]
-			}
+	repo, err := access.LookupRepo(context.Background(), db, pusherId, path)
+	if err != nil {
+		log.Println("A temporary error has occured. Please try again.")
+		logger.Fatalf("Error occured looking up repo: %v", err)
+	} else if repo != nil && repo.Redirected {
+		// The repo has been renamed
+		log.Printf("\033[93mNOTICE\033[0m: This repository has moved.")
+		log.Printf("Please update your remote to:")
+		log.Println()
+		log.Printf("\t%s/~%s/%s", origin, repo.EntityName, repo.Name)
+		log.Println()
+		os.Exit(128)
+	} else if repo == nil {
+		logger.Println("Lookup failed: no repository or redirect at this path")
+
+		// There wasn't a repo or a redirect by this name, so maybe the user
+		// is pushing to a repo that doesn't exist. If so, autocreate it.
+		//
+		// If an error occurs at this step, we just log it internally and
+		// tell the user we couldn't find the repo they're asking after.
+		repoName := gopath.Base(path)
+		repoOwnerName := gopath.Base(gopath.Dir(path))
+		if repoOwnerName != "" {
+			repoOwnerName = repoOwnerName[1:]
+		}
 
-			notFound := func(ctx string, errs ...error) {
-				for _, err := range errs {
-					logger.Printf("Error autocreating repo: %s: %v", ctx, err)
-				}
-				logger.Println("Repository not found.")
-				log.Println("Repository not found.")
-				log.Println()
-				os.Exit(128)
+		notFound := func(ctx string, errs ...error) {
+			for _, err := range errs {
+				logger.Printf("Error autocreating repo: %s: %v", ctx, err)
 			}
+			logger.Println("Repository not found.")
+			log.Println("Repository not found.")
+			log.Println()
+			os.Exit(128)
+		}
 
-			if needsAccess == ACCESS_READ || repoOwnerName != pusherName {
-				notFound("access", nil)
-			}
+		if needsAccess == access.READ || repoOwnerName != pusherName {
+			notFound("access", nil)
+		}
 
-			if needsAccess == ACCESS_WRITE {
-				if matched, _ := regexp.MatchString(
-					`^[A-Za-z0-9._-]+$`, repoName); !matched {
+		if matched, _ := regexp.MatchString(
+			`^[A-Za-z0-9._-]+$`, repoName); !matched {
 
-					log.Println("Name must match [A-Za-z0-9._-]+.")
-					notFound("name policy", nil)
-				}
+			log.Println("Name must match [A-Za-z0-9._-]+.")
+			notFound("name policy", nil)
+		}
 
-				repoOwnerId = pusherId
-				repoOwnerName = pusherName
-				repoVisibility = "private"
-
-				query := client.GraphQLQuery{
-					Query: `
-						mutation CreateRepository($name: String!) {
-							createRepository(name: $name, visibility: PRIVATE) {
-								id
-							}
-						}
-					`,
-					Variables: map[string]interface{}{
-						"name": repoName,
-					},
-				}
-				resp := struct {
-					Data struct {
-						CreateRepository struct {
-							ID int `json:"id"`
-						} `json:"createRepository"`
-					} `json:"data"`
-					Errors []gqlerror.Error `json:"errors"`
-				}{}
-
-				crypto.InitCrypto(config)
-				ctx := coreconfig.Context(context.Background(), config, "git.sr.ht")
-				err := client.Execute(ctx, pusherName, "git.sr.ht", query, &resp)
-				if err != nil {
-					notFound("create repository", err)
-				} else if len(resp.Errors) > 0 {
-					errs := []error{}
-					for i := range resp.Errors {
-						errs = append(errs, &resp.Errors[i])
+		query := client.GraphQLQuery{
+			Query: `
+				mutation CreateRepository($name: String!) {
+					createRepository(name: $name, visibility: PRIVATE) {
+						id
 					}
-					notFound("create repository", errs...)
 				}
-				repoId = resp.Data.CreateRepository.ID
-				autocreated = true
-				logger.Printf("Autocreated repo %s", path)
+			`,
+			Variables: map[string]interface{}{
+				"name": repoName,
+			},
+		}
+		resp := struct {
+			Data struct {
+				CreateRepository struct {
+					ID int `json:"id"`
+				} `json:"createRepository"`
+			} `json:"data"`
+			Errors []gqlerror.Error `json:"errors"`
+		}{}
+
+		crypto.InitCrypto(config)
+		ctx := coreconfig.Context(context.Background(), config, "git.sr.ht")
+		err := client.Execute(ctx, pusherName, "git.sr.ht", query, &resp)
+		if err != nil {
+			notFound("create repository", err)
+		} else if len(resp.Errors) > 0 {
+			errs := []error{}
+			for i := range resp.Errors {
+				errs = append(errs, &resp.Errors[i])
 			}
-		} else if err != nil {
-			log.Println("A temporary error has occured. Please try again.")
-			logger.Fatal("Error occured looking up repo: %v", err)
-		} else {
-			log.Printf("\033[93mNOTICE\033[0m: This repository has moved.")
-			log.Printf("Please update your remote to:")
-			log.Println()
-			log.Printf("\t%s/~%s/%s", origin, repoOwnerName, repoName)
-			log.Println()
-			os.Exit(128)
+			notFound("create repository", errs...)
 		}
+		repo = &access.Repo{
+			ID:         resp.Data.CreateRepository.ID,
+			Name:       repoName,
+			OwnerID:    pusherId,
+			OwnerName:  pusherName,
+			EntityName: pusherName,
+			Path:       path,
+			Visibility: "private",
+		}
+		autocreated = true
+		logger.Printf("Autocreated repo %s", path)
 	}
 
 	agrant := ""
+	orole := ""
 	snotice := ""
-	if accessGrant != nil {
-		agrant = *accessGrant
+	if repo.AccessGrant != nil {
+		agrant = *repo.AccessGrant
+	}
+	if repo.OrgRole != nil {
+		orole = *repo.OrgRole
 	}
 	if pusherSuspendNotice != nil {
 		snotice = *pusherSuspendNotice
 	}
 	logger.Printf("repo ID %d; name '%s'; owner ID %d; owner name '%s'; "+
 		"visibility '%s'; pusher type '%s'; pusher suspension notice '%s'; "+
-		"access grant '%s'", repoId, repoName, repoOwnerId, repoOwnerName,
-		repoVisibility, pusherType, snotice, agrant)
+		"access grant '%s'; organization role '%s'", repo.ID, repo.Name,
+		repo.OwnerID, repo.OwnerName, repo.Visibility, pusherType, snotice,
+		agrant, orole)
 
 	// We have everything we need, now we find out if the user is allowed to do
 	// what they're trying to do.
-	hasAccess := ACCESS_NONE
-	if pusherId == repoOwnerId {
-		hasAccess = ACCESS_READ | ACCESS_WRITE | ACCESS_MANAGE
-	} else {
-		if accessGrant == nil {
-			switch repoVisibility {
-			case "public":
-				fallthrough
-			case "unlisted":
-				hasAccess = ACCESS_READ
-			case "private":
-				fallthrough
-			default:
-				hasAccess = ACCESS_NONE
-			}
-		} else {
-			switch *accessGrant {
-			case "ro":
-				hasAccess = ACCESS_READ
-			case "rw":
-				hasAccess = ACCESS_READ | ACCESS_WRITE
-			default:
-				hasAccess = ACCESS_NONE
-			}
-		}
-	}
-
+	hasAccess := repo.Access(pusherId)
 	if needsAccess&hasAccess != needsAccess {
 		logger.Println("Access denied.")
 		log.Println("Access denied.")
@@ -378,6 +305,13 @@ func main() {
 		os.Exit(128)
 	}
 
+	if needsAccess == access.WRITE && repo.MirrorURL != nil {
+		logger.Println("Rejecting push to mirror.")
+		log.Println("This repository is a mirror and does not accept pushes.")
+		log.Println()
+		os.Exit(128)
+	}
+
 	// At this point, we know they're allowed to execute this operation. We
 	// gather some of the information we've collected so far into a "push
 	// context" so that steps later in the pipeline don't have to repeat our
@@ -386,6 +320,7 @@ func main() {
 		Id           int    `json:"id"`
 		Name         string `json:"name"`
 		OwnerId      int    `json:"owner_id"`
+		OrgId        *int   `json:"org_id,omitempty"`
 		OwnerName    string `json:"owner_name"`
 		Path         string `json:"path"`
 		AbsolutePath string `json:"absolute_path"`
@@ -403,13 +338,14 @@ func main() {
 		User UserContext `json:"user"`
 	}{
 		Repo: RepoContext{
-			Id:           repoId,
-			Name:         repoName,
-			OwnerId:      repoOwnerId,
-			OwnerName:    repoOwnerName,
+			Id:           repo.ID,
+			Name:         repo.Name,
+			OwnerId:      repo.OwnerID,
+			OrgId:        repo.OrgID,
+			OwnerName:    repo.EntityName,
 			Path:         path,
 			AbsolutePath: absPath,
-			Visibility:   repoVisibility,
+			Visibility:   repo.Visibility,
 			Autocreated:  autocreated,
 		},
 		User: UserContext{
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Returns true if old is an ancestor of new. This shells out to git so that
+// objects in the pre-receive quarantine area are taken into account.
+func isAncestor(old, new string) (bool, error) {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", old, new)
+	err := cmd.Run()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	return false, err
+}
+
+// Returns the commits reachable from new which are not reachable from any
+// existing ref, i.e. those which are introduced by a push.
+func newCommits(new string) ([]*object.Commit, error) {
+	out, err := exec.Command("git", "rev-list", new, "--not", "--all").Output()
+	if err != nil {
+		return nil, err
+	}
+	objs, err := readObjects(strings.Fields(string(out)))
+	if err != nil {
+		return nil, err
+	}
+	commits := make([]*object.Commit, len(objs))
+	for i, obj := range objs {
+		commits[i] = &object.Commit{}
+		if err := commits[i].Decode(obj); err != nil {
+			return nil, err
+		}
+	}
+	return commits, nil
+}
+
+// Reads the given objects with git cat-file, which, unlike go-git, takes the
+// pre-receive quarantine area into account.
+func readObjects(ids []string) ([]plumbing.EncodedObject, error) {
+	objs := make([]plumbing.EncodedObject, len(ids))
+	if err := eachObject(ids, func(i int, obj plumbing.EncodedObject) error {
+		objs[i] = obj
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+// Like readObjects, but calls fn with each object in turn, so that only one is
+// held in memory at a time.
+func eachObject(ids []string,
+	fn func(i int, obj plumbing.EncodedObject) error) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	cmd := exec.Command("git", "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(strings.Join(ids, "\n") + "\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		// cat-file may be blocked writing to stdout if we return early
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	reader := bufio.NewReader(stdout)
+	for i := range ids {
+		// "<id> <type> <size>\n<contents>\n"
+		var id, typ string
+		var size int64
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Sscanf(header, "%s %s %d", &id, &typ, &size); err != nil {
+			return fmt.Errorf("git cat-file: unexpected output %q", header)
+		}
+		t, err := plumbing.ParseObjectType(typ)
+		if err != nil {
+			return err
+		}
+		obj := &plumbing.MemoryObject{}
+		obj.SetType(t)
+		obj.SetSize(size)
+		if _, err := io.CopyN(obj, reader, size); err != nil {
+			return err
+		}
+		if _, err := reader.Discard(1); err != nil {
+			return err
+		}
+		if err := fn(i, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type NewObject struct {
+	Hash string
+	Type string
+	Size int64
+	// The path at which the object was first found, if any
+	Path string
+}
+
+// Returns the objects reachable from new which are not reachable from any
+// existing ref, i.e. those which are introduced by a push.
+func newObjects(new string) ([]NewObject, error) {
+	out, err := exec.Command("git", "rev-list", "--objects",
+		new, "--not", "--all").Output()
+	if err != nil {
+		return nil, err
+	}
+	var objs []NewObject
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		obj := NewObject{Hash: parts[0]}
+		if len(parts) == 2 {
+			obj.Path = parts[1]
+		}
+		objs = append(objs, obj)
+		ids = append(ids, obj.Hash)
+	}
+	if len(objs) == 0 {
+		return nil, nil
+	}
+
+	cmd := exec.Command("git", "cat-file",
+		"--batch-check=%(objectname) %(objecttype) %(objectsize)")
+	cmd.Stdin = strings.NewReader(strings.Join(ids, "\n") + "\n")
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != len(objs) {
+		return nil, fmt.Errorf("git cat-file: expected %d objects, got %d",
+			len(objs), len(lines))
+	}
+	for i, line := range lines {
+		var id string
+		if _, err := fmt.Sscanf(line, "%s %s %d",
+			&id, &objs[i].Type, &objs[i].Size); err != nil || id != objs[i].Hash {
+			return nil, fmt.Errorf("git cat-file: unexpected output %q", line)
+		}
+	}
+	return objs, nil
+}
+
+// Caches the objects introduced by each ref update, which several checks
+// need, so that each is only listed once per push.
+type pushObjects map[string][]NewObject
+
+// Returns the objects reachable from new which are not reachable from any
+// existing ref. See newObjects.
+func (p pushObjects) get(new string) ([]NewObject, error) {
+	if objs, ok := p[new]; ok {
+		return objs, nil
+	}
+	objs, err := newObjects(new)
+	if err != nil {
+		return nil, err
+	}
+	p[new] = objs
+	return objs, nil
+}
+
+// Returns the paths which are added or modified by the commits reachable from
+// new which are not reachable from any existing ref, compared with their
+// parents. Merge commits are compared with all of their parents at once, so
+// that files merged in from another branch are not included.
+func changedPaths(new string) ([]string, error) {
+	revs, err := exec.Command("git", "rev-list", new, "--not", "--all").Output()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "diff-tree", "--stdin", "-r", "-c", "--root",
+		"--no-renames", "--diff-filter=AMR", "--no-commit-id", "--name-only",
+		"-z")
+	cmd.Stdin = bytes.NewReader(revs)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	seen := make(map[string]struct{})
+	for _, p := range strings.Split(string(out), "\x00") {
+		if _, ok := seen[p]; ok || p == "" {
+			continue
+		}
+		seen[p] = struct{}{}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
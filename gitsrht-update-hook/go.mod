@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	git.sr.ht/~sircmpwn/core-go v0.0.0-20220113153027-e7ae287d2fec
+	git.sr.ht/~sircmpwn/git.sr.ht/internal v0.0.0-00010101000000-000000000000
 	git.sr.ht/~turminal/go-fnmatch v0.0.0-20211021204744-1a55764af6de
 	github.com/fernet/fernet-go v0.0.0-20191111064656-eff2850e6001
 	github.com/go-git/go-git/v5 v5.1.0
@@ -18,3 +19,5 @@ require (
 	github.com/vektah/gqlparser v1.3.1
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+replace git.sr.ht/~sircmpwn/git.sr.ht/internal => ../internal
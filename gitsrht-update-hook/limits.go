@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~turminal/go-fnmatch"
+)
+
+type PushLimits struct {
+	MaxBlobSize    int64
+	ForbiddenPaths []string
+	MaxRepoSize    int64
+}
+
+// Parses a size in bytes, optionally with a K, M or G suffix, e.g. 100M.
+func parseSize(size string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B")
+	var shift uint
+	switch {
+	case strings.HasSuffix(s, "K"):
+		shift = 10
+	case strings.HasSuffix(s, "M"):
+		shift = 20
+	case strings.HasSuffix(s, "G"):
+		shift = 30
+	}
+	if shift != 0 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	return n << shift, nil
+}
+
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// Returns the limits which apply to every push to this instance, per the
+// [git.sr.ht] max-blob-size, forbidden-paths and max-repo-size options.
+func instanceLimits() (PushLimits, error) {
+	var limits PushLimits
+	for key, dest := range map[string]*int64{
+		"max-blob-size": &limits.MaxBlobSize,
+		"max-repo-size": &limits.MaxRepoSize,
+	} {
+		s, ok := config.Get("git.sr.ht", key)
+		if !ok || s == "" {
+			continue
+		}
+		n, err := parseSize(s)
+		if err != nil {
+			return limits, fmt.Errorf("Invalid [git.sr.ht]%s: %v", key, err)
+		}
+		*dest = n
+	}
+	if s, ok := config.Get("git.sr.ht", "forbidden-paths"); ok {
+		limits.ForbiddenPaths = strings.Fields(s)
+	}
+	return limits, nil
+}
+
+// Returns the stricter of two limits, where zero means no limit.
+func minLimit(a, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Returns true if the path matches any of the patterns. Like gitignore,
+// patterns without a slash are matched against the file name, and others
+// against the full path.
+func pathForbidden(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		name := path.Base(p)
+		if strings.Contains(pattern, "/") {
+			pattern = strings.TrimPrefix(pattern, "/")
+			name = p
+		}
+		if fnmatch.Match(pattern, name, fnmatch.FNM_PATHNAME) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the size of the repository's objects on disk. During pre-receive,
+// this includes the objects in the quarantine area.
+func repoSize(repoPath string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path.Join(repoPath, "objects"),
+		func(_ string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				// Removed concurrently, e.g. by git gc
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				size += info.Size()
+			}
+			return nil
+		})
+	return size, err
+}
+
+// Checks the files introduced by each ref update against the instance's and
+// the repository's size limits and forbidden paths, and returns a list of
+// updates which must be rejected.
+func checkPushLimits(context PushContext, policy *PushPolicy,
+	objects pushObjects, updates []RefUpdate) ([]Rejection, error) {
+	limits, err := instanceLimits()
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		limits.MaxBlobSize = minLimit(limits.MaxBlobSize, policy.MaxBlobSize)
+		limits.MaxRepoSize = minLimit(limits.MaxRepoSize, policy.MaxRepoSize)
+		limits.ForbiddenPaths = append(limits.ForbiddenPaths,
+			policy.ForbiddenPaths...)
+	}
+
+	var rejections []Rejection
+	for _, update := range updates {
+		if update.IsDelete() {
+			continue
+		}
+		if reason, err := limits.check(objects, update); err != nil {
+			return nil, err
+		} else if reason != "" {
+			rejections = append(rejections, Rejection{update.Name, reason})
+		}
+	}
+
+	if limits.MaxRepoSize != 0 {
+		size, err := repoSize(context.Repo.AbsolutePath)
+		if err != nil {
+			return nil, err
+		}
+		if size > limits.MaxRepoSize {
+			for _, update := range updates {
+				if update.IsDelete() {
+					continue
+				}
+				rejections = append(rejections, Rejection{update.Name,
+					fmt.Sprintf("This push would grow the repository to %s, "+
+						"exceeding its quota of %s", formatSize(size),
+						formatSize(limits.MaxRepoSize))})
+			}
+		}
+	}
+	return rejections, nil
+}
+
+// Returns the reason to reject the ref update, or an empty string if the files
+// which it introduces are within the file size limit and are not at forbidden
+// paths.
+func (limits *PushLimits) check(objects pushObjects,
+	update RefUpdate) (string, error) {
+	if len(limits.ForbiddenPaths) != 0 {
+		paths, err := changedPaths(update.New)
+		if err != nil {
+			return "", err
+		}
+		for _, p := range paths {
+			if pathForbidden(limits.ForbiddenPaths, p) {
+				return fmt.Sprintf("File %s is not permitted", p), nil
+			}
+		}
+	}
+
+	if limits.MaxBlobSize != 0 {
+		objs, err := objects.get(update.New)
+		if err != nil {
+			return "", err
+		}
+		for _, obj := range objs {
+			if obj.Type != "blob" || obj.Size <= limits.MaxBlobSize {
+				continue
+			}
+			name := obj.Path
+			if name == "" {
+				name = obj.Hash
+			}
+			return fmt.Sprintf("File %s (%s) exceeds the maximum file size of %s",
+				name, formatSize(obj.Size), formatSize(limits.MaxBlobSize)), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"100":   100,
+		"2K":    2 << 10,
+		"10MB":  10 << 20,
+		" 1g ":  1 << 30,
+		"64kib": -1,
+		"-1":    -1,
+		"M":     -1,
+	} {
+		got, err := parseSize(s)
+		if want == -1 {
+			if err == nil {
+				t.Errorf("expected an error for %q, got %d", s, got)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("%q: got %d, %v, want %d", s, got, err, want)
+		}
+	}
+}
+
+func TestPathForbidden(t *testing.T) {
+	patterns := []string{"*.pem", "/config/.env", "secrets/*"}
+	for p, want := range map[string]bool{
+		"key.pem":             true,
+		"certs/key.pem":       true,
+		"config/.env":         true,
+		"src/config/.env":     false,
+		"secrets/token":       true,
+		"secrets/sub/token":   false,
+		"README.md":           false,
+		"key.pem.example.txt": false,
+	} {
+		if got := pathForbidden(patterns, p); got != want {
+			t.Errorf("%s: got %v, want %v", p, got, want)
+		}
+	}
+}
+
+// Commits the given files on a new branch, which is then deleted so that its
+// commits are new to the repository, as they are in pre-receive. Returns the
+// ID of the last commit.
+func commitFiles(t *testing.T, dir string, run func(args ...string) string,
+	files map[string]string, merge ...string) string {
+	t.Helper()
+	run("checkout", "--quiet", "-b", "incoming")
+	if len(merge) != 0 {
+		run(append([]string{"merge", "--quiet", "--no-ff", "-m", "Merge"},
+			merge...)...)
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, name),
+			[]byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run("add", "--all")
+	run("commit", "--quiet", "--allow-empty", "-m", "Incoming")
+	id := run("rev-parse", "HEAD")
+	run("checkout", "--quiet", "master")
+	run("branch", "--quiet", "-D", "incoming")
+	return id
+}
+
+func TestPushLimitsCheck(t *testing.T) {
+	dir, run := testRepo(t)
+	run("symbolic-ref", "HEAD", "refs/heads/master")
+	if err := ioutil.WriteFile(path.Join(dir, "key.txt"),
+		[]byte("not a key\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "key.txt")
+	run("commit", "--quiet", "-m", "First")
+	// A forbidden file which was pushed before the limits were configured
+	run("checkout", "--quiet", "-b", "legacy")
+	if err := ioutil.WriteFile(path.Join(dir, "legacy.pem"),
+		[]byte("legacy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "legacy.pem")
+	run("commit", "--quiet", "-m", "Legacy")
+	run("checkout", "--quiet", "master")
+
+	limits := &PushLimits{
+		MaxBlobSize:    16,
+		ForbiddenPaths: []string{"*.pem"},
+	}
+	objects := make(pushObjects)
+	check := func(new string) string {
+		t.Helper()
+		reason, err := limits.check(objects,
+			RefUpdate{Name: "refs/heads/master", New: new})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return reason
+	}
+
+	if reason := check(commitFiles(t, dir, run,
+		map[string]string{"README": "Hello\n"})); reason != "" {
+		t.Errorf("unexpected rejection: %s", reason)
+	}
+	if reason := check(commitFiles(t, dir, run,
+		map[string]string{"certs/new.pem": "new\n"})); reason !=
+		"File certs/new.pem is not permitted" {
+		t.Errorf("unexpected reason for a new file: %q", reason)
+	}
+	// The blob is not new, but the path is
+	run("mv", "key.txt", "key.pem")
+	if reason := check(commitFiles(t, dir, run, nil)); reason !=
+		"File key.pem is not permitted" {
+		t.Errorf("unexpected reason for a renamed file: %q", reason)
+	}
+	run("reset", "--quiet", "--hard")
+	// Files merged in from existing history are not checked again
+	if reason := check(commitFiles(t, dir, run, nil, "legacy")); reason != "" {
+		t.Errorf("unexpected rejection of a merge: %s", reason)
+	}
+	if reason := check(commitFiles(t, dir, run, map[string]string{
+		"big.txt": strings.Repeat("x", 17),
+	})); reason != "File big.txt (17 bytes) exceeds the maximum file size "+
+		"of 16 bytes" {
+		t.Errorf("unexpected reason for a large file: %q", reason)
+	}
+}
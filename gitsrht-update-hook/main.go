@@ -19,6 +19,7 @@ var (
 func main() {
 	log.SetFlags(0)
 	logger.Printf("%v", os.Args)
+	loadConfig()
 	// The update hook is run on the update and post-update git hooks, and also
 	// runs a third stage directly. The first two stages are performance
 	// critical and take place while the user is blocked at their terminal. The
@@ -46,7 +47,12 @@ func init() {
 	} else {
 		logger = log.New(logf, os.Args[0]+" ", log.LstdFlags)
 	}
+}
 
+// Loads the configuration. This is done in main, rather than init, so that the
+// tests can run without a config file.
+func loadConfig() {
+	var err error
 	for _, path := range []string{os.Getenv("SRHT_CONFIG"), "/etc/sr.ht/config.ini"} {
 		config, err = ini.LoadFile(path)
 		if err == nil {
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	nethttp "net/http"
+	"syscall"
+	"time"
+
+	"git.sr.ht/~sircmpwn/core-go/crypto"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/netutil"
+)
+
+type PushMirror struct {
+	Id                int
+	Url               string
+	Username          *string
+	EncryptedPassword []byte
+}
+
+// The API only accepts push mirrors on public addresses, but a mirror's host
+// may since have been pointed elsewhere, so this is checked again for each
+// connection.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || netutil.IsPrivateIP(ip) {
+		return fmt.Errorf("Refusing to connect to non-public address %s", host)
+	}
+	return nil
+}
+
+func installMirrorTransport() {
+	transport := http.NewClient(&nethttp.Client{
+		Transport: &nethttp.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: 30 * time.Second,
+				Control: refusePrivateAddress,
+			}).DialContext,
+			TLSHandshakeTimeout: 30 * time.Second,
+		},
+	})
+	client.InstallProtocol("http", transport)
+	client.InstallProtocol("https", transport)
+}
+
+// Pushes the references updated by this push to each of the repository's
+// push mirrors, and records the outcome of each attempt.
+func updatePushMirrors(pctx *PushContext, db *sql.DB,
+	pushUuid string, payload *WebhookPayload) {
+	rows, err := db.Query(`
+		SELECT id, url, username, encrypted_password
+		FROM push_mirror
+		WHERE repo_id = $1;`, pctx.Repo.Id)
+	if err != nil {
+		logger.Fatalf("Error fetching push mirrors: %v", err)
+	}
+	defer rows.Close()
+
+	var mirrors []PushMirror
+	for rows.Next() {
+		var pm PushMirror
+		if err := rows.Scan(&pm.Id, &pm.Url, &pm.Username,
+			&pm.EncryptedPassword); err != nil {
+			logger.Fatalf("Scanning push mirror rows: %v", err)
+		}
+		mirrors = append(mirrors, pm)
+	}
+	if len(mirrors) == 0 {
+		return
+	}
+
+	var refspecs []gitconfig.RefSpec
+	for _, ref := range payload.Refs {
+		if ref.Name == "" {
+			// Skipped by postUpdate
+			continue
+		}
+		if ref.New == nil {
+			refspecs = append(refspecs, gitconfig.RefSpec(":"+ref.Name))
+		} else {
+			refspecs = append(refspecs,
+				gitconfig.RefSpec("+"+ref.Name+":"+ref.Name))
+		}
+	}
+	if len(refspecs) == 0 {
+		logger.Println("No references to push to mirrors")
+		return
+	}
+
+	repo, err := git.PlainOpen(pctx.Repo.AbsolutePath)
+	if err != nil {
+		logger.Fatalf("git.PlainOpen(%q): %v", pctx.Repo.AbsolutePath, err)
+	}
+
+	installMirrorTransport()
+	for _, pm := range mirrors {
+		status, output := "success", ""
+		if err := pushMirror(repo, &pm, refspecs, &output); err != nil {
+			logger.Printf("Error updating push mirror %s: %v", pm.Url, err)
+			status = "failure"
+			if output != "" {
+				output += "\n"
+			}
+			output += err.Error()
+		} else {
+			logger.Printf("Updated push mirror %s", pm.Url)
+		}
+
+		if _, err := db.Exec(`
+			INSERT INTO push_mirror_attempt (
+				created, push_mirror_id, push_uuid, status, output
+			) VALUES (
+				NOW() AT TIME ZONE 'UTC', $1, $2, $3, $4
+			);
+		`, pm.Id, pushUuid, status, output); err != nil {
+			logger.Fatalf("Error recording push mirror attempt: %v", err)
+		}
+	}
+}
+
+func pushMirror(repo *git.Repository, pm *PushMirror,
+	refspecs []gitconfig.RefSpec, output *string) error {
+	var auth transport.AuthMethod
+	if pm.Username != nil || pm.EncryptedPassword != nil {
+		basic := &http.BasicAuth{}
+		if pm.Username != nil {
+			basic.Username = *pm.Username
+		}
+		if pm.EncryptedPassword != nil {
+			password := crypto.DecryptWithoutExpiration(pm.EncryptedPassword)
+			if password == nil {
+				return fmt.Errorf("Unable to decrypt push mirror credentials")
+			}
+			basic.Password = string(password)
+		}
+		auth = basic
+	}
+
+	remote := git.NewRemote(repo.Storer, &gitconfig.RemoteConfig{
+		Name: "push-mirror",
+		URLs: []string{pm.Url},
+	})
+
+	var progress bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	err := remote.PushContext(ctx, &git.PushOptions{
+		RemoteName: "push-mirror",
+		RefSpecs:   refspecs,
+		Auth:       auth,
+		Progress:   &progress,
+	})
+	*output = ansi.ReplaceAllString(progress.String(), "")
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
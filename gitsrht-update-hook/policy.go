@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"git.sr.ht/~turminal/go-fnmatch"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/lib/pq"
+)
+
+type PushPolicy struct {
+	RequiredTrailers []string
+	MessagePattern   *regexp.Regexp
+	MaxSubjectLength int
+	CommitterDomains []string
+	NoMergeRefs      []string
+
+	MaxBlobSize    int64
+	ForbiddenPaths []string
+	MaxRepoSize    int64
+
+	// Empty if the instance default applies
+	SecretScanning string
+}
+
+// Returns the repository's push policy, or nil if it does not have one.
+func fetchPushPolicy(db *sql.DB, repoId int) (*PushPolicy, error) {
+	var (
+		policy           PushPolicy
+		messagePattern   sql.NullString
+		maxSubjectLength sql.NullInt64
+		maxBlobSize      sql.NullInt64
+		maxRepoSize      sql.NullInt64
+		secretScanning   sql.NullString
+	)
+	err := db.QueryRow(`
+		SELECT
+			required_trailers,
+			message_pattern,
+			max_subject_length,
+			committer_domains,
+			no_merge_refs,
+			max_blob_size,
+			forbidden_paths,
+			max_repo_size,
+			secret_scanning
+		FROM push_policy
+		WHERE repo_id = $1;
+	`, repoId).Scan(pq.Array(&policy.RequiredTrailers), &messagePattern,
+		&maxSubjectLength, pq.Array(&policy.CommitterDomains),
+		pq.Array(&policy.NoMergeRefs), &maxBlobSize,
+		pq.Array(&policy.ForbiddenPaths), &maxRepoSize, &secretScanning)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if messagePattern.Valid {
+		policy.MessagePattern, err = regexp.Compile(messagePattern.String)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid message pattern: %v", err)
+		}
+	}
+	policy.MaxSubjectLength = int(maxSubjectLength.Int64)
+	policy.MaxBlobSize = maxBlobSize.Int64
+	policy.MaxRepoSize = maxRepoSize.Int64
+	policy.SecretScanning = secretScanning.String
+	return &policy, nil
+}
+
+// Checks each commit introduced by the ref updates against the repository's
+// push policy and returns a list of updates which must be rejected.
+func checkPushPolicy(policy *PushPolicy,
+	updates []RefUpdate) ([]Rejection, error) {
+	if policy == nil {
+		return nil, nil
+	}
+
+	var rejections []Rejection
+	for _, update := range updates {
+		if update.IsDelete() {
+			continue
+		}
+		commits, err := newCommits(update.New)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range commits {
+			if reason := policy.check(update, c); reason != "" {
+				rejections = append(rejections, Rejection{update.Name,
+					fmt.Sprintf("Commit %s %s", c.Hash.String()[:7], reason)})
+				break
+			}
+		}
+	}
+	return rejections, nil
+}
+
+// Returns the reason to reject the commit, or an empty string if it conforms
+// to the policy.
+func (p *PushPolicy) check(update RefUpdate, c *object.Commit) string {
+	if len(c.ParentHashes) > 1 {
+		for _, pattern := range p.NoMergeRefs {
+			if fnmatch.Match(pattern, update.Name, fnmatch.FNM_PATHNAME) {
+				return "is a merge commit, which is not permitted on this ref"
+			}
+		}
+	}
+
+	if len(p.CommitterDomains) != 0 {
+		email := strings.ToLower(c.Committer.Email)
+		var allowed bool
+		for _, domain := range p.CommitterDomains {
+			if strings.HasSuffix(email, "@"+domain) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("has a committer email address (%s) outside "+
+				"of the permitted domains", c.Committer.Email)
+		}
+	}
+
+	subject := strings.SplitN(c.Message, "\n", 2)[0]
+	if p.MaxSubjectLength != 0 &&
+		utf8.RuneCountInString(subject) > p.MaxSubjectLength {
+		return fmt.Sprintf("has a subject longer than %d characters",
+			p.MaxSubjectLength)
+	}
+
+	if p.MessagePattern != nil && !p.MessagePattern.MatchString(c.Message) {
+		return fmt.Sprintf("does not have a message matching %s",
+			p.MessagePattern.String())
+	}
+
+	trailers := commitTrailers(c.Message)
+	for _, trailer := range p.RequiredTrailers {
+		if _, ok := trailers[strings.ToLower(trailer)]; !ok {
+			return fmt.Sprintf("does not have a %s trailer", trailer)
+		}
+	}
+	return ""
+}
+
+// Returns the set of trailer keys (in lower case) in the last paragraph of a
+// commit message, e.g. "signed-off-by" for "Signed-off-by: Jane <jane@...>".
+func commitTrailers(message string) map[string]struct{} {
+	trailers := make(map[string]struct{})
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	if len(paragraphs) < 2 {
+		// The subject line is never a trailer
+		return trailers
+	}
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			continue
+		}
+		key := line[:i]
+		if strings.ContainsAny(key, " \t") {
+			continue
+		}
+		trailers[strings.ToLower(key)] = struct{}{}
+	}
+	return trailers
+}
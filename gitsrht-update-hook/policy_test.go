@@ -0,0 +1,75 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestPushPolicyCheck(t *testing.T) {
+	policy := &PushPolicy{
+		RequiredTrailers: []string{"Signed-off-by"},
+		MessagePattern:   regexp.MustCompile(`^[a-z]+: `),
+		MaxSubjectLength: 30,
+		CommitterDomains: []string{"example.org"},
+		NoMergeRefs:      []string{"refs/heads/release/*"},
+	}
+	commit := func(email, message string, parents int) *object.Commit {
+		return &object.Commit{
+			Committer:    object.Signature{Email: email},
+			Message:      message,
+			ParentHashes: make([]plumbing.Hash, parents),
+		}
+	}
+	master := RefUpdate{Name: "refs/heads/master"}
+	release := RefUpdate{Name: "refs/heads/release/1.0"}
+	good := "api: Fix a bug\n\nSigned-off-by: Jane <jane@example.org>\n"
+
+	for _, tc := range []struct {
+		update RefUpdate
+		commit *object.Commit
+		want   string
+	}{
+		{master, commit("jane@example.org", good, 1), ""},
+		{master, commit("Jane@Example.org", good, 2), ""},
+		{release, commit("jane@example.org", good, 2),
+			"is a merge commit, which is not permitted on this ref"},
+		{master, commit("jane@example.com", good, 1),
+			"has a committer email address (jane@example.com) outside of " +
+				"the permitted domains"},
+		{master, commit("jane@example.org",
+			"api: Fix a bug with a very long subject\n\nSigned-off-by: Jane\n", 1),
+			"has a subject longer than 30 characters"},
+		{master, commit("jane@example.org",
+			"Fix a bug\n\nSigned-off-by: Jane\n", 1),
+			"does not have a message matching ^[a-z]+: "},
+		{master, commit("jane@example.org", "api: Fix a bug\n", 1),
+			"does not have a Signed-off-by trailer"},
+	} {
+		if got := policy.check(tc.update, tc.commit); got != tc.want {
+			t.Errorf("%q on %s: got %q, want %q",
+				tc.commit.Message, tc.update.Name, got, tc.want)
+		}
+	}
+}
+
+func TestCommitTrailers(t *testing.T) {
+	for message, want := range map[string][]string{
+		"Subject: not a trailer\n":                        nil,
+		"Subject\n\nBody\n\nSigned-off-by: A\nFixes: 1\n": {"signed-off-by", "fixes"},
+		"Subject\n\nNot a trailer: the key has spaces\n":  nil,
+	} {
+		got := commitTrailers(message)
+		if len(got) != len(want) {
+			t.Errorf("%q: got %v, want %v", message, got, want)
+			continue
+		}
+		for _, key := range want {
+			if _, ok := got[key]; !ok {
+				t.Errorf("%q: missing trailer %s", message, key)
+			}
+		}
+	}
+}
@@ -22,6 +22,8 @@ import (
 	goredis "github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
 	"github.com/vektah/gqlparser/gqlerror"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/sigverify"
 )
 
 func printAutocreateInfo(context PushContext) {
@@ -44,9 +46,12 @@ type DbInfo struct {
 	OwnerToken    *string
 	AsyncWebhooks []WebhookSubscription
 	SyncWebhooks  []WebhookSubscription
+	PushMirrors   int
+	// Secret findings recorded for this push in pre-receive
+	SecretFindings int
 }
 
-func fetchInfoForPush(db *sql.DB, username string, repoId int, repoName string,
+func fetchInfoForPush(db *sql.DB, pushUuid string, username string, repoId int, repoName string,
 	repoVisibility string, newDescription *string, newVisibility *string) (DbInfo, error) {
 	var dbinfo DbInfo = DbInfo{
 		RepoId:     repoId,
@@ -93,30 +98,43 @@ func fetchInfoForPush(db *sql.DB, username string, repoId int, repoName string,
 	}
 
 	// With this query, we:
-	// 1. Fetch the owner's username and OAuth token
+	// 1. Fetch the acting user's username and OAuth token
 	// 2. Determine how many webhooks this repo has: if there are zero sync
 	//    webhooks then we can defer looking them up until after we've sent the
 	//    user on their way.
+	// 3. Determine how many push mirrors this repo has, which are updated in
+	//    stage 3.
+	// 4. Determine how many secrets were found in this push, for which
+	//    webhooks are delivered in stage 3.
 
 	query, err := db.Prepare(`
 		WITH owner AS (
 			SELECT "user".username, "user".oauth_token
 			FROM "user"
-			JOIN repository r ON r.owner_id = "user".id
-			WHERE r.id = $1
+			WHERE "user".username = $2
 		), webhooks AS (
 			SELECT
 				COUNT(*) FILTER(WHERE rws.sync = true) sync_count,
 				COUNT(*) FILTER(WHERE rws.sync = false) async_count
 			FROM repo_webhook_subscription rws
 			WHERE rws.repo_id = $1 AND rws.events LIKE '%repo:post-update%'
+		), mirrors AS (
+			SELECT COUNT(*) mirror_count
+			FROM push_mirror pm
+			WHERE pm.repo_id = $1
+		), findings AS (
+			SELECT COUNT(*) finding_count
+			FROM secret_finding sf
+			WHERE sf.push_uuid = $3
 		)
 		SELECT
 			owner.username,
 			owner.oauth_token,
 			webhooks.sync_count,
-			webhooks.async_count
-		FROM owner, webhooks;
+			webhooks.async_count,
+			mirrors.mirror_count,
+			findings.finding_count
+		FROM owner, webhooks, mirrors, findings;
 	`)
 	if err != nil {
 		return dbinfo, err
@@ -124,8 +142,9 @@ func fetchInfoForPush(db *sql.DB, username string, repoId int, repoName string,
 	defer query.Close()
 
 	var nasync, nsync int
-	if err = query.QueryRow(repoId).Scan(&dbinfo.OwnerUsername,
-		&dbinfo.OwnerToken, &nsync, &nasync); err != nil {
+	if err = query.QueryRow(repoId, username, pushUuid).Scan(
+		&dbinfo.OwnerUsername, &dbinfo.OwnerToken, &nsync, &nasync,
+		&dbinfo.PushMirrors, &dbinfo.SecretFindings); err != nil {
 
 		return dbinfo, err
 	}
@@ -218,12 +237,18 @@ func postUpdate() {
 		logger.Fatalf("Failed to open a database connection: %v", err)
 	}
 
-	dbinfo, err := fetchInfoForPush(db, context.Repo.OwnerName, context.Repo.Id, context.Repo.Name, context.Repo.Visibility, newDescription, newVisibility)
+	// Organizations cannot act on their own behalf, so the pusher does
+	username := context.Repo.OwnerName
+	if context.Repo.OrgId != nil {
+		username = context.User.Name
+	}
+	dbinfo, err := fetchInfoForPush(db, pushUuid, username, context.Repo.Id, context.Repo.Name, context.Repo.Visibility, newDescription, newVisibility)
 	if err != nil {
 		logger.Fatalf("Failed to fetch info from database: %v", err)
 	}
 
 	refsDeleted := false
+	refsUpdated := false
 	redisHost, ok := config.Get("sr.ht", "redis-host")
 	if !ok {
 		redisHost = "redis://localhost:6379"
@@ -273,9 +298,12 @@ func postUpdate() {
 
 		var atag *AnnotatedTag = nil
 		if tag, ok := newobj.(*object.Tag); ok {
+			// go-git only splits PGP signatures from the message, and the
+			// message follows a blank line in the raw tag
+			message, _ := sigverify.SplitTag([]byte("\n" + tag.Message))
 			atag = &AnnotatedTag{
 				Name:    tag.Name,
-				Message: tag.Message,
+				Message: string(message[1:]),
 			}
 			newobj, err = repo.CommitObject(tag.Target)
 			if err != nil {
@@ -295,6 +323,7 @@ func postUpdate() {
 			Name: refname,
 			New:  GitCommitToWebhookCommit(commit),
 		}
+		refsUpdated = true
 
 		if oldobj != nil {
 			oldcommit, ok := oldobj.(*object.Commit)
@@ -315,8 +344,9 @@ func postUpdate() {
 				BuildOrigin: buildOrigin,
 				Commit:      commit,
 				GitOrigin:   origin,
-				OwnerName:   dbinfo.OwnerUsername,
+				OwnerName:   context.Repo.OwnerName,
 				OwnerToken:  dbinfo.OwnerToken,
+				Username:    dbinfo.OwnerUsername,
 				RepoName:    dbinfo.RepoName,
 				Repository:  repo,
 				Visibility:  dbinfo.Visibility,
@@ -390,12 +420,23 @@ func postUpdate() {
 		}
 	}
 
+	if err := addPayloadSignatures(&payload); err != nil {
+		logger.Printf("Error reading commit signatures: %v", err)
+	}
+	// Verifying signatures looks up keys on meta.sr.ht, which is left to
+	// stage 3 unless the pusher is waiting for synchronous webhooks anyway
+	if len(dbinfo.SyncWebhooks) != 0 {
+		verifyPayloadSignatures(&payload,
+			NewSignatureVerifier(db, context.User.Name))
+	}
+
 	payloadBytes, err := json.Marshal(&payload)
 	if err != nil {
 		logger.Fatalf("Failed to marshal webhook payload: %v", err)
 	}
 
-	deliveries := deliverWebhooks(dbinfo.SyncWebhooks, payloadBytes, true)
+	deliveries := deliverWebhooks(dbinfo.SyncWebhooks, "repo:post-update",
+		payloadBytes, true)
 	deliveriesJson, err := json.Marshal(deliveries)
 	if err != nil {
 		logger.Fatalf("Failed to marshal webhook deliveries: %v", err)
@@ -406,7 +447,9 @@ func postUpdate() {
 		logger.Fatal("No post-update script configured, cannot run stage 3")
 	}
 
-	if len(deliveries) == 0 && len(dbinfo.AsyncWebhooks) == 0 && !refsDeleted {
+	if len(deliveries) == 0 && len(dbinfo.AsyncWebhooks) == 0 &&
+		dbinfo.PushMirrors == 0 && dbinfo.SecretFindings == 0 &&
+		!refsDeleted && !refsUpdated {
 		logger.Println("Skipping stage 3, no work")
 		return
 	}
@@ -443,7 +486,8 @@ func postUpdate() {
 		log.Fatalf("Failed to execute stage 3: %v", err)
 	}
 
-	logger.Printf("Executing stage 3 to record %d sync deliveries and make "+
-		"%d async deliveries (pid %d)", len(deliveries),
-		len(dbinfo.AsyncWebhooks), pid)
+	logger.Printf("Executing stage 3 to record %d sync deliveries, make "+
+		"%d async deliveries, update %d push mirrors, and update the search "+
+		"index (pid %d)",
+		len(deliveries), len(dbinfo.AsyncWebhooks), dbinfo.PushMirrors, pid)
 }
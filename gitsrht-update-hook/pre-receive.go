@@ -1,21 +1,135 @@
 package main
 
 import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
 	"log"
 	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	_ "github.com/lib/pq"
 )
 
+type RefUpdate struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// Returns true if this update creates a new ref.
+func (u RefUpdate) IsCreate() bool {
+	return u.Old == plumbing.ZeroHash.String()
+}
+
+// Returns true if this update deletes an existing ref.
+func (u RefUpdate) IsDelete() bool {
+	return u.New == plumbing.ZeroHash.String()
+}
+
+type Rejection struct {
+	Ref    string
+	Reason string
+}
+
+func readRefUpdates() []RefUpdate {
+	var updates []RefUpdate
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 3 {
+			logger.Printf("Invalid pre-receive input: %q", scanner.Text())
+			continue
+		}
+		updates = append(updates, RefUpdate{
+			Old:  parts[0],
+			New:  parts[1],
+			Name: parts[2],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Fatalf("Failed to read ref updates: %v", err)
+	}
+	return updates
+}
+
+func printRejections(rejections []Rejection) {
+	log.Println("\n\t\033[91mPUSH REJECTED\033[0m")
+	log.Println()
+	for _, r := range rejections {
+		log.Printf("\t%s: %s", r.Ref, r.Reason)
+	}
+	log.Println()
+}
+
 func preReceive() {
-	// TODO: This would be a good place to enforce branch update restrictions
-	// and such, or to check OWNERS, etc.
-	pushUuid, ok := os.LookupEnv("SRHT_PUSH")
-	if !ok {
-		logger.Fatal("Missing SRHT_PUSH in environment, configuration error?")
+	var context PushContext
+	contextJson, ctxOk := os.LookupEnv("SRHT_PUSH_CTX")
+	pushUuid, pushOk := os.LookupEnv("SRHT_PUSH")
+	if !ctxOk || !pushOk {
+		logger.Fatal("Missing required variables in environment, " +
+			"configuration error?")
 	}
 	logger.Printf("Running pre-receive for push %s", pushUuid)
 
+	if err := json.Unmarshal([]byte(contextJson), &context); err != nil {
+		logger.Fatalf("unmarshal SRHT_PUSH_CTX: %v", err)
+	}
+
 	loadOptions()
 	if _, ok := options["debug"]; ok {
 		log.Printf("debug: %s", pushUuid)
 	}
+
+	updates := readRefUpdates()
+	if len(updates) == 0 {
+		return
+	}
+
+	db, err := sql.Open("postgres", pgcs)
+	if err != nil {
+		logger.Fatalf("Failed to open a database connection: %v", err)
+	}
+	defer db.Close()
+
+	rejections, err := checkProtectedRefs(db, context, updates)
+	if err != nil {
+		logger.Fatalf("Failed to check protected refs: %v", err)
+	}
+	policy, err := fetchPushPolicy(db, context.Repo.Id)
+	if err != nil {
+		logger.Fatalf("Failed to fetch push policy: %v", err)
+	}
+	objects := make(pushObjects)
+	policyRejections, err := checkPushPolicy(policy, updates)
+	if err != nil {
+		logger.Fatalf("Failed to check push policy: %v", err)
+	}
+	rejections = append(rejections, policyRejections...)
+	limitRejections, err := checkPushLimits(context, policy, objects, updates)
+	if err != nil {
+		logger.Fatalf("Failed to check push limits: %v", err)
+	}
+	rejections = append(rejections, limitRejections...)
+	findings, secretRejections, err := checkSecrets(policy, objects, updates)
+	if err != nil {
+		logger.Fatalf("Failed to scan for secrets: %v", err)
+	}
+	rejections = append(rejections, secretRejections...)
+
+	// Webhooks for findings are delivered in stage 3, if the push is accepted
+	if err := recordSecretFindings(db, context, pushUuid, findings,
+		len(rejections) != 0); err != nil {
+		logger.Fatalf("Failed to record secret findings: %v", err)
+	}
+
+	if len(rejections) != 0 {
+		for _, r := range rejections {
+			logger.Printf("Rejected update to %s by %s: %s",
+				r.Ref, context.User.CanonicalName, r.Reason)
+		}
+		printRejections(rejections)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"git.sr.ht/~turminal/go-fnmatch"
+)
+
+type ProtectedRef struct {
+	Pattern        string
+	AllowForcePush bool
+	AllowDeletion  bool
+	Restricted     bool
+	PusherAllowed  bool
+
+	RequireSignatures bool
+}
+
+func fetchProtectedRefs(db *sql.DB, repoId int,
+	pusher string) ([]ProtectedRef, error) {
+	rows, err := db.Query(`
+		SELECT
+			pr.pattern,
+			pr.allow_force_push,
+			pr.allow_deletion,
+			cardinality(pr.allowed_users) > 0,
+			COALESCE(pusher.id = ANY(pr.allowed_users), false),
+			pr.require_signatures
+		FROM protected_ref pr
+		LEFT JOIN "user" pusher ON pusher.username = $2
+		WHERE pr.repo_id = $1;
+	`, repoId, pusher)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []ProtectedRef
+	for rows.Next() {
+		var pr ProtectedRef
+		if err := rows.Scan(&pr.Pattern, &pr.AllowForcePush,
+			&pr.AllowDeletion, &pr.Restricted, &pr.PusherAllowed,
+			&pr.RequireSignatures); err != nil {
+			return nil, err
+		}
+		rules = append(rules, pr)
+	}
+	return rules, rows.Err()
+}
+
+// Checks each ref update against the repository's protected ref rules and
+// returns a list of updates which must be rejected.
+func checkProtectedRefs(db *sql.DB, context PushContext,
+	updates []RefUpdate) ([]Rejection, error) {
+	rules, err := fetchProtectedRefs(db, context.Repo.Id, context.User.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	return applyProtectedRefs(rules, NewSignatureVerifier(db, context.User.Name),
+		context, updates)
+}
+
+// Checks each ref update against the given protected ref rules and returns a
+// list of updates which must be rejected.
+func applyProtectedRefs(rules []ProtectedRef, verifier *SignatureVerifier,
+	context PushContext, updates []RefUpdate) ([]Rejection, error) {
+	var rejections []Rejection
+	for _, update := range updates {
+		for _, rule := range rules {
+			if !fnmatch.Match(rule.Pattern, update.Name, fnmatch.FNM_PATHNAME) {
+				continue
+			}
+
+			if rule.Restricted && !rule.PusherAllowed {
+				rejections = append(rejections, Rejection{update.Name,
+					"You are not permitted to update this ref"})
+				break
+			}
+
+			if update.IsDelete() {
+				if !rule.AllowDeletion {
+					rejections = append(rejections, Rejection{update.Name,
+						"Deleting this ref is not permitted"})
+					break
+				}
+				continue
+			}
+
+			if rule.RequireSignatures {
+				reason, err := checkSignatures(verifier, context, update)
+				if err != nil {
+					return nil, err
+				}
+				if reason != "" {
+					rejections = append(rejections, Rejection{update.Name, reason})
+					break
+				}
+			}
+
+			if update.IsCreate() || rule.AllowForcePush {
+				continue
+			}
+
+			if strings.HasPrefix(update.Name, "refs/tags/") {
+				rejections = append(rejections, Rejection{update.Name,
+					"Updating an existing tag is not permitted"})
+				break
+			}
+
+			ff, err := isAncestor(update.Old, update.New)
+			if err != nil {
+				return nil, err
+			}
+			if !ff {
+				rejections = append(rejections, Rejection{update.Name,
+					"Non-fast-forward updates are not permitted"})
+				break
+			}
+		}
+	}
+	return rejections, nil
+}
+
+// Checks that each commit introduced by the update is signed with one of the
+// pusher's keys, and returns the reason to reject the update if not.
+func checkSignatures(verifier *SignatureVerifier, context PushContext,
+	update RefUpdate) (string, error) {
+	commits, err := newCommits(update.New)
+	if err != nil {
+		return "", err
+	}
+	data, armored, err := signedData(commits...)
+	if err != nil {
+		return "", err
+	}
+	for i, c := range commits {
+		if armored[i] == "" {
+			return fmt.Sprintf("Commit %s is not signed",
+				c.Hash.String()[:7]), nil
+		}
+		signer, err := verifier.Verify(armored[i], data[i], c.Committer.Email)
+		if err != nil {
+			return "", err
+		}
+		if signer != context.User.Name {
+			return fmt.Sprintf("Commit %s is not signed with a key "+
+				"registered to your account", c.Hash.String()[:7]), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestApplyProtectedRefs(t *testing.T) {
+	dir, run := testRepo(t)
+	run("symbolic-ref", "HEAD", "refs/heads/master")
+	run("commit", "--quiet", "--allow-empty", "-m", "First")
+	first := run("rev-parse", "HEAD")
+	run("commit", "--quiet", "--allow-empty", "-m", "Second")
+	second := run("rev-parse", "HEAD")
+	// A new commit on top of master, and one which diverges from it
+	ff := commitFiles(t, dir, run, map[string]string{"README": "Hello\n"})
+	run("checkout", "--quiet", first)
+	diverged := commitFiles(t, dir, run, map[string]string{"README": "Bye\n"})
+	zero := plumbing.ZeroHash.String()
+
+	rules := []ProtectedRef{
+		{Pattern: "refs/heads/master"},
+		{Pattern: "refs/heads/release/*", Restricted: true},
+		{Pattern: "refs/tags/v*"},
+		{Pattern: "refs/heads/wip/*", AllowForcePush: true, AllowDeletion: true},
+		{Pattern: "refs/heads/signed", RequireSignatures: true},
+	}
+	updates := []RefUpdate{
+		{"refs/heads/master", second, ff},
+		{"refs/heads/master", second, diverged},
+		{"refs/heads/master", second, zero},
+		{"refs/heads/release/1.0", zero, ff},
+		{"refs/tags/v1.0", first, second},
+		{"refs/tags/v2.0", zero, second},
+		{"refs/heads/wip/topic", second, diverged},
+		{"refs/heads/wip/topic", second, zero},
+		{"refs/heads/signed", second, ff},
+		{"refs/heads/other", second, diverged},
+	}
+	want := []Rejection{
+		{"refs/heads/master", "Non-fast-forward updates are not permitted"},
+		{"refs/heads/master", "Deleting this ref is not permitted"},
+		{"refs/heads/release/1.0", "You are not permitted to update this ref"},
+		{"refs/tags/v1.0", "Updating an existing tag is not permitted"},
+		{"refs/heads/signed", "Commit " + ff[:7] + " is not signed"},
+	}
+
+	verifier := &SignatureVerifier{keys: testSignatureKeys{}}
+	context := PushContext{User: UserContext{Name: "alice"}}
+	rejections, err := applyProtectedRefs(rules, verifier, context, updates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rejections, want) {
+		t.Errorf("got rejections %+v, want %+v", rejections, want)
+	}
+
+	// Users on the list may update restricted refs
+	rules[1].PusherAllowed = true
+	rejections, err = applyProtectedRefs(rules[1:2], verifier, context,
+		updates[3:4])
+	if err != nil || rejections != nil {
+		t.Errorf("expected no rejections, got %+v, %v", rejections, err)
+	}
+}
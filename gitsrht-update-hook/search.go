@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/codesearch"
+)
+
+// When a push would add more than this many segments, the index is rebuilt
+// from scratch instead.
+const maxSearchSegments = 16
+
+// A new segment is started once the blobs in the current one add up to this
+// many bytes, which bounds the memory used to index large repositories.
+const maxSegmentContent = 64 * 1024 * 1024
+
+// Segments written by a rebuild are named with this prefix, and do not count
+// towards maxSearchSegments.
+const baseSegmentPrefix = "base-"
+
+// Indexes the blobs added by this push for code search. The entire index is
+// rebuilt if it does not exist yet or if it has accumulated too many segments.
+func updateSearchIndex(pctx *PushContext, payload *WebhookPayload) {
+	dir := path.Join(pctx.Repo.AbsolutePath, codesearch.IndexDir)
+	segments, err := filepath.Glob(path.Join(dir, "*.idx"))
+	if err != nil {
+		logger.Fatalf("Error listing search index segments: %v", err)
+	}
+	base, err := filepath.Glob(path.Join(dir, baseSegmentPrefix+"*.idx"))
+	if err != nil {
+		logger.Fatalf("Error listing search index segments: %v", err)
+	}
+
+	args := []string{"--objects", "--no-object-names"}
+	prefix := ""
+	rebuild := len(base) == 0 || len(segments)-len(base) >= maxSearchSegments
+	if rebuild {
+		args = append(args, "--all")
+		prefix = baseSegmentPrefix
+	} else {
+		var (
+			updated  []string
+			excluded []string
+		)
+		for _, ref := range payload.Refs {
+			if ref.New == nil {
+				continue
+			}
+			updated = append(updated, ref.New.Id)
+			if ref.Old != nil {
+				excluded = append(excluded, ref.Old.Id)
+			}
+			excluded = append(excluded, "--exclude="+ref.Name)
+		}
+		if len(updated) == 0 {
+			return
+		}
+		// Objects reachable from the other references were indexed by
+		// earlier pushes. Unlike --all, --glob does not include HEAD, which
+		// may point to one of the updated references.
+		args = append(args, updated...)
+		args = append(args, "--not")
+		args = append(args, excluded...)
+		args = append(args, "--glob=*")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Fatalf("Error creating search index directory: %v", err)
+	}
+	n, err := writeSearchSegments(pctx.Repo.AbsolutePath, dir, prefix, args)
+	if err != nil {
+		logger.Printf("Error updating search index: %v", err)
+		return
+	}
+	logger.Printf("Indexed %d blobs for code search", n)
+
+	if rebuild {
+		for _, segment := range segments {
+			if err := os.Remove(segment); err != nil {
+				logger.Printf("Error removing search index segment: %v", err)
+			}
+		}
+	}
+}
+
+// Indexes the blobs listed by git rev-list with the given arguments and writes
+// them to new segments in dir, whose names start with prefix. Returns the
+// number of blobs indexed. If an error occurs, the segments written so far
+// are removed.
+func writeSearchSegments(repoPath, dir, prefix string,
+	revList []string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	list := exec.CommandContext(ctx, "git", append([]string{
+		"-C", repoPath, "rev-list"}, revList...)...)
+	catFile := exec.CommandContext(ctx, "git", "-C", repoPath, "cat-file",
+		"--batch=%(objectname) %(objecttype) %(objectsize)")
+	var err error
+	if catFile.Stdin, err = list.StdoutPipe(); err != nil {
+		return 0, err
+	}
+	stdout, err := catFile.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := list.Start(); err != nil {
+		return 0, err
+	}
+	defer list.Wait()
+	if err := catFile.Start(); err != nil {
+		cancel()
+		return 0, err
+	}
+	defer catFile.Wait()
+	// Kills both processes if we return early
+	defer cancel()
+
+	var (
+		written []string
+		total   int
+		writer  = codesearch.NewSegmentWriter()
+	)
+	flush := func() error {
+		if writer.Len() == 0 {
+			return nil
+		}
+		segment, err := writeSearchSegment(dir, prefix, writer)
+		if err != nil {
+			return err
+		}
+		written = append(written, segment)
+		total += writer.Len()
+		writer = codesearch.NewSegmentWriter()
+		return nil
+	}
+	err = func() error {
+		objects := bufio.NewReader(stdout)
+		for {
+			header, err := objects.ReadString('\n')
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			fields := strings.Fields(header)
+			if len(fields) != 3 {
+				return fmt.Errorf("git cat-file: unexpected output %q", header)
+			}
+			size, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("git cat-file: unexpected output %q", header)
+			}
+			var id [20]byte
+			if _, err := hex.Decode(id[:], []byte(fields[0])); err != nil {
+				return err
+			}
+
+			// The contents are followed by a newline
+			if fields[1] != "blob" || size > codesearch.MaxBlobSize {
+				if _, err := objects.Discard(int(size) + 1); err != nil {
+					return err
+				}
+				if fields[1] == "blob" {
+					// Recorded as indexed, but never matches
+					writer.Add(id, nil)
+				}
+				continue
+			}
+			content := make([]byte, size+1)
+			if _, err := io.ReadFull(objects, content); err != nil {
+				return err
+			}
+			writer.Add(id, content[:size])
+
+			if writer.Size() >= maxSegmentContent {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := catFile.Wait(); err != nil {
+			return fmt.Errorf("git cat-file: %v", err)
+		}
+		if err := list.Wait(); err != nil {
+			return fmt.Errorf("git rev-list: %v", err)
+		}
+		return flush()
+	}()
+	if err != nil {
+		for _, segment := range written {
+			os.Remove(segment)
+		}
+		return 0, err
+	}
+	return total, nil
+}
+
+// Writes a segment to a new file in dir, whose name starts with prefix, and
+// returns its path.
+func writeSearchSegment(dir, prefix string,
+	writer *codesearch.SegmentWriter) (string, error) {
+	// Written to a temporary file first so that readers never see a partial
+	// segment
+	tmp, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	// Read by the API, which may run as a different user
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if _, err := writer.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	segment := path.Join(dir,
+		fmt.Sprintf("%s%d.idx", prefix, time.Now().UnixNano()))
+	if err := os.Rename(tmp.Name(), segment); err != nil {
+		return "", err
+	}
+	return segment, nil
+}
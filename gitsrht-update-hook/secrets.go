@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Files larger than this are not scanned for secrets
+const maxSecretScanSize = 1 << 20
+
+// Patterns for common kinds of credentials. These can be overridden or
+// disabled with the [git.sr.ht::secret-patterns] section of config.ini.
+var builtinSecretPatterns = map[string]string{
+	"aws-access-key-id":     `\b(AKIA|ASIA)[0-9A-Z]{16}\b`,
+	"aws-secret-access-key": `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`,
+	"private-key":           `-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`,
+	"github-token":          `\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	"gitlab-token":          `\bglpat-[A-Za-z0-9_-]{20,}\b`,
+	"slack-token":           `\bxox[abposr]-[A-Za-z0-9-]{10,}\b`,
+	"stripe-key":            `\b[rs]k_live_[A-Za-z0-9]{24,}\b`,
+	"google-api-key":        `\bAIza[0-9A-Za-z_-]{35}\b`,
+}
+
+type SecretRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+type SecretFinding struct {
+	Ref  string `json:"ref"`
+	Blob string `json:"blob"`
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Rule string `json:"rule"`
+}
+
+type SecretFoundPayload struct {
+	Push     string          `json:"push"`
+	Pusher   UserContext     `json:"pusher"`
+	Findings []SecretFinding `json:"findings"`
+}
+
+// Returns the built-in secret patterns, as modified by the instance's
+// [git.sr.ht::secret-patterns] section, in which each key is the name of a
+// pattern and each value is a regular expression, or empty to disable it.
+func secretRules() ([]SecretRule, error) {
+	patterns := make(map[string]string)
+	for name, pattern := range builtinSecretPatterns {
+		patterns[name] = pattern
+	}
+	for name, pattern := range config.Section("git.sr.ht::secret-patterns") {
+		patterns[name] = pattern
+	}
+
+	var rules []SecretRule
+	for name, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Invalid [git.sr.ht::secret-patterns]%s: %v", name, err)
+		}
+		rules = append(rules, SecretRule{name, re})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
+}
+
+// Returns the secret scanning mode which applies to the repository: disabled,
+// warn, or reject.
+func secretScanningMode(policy *PushPolicy) (string, error) {
+	if policy != nil && policy.SecretScanning != "" {
+		return policy.SecretScanning, nil
+	}
+	mode, ok := config.Get("git.sr.ht", "secret-scanning")
+	if !ok || mode == "" {
+		return "disabled", nil
+	}
+	switch mode {
+	case "disabled", "warn", "reject":
+		return mode, nil
+	}
+	return "", fmt.Errorf("Invalid [git.sr.ht]secret-scanning: %q", mode)
+}
+
+// Scans the text files introduced by each ref update for secrets.
+func scanForSecrets(rules []SecretRule, objects pushObjects,
+	updates []RefUpdate) ([]SecretFinding, error) {
+	var findings []SecretFinding
+	// Files shared between refs are only read once
+	scanned := make(map[string][]SecretFinding)
+	for _, update := range updates {
+		if update.IsDelete() {
+			continue
+		}
+		objs, err := objects.get(update.New)
+		if err != nil {
+			return nil, err
+		}
+
+		var blobs []NewObject
+		var ids []string
+		for _, obj := range objs {
+			if obj.Type != "blob" || obj.Size > maxSecretScanSize {
+				continue
+			}
+			if _, ok := scanned[obj.Hash]; ok {
+				continue
+			}
+			blobs = append(blobs, obj)
+			ids = append(ids, obj.Hash)
+		}
+		// Each blob is scanned before the next is read
+		if err := eachObject(ids, func(i int, obj plumbing.EncodedObject) error {
+			reader, err := obj.Reader()
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				return err
+			}
+			scanned[blobs[i].Hash] = scanBlob(rules, blobs[i], data)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		for _, obj := range objs {
+			for _, finding := range scanned[obj.Hash] {
+				finding.Ref = update.Name
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings, nil
+}
+
+func scanBlob(rules []SecretRule, blob NewObject, data []byte) []SecretFinding {
+	if bytes.IndexByte(data, 0) != -1 {
+		// Binary file
+		return nil
+	}
+	// The whole blob is in memory, so lines of any length are scanned
+	var findings []SecretFinding
+	for line := 1; len(data) != 0; line++ {
+		text := data
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			text, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		text = bytes.TrimSuffix(text, []byte("\r"))
+		for _, rule := range rules {
+			if rule.Pattern.Match(text) {
+				findings = append(findings, SecretFinding{
+					Blob: blob.Hash,
+					Path: blob.Path,
+					Line: line,
+					Rule: rule.Name,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+func recordSecretFindings(db *sql.DB, context PushContext, pushUuid string,
+	findings []SecretFinding, rejected bool) error {
+	for _, finding := range findings {
+		if _, err := db.Exec(`
+			INSERT INTO secret_finding (
+				created, repo_id, pusher_id, push_uuid, ref_name, blob_id,
+				path, line, rule, rejected
+			) VALUES (
+				NOW() at time zone 'utc', $1,
+				(SELECT id FROM "user" WHERE username = $2),
+				$3, $4, $5, $6, $7, $8, $9
+			);
+		`, context.Repo.Id, context.User.Name, pushUuid, finding.Ref,
+			finding.Blob, finding.Path, finding.Line, finding.Rule,
+			rejected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the findings which were recorded for a push in pre-receive.
+func fetchSecretFindings(db *sql.DB, pushUuid string) ([]SecretFinding, error) {
+	rows, err := db.Query(`
+		SELECT ref_name, blob_id, path, line, rule
+		FROM secret_finding
+		WHERE push_uuid = $1
+		ORDER BY id;
+	`, pushUuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var findings []SecretFinding
+	for rows.Next() {
+		var f SecretFinding
+		if err := rows.Scan(&f.Ref, &f.Blob, &f.Path, &f.Line,
+			&f.Rule); err != nil {
+			return nil, err
+		}
+		findings = append(findings, f)
+	}
+	return findings, rows.Err()
+}
+
+// Delivers repo:secret-found webhooks for the findings which were recorded
+// for an accepted push. This runs in stage 3, so that the pusher does not wait
+// for them.
+func deliverSecretFoundWebhooks(db *sql.DB, context PushContext,
+	pushUuid string) error {
+	findings, err := fetchSecretFindings(db, pushUuid)
+	if err != nil || len(findings) == 0 {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT id, url, events
+		FROM repo_webhook_subscription rws
+		WHERE rws.repo_id = $1
+			AND rws.events LIKE '%repo:secret-found%'
+	`, context.Repo.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var subs []WebhookSubscription
+	for rows.Next() {
+		var whs WebhookSubscription
+		if err := rows.Scan(&whs.Id, &whs.Url, &whs.Events); err != nil {
+			return err
+		}
+		subs = append(subs, whs)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	payloadBytes, err := json.Marshal(&SecretFoundPayload{
+		Push:     pushUuid,
+		Pusher:   context.User,
+		Findings: findings,
+	})
+	if err != nil {
+		return err
+	}
+	deliveries := deliverWebhooks(subs, "repo:secret-found", payloadBytes, false)
+	return recordDeliveries(db, "repo:secret-found", deliveries)
+}
+
+func printSecretFindings(findings []SecretFinding) {
+	log.Println("\n\t\033[93mWARNING\033[0m")
+	log.Println()
+	log.Println("\tThe following files appear to contain credentials. If they are")
+	log.Println("\treal, revoke them: removing them from the history is not enough.")
+	log.Println()
+	// Findings are reported for each ref which includes the file
+	seen := make(map[string]struct{})
+	for _, f := range findings {
+		line := fmt.Sprintf("%s:%d (%s)", f.Path, f.Line, f.Rule)
+		if _, ok := seen[line]; ok {
+			continue
+		}
+		seen[line] = struct{}{}
+		log.Printf("\t%s", line)
+	}
+	log.Println()
+}
+
+// Scans the files introduced by the ref updates for credentials. Findings are
+// reported to the pusher and returned, to be recorded once the push is
+// accepted or rejected, and, if the repository is configured to do so, also
+// returned as rejections.
+func checkSecrets(policy *PushPolicy, objects pushObjects,
+	updates []RefUpdate) ([]SecretFinding, []Rejection, error) {
+	mode, err := secretScanningMode(policy)
+	if err != nil || mode == "disabled" {
+		return nil, nil, err
+	}
+	rules, err := secretRules()
+	if err != nil {
+		return nil, nil, err
+	}
+	findings, err := scanForSecrets(rules, objects, updates)
+	if err != nil || len(findings) == 0 {
+		return nil, nil, err
+	}
+
+	if mode != "reject" {
+		printSecretFindings(findings)
+		return findings, nil, nil
+	}
+	var rejections []Rejection
+	for _, f := range findings {
+		rejections = append(rejections, Rejection{f.Ref,
+			fmt.Sprintf("File %s appears to contain a credential (%s) on line %d",
+				f.Path, f.Rule, f.Line)})
+	}
+	return findings, rejections, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"io/ioutil"
+	"time"
+
+	"git.sr.ht/~sircmpwn/core-go/client"
+	coreconfig "git.sr.ht/~sircmpwn/core-go/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"git.sr.ht/~sircmpwn/git.sr.ht/internal/sigverify"
+)
+
+// Verifies commit and tag signatures against the keys which users have
+// registered, which are cached for the duration of the push.
+type SignatureVerifier struct {
+	keys sigverify.Keys
+}
+
+// Looks up PGP keys on meta.sr.ht as the given user, and SSH keys in the
+// database.
+func NewSignatureVerifier(db *sql.DB, username string) *SignatureVerifier {
+	query := func(ctx context.Context, query string,
+		variables map[string]interface{}, resp interface{}) error {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		ctx = coreconfig.Context(ctx, config, "git.sr.ht")
+		return client.Execute(ctx, username, "meta.sr.ht", client.GraphQLQuery{
+			Query:     query,
+			Variables: variables,
+		}, resp)
+	}
+	return &SignatureVerifier{
+		keys: sigverify.NewCache(&sigverify.SourceHutKeys{
+			Context: context.Background(),
+			Query:   query,
+			DB:      db,
+		}),
+	}
+}
+
+// Returns the data which each of the given commits signed, i.e. the raw commit
+// without its signature, and its armored signature, which is empty if it is
+// not signed. go-git drops headers such as mergetag and encoding, which are
+// signed too, so the raw commits are read with git cat-file.
+func signedData(commits ...*object.Commit) ([][]byte, []string, error) {
+	ids := make([]string, len(commits))
+	for i, c := range commits {
+		ids[i] = c.Hash.String()
+	}
+	return signedDataByID(ids)
+}
+
+func signedDataByID(ids []string) ([][]byte, []string, error) {
+	objs, err := readObjects(ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make([][]byte, len(objs))
+	armored := make([]string, len(objs))
+	for i, obj := range objs {
+		reader, err := obj.Reader()
+		if err != nil {
+			return nil, nil, err
+		}
+		raw, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		data[i], armored[i] = sigverify.SplitCommit(raw)
+	}
+	return data, armored, nil
+}
+
+// Returns the username of the user who registered the key which made the
+// armored signature of data, or an empty string if the signature is invalid
+// or was not made by a registered key. The email address is that of the
+// committer or tagger.
+func (v *SignatureVerifier) Verify(armored string, data []byte,
+	email string) (string, error) {
+	sig, err := sigverify.Parse(armored)
+	if err != nil {
+		return "", nil
+	}
+	status, username, err := sig.Verify(v.keys, data, email)
+	if err != nil || status != sigverify.StatusVerified {
+		return "", err
+	}
+	return username, nil
+}
+
+// Returns the commits in the payload, old and new.
+func payloadCommits(payload *WebhookPayload) []*Commit {
+	var commits []*Commit
+	for _, ref := range payload.Refs {
+		for _, c := range []*Commit{ref.Old, ref.New} {
+			if c != nil {
+				commits = append(commits, c)
+			}
+		}
+	}
+	return commits
+}
+
+// Adds the signatures of the commits in the payload, which are read together
+// with a single git cat-file. They are not verified; see
+// verifyPayloadSignatures.
+func addPayloadSignatures(payload *WebhookPayload) error {
+	commits := payloadCommits(payload)
+	ids := make([]string, len(commits))
+	for i, c := range commits {
+		ids[i] = c.Id
+	}
+	data, armored, err := signedDataByID(ids)
+	if err != nil {
+		return err
+	}
+	for i, c := range commits {
+		if armored[i] == "" {
+			continue
+		}
+		c.Signature = &CommitSignature{
+			Data:      base64.StdEncoding.EncodeToString(data[i]),
+			Signature: base64.StdEncoding.EncodeToString([]byte(armored[i])),
+		}
+	}
+	return nil
+}
+
+// Verifies the signatures added by addPayloadSignatures. The keys are looked
+// up on meta.sr.ht, so this is only done when webhooks are delivered, and in
+// stage 3 unless there are synchronous webhooks.
+func verifyPayloadSignatures(payload *WebhookPayload,
+	verifier *SignatureVerifier) {
+	for _, c := range payloadCommits(payload) {
+		if c.Signature == nil {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(c.Signature.Data)
+		if err != nil {
+			panic(err) // Invariant
+		}
+		armored, err := base64.StdEncoding.DecodeString(c.Signature.Signature)
+		if err != nil {
+			panic(err) // Invariant
+		}
+		signer, err := verifier.Verify(string(armored), data, c.Committer.Email)
+		if err != nil {
+			logger.Printf("Error verifying signature of %s: %v", c.Id, err)
+		}
+		c.Signature.Verified = signer != ""
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Creates a repository in a temporary directory, which is made the working
+// directory for the duration of the test, as it is for the hooks. Returns a
+// function which runs git commands in it.
+func testRepo(t *testing.T) (string, func(args ...string) string) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gitsrht-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	})
+
+	run := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=Example", "GIT_AUTHOR_EMAIL=example@example.org",
+			"GIT_COMMITTER_NAME=Example", "GIT_COMMITTER_EMAIL=example@example.org",
+			"GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	run("init", "--quiet")
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir, run
+}
+
+// Attributes all SSH keys to alice.
+type testSignatureKeys struct{}
+
+func (testSignatureKeys) PGPKeyByFingerprint(string) (string, string, error) {
+	return "", "", nil
+}
+
+func (testSignatureKeys) PGPKeysByEmail(string) ([]string, string, error) {
+	return nil, "", nil
+}
+
+func (testSignatureKeys) SSHKeyByFingerprint(string) (string, error) {
+	return "alice", nil
+}
+
+func TestSignedData(t *testing.T) {
+	dir, run := testRepo(t)
+	key := path.Join(dir, ".git", "signing-key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "",
+		"-f", key).CombinedOutput(); err != nil {
+		t.Skipf("ssh-keygen: %v: %s", err, out)
+	}
+	run("config", "gpg.format", "ssh")
+	run("config", "user.signingKey", key)
+	run("commit", "--quiet", "--allow-empty", "-m", "First")
+	run("checkout", "--quiet", "-b", "topic")
+	run("commit", "--quiet", "--allow-empty", "-m", "Topic")
+	run("tag", "-s", "-m", "Topic release", "v1.0")
+	run("checkout", "--quiet", "-")
+	// The merge commit has mergetag and encoding headers, which are signed
+	run("-c", "i18n.commitEncoding=ISO-8859-1", "merge", "--quiet",
+		"--no-ff", "-S", "-m", "Merge v1.0", "v1.0")
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	merge, err := repo.CommitObject(plumbing.NewHash(run("rev-parse", "HEAD")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic, err := repo.CommitObject(plumbing.NewHash(run("rev-parse", "topic")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, armored, err := signedData(merge, topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if armored[1] != "" {
+		t.Errorf("expected the topic commit to be unsigned")
+	}
+	if !strings.Contains(string(data[0]), "\nmergetag ") ||
+		!strings.Contains(string(data[0]), "\nencoding ") ||
+		strings.Contains(string(data[0]), "\ngpgsig ") {
+		t.Errorf("unexpected signed data:\n%s", data[0])
+	}
+
+	verifier := &SignatureVerifier{keys: testSignatureKeys{}}
+	signer, err := verifier.Verify(armored[0], data[0], merge.Committer.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer != "alice" {
+		t.Errorf("got signer %q, want alice", signer)
+	}
+}
+
+func TestPayloadSignatures(t *testing.T) {
+	dir, run := testRepo(t)
+	key := path.Join(dir, ".git", "signing-key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "",
+		"-f", key).CombinedOutput(); err != nil {
+		t.Skipf("ssh-keygen: %v: %s", err, out)
+	}
+	run("config", "gpg.format", "ssh")
+	run("config", "user.signingKey", key)
+	run("commit", "--quiet", "--allow-empty", "-m", "First")
+	run("commit", "--quiet", "--allow-empty", "-S", "-m", "Second")
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(rev string) *Commit {
+		c, err := repo.CommitObject(plumbing.NewHash(run("rev-parse", rev)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return GitCommitToWebhookCommit(c)
+	}
+	payload := WebhookPayload{Refs: []UpdatedRef{
+		{Name: "refs/heads/master", Old: commit("HEAD~"), New: commit("HEAD")},
+		{Name: "refs/heads/deleted", Old: commit("HEAD")},
+	}}
+	if err := addPayloadSignatures(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Refs[0].Old.Signature != nil {
+		t.Errorf("expected the first commit to be unsigned")
+	}
+	for _, c := range []*Commit{payload.Refs[0].New, payload.Refs[1].Old} {
+		if c.Signature == nil || c.Signature.Verified {
+			t.Fatalf("expected an unverified signature, got %+v", c.Signature)
+		}
+	}
+
+	verifyPayloadSignatures(&payload,
+		&SignatureVerifier{keys: testSignatureKeys{}})
+	for _, c := range []*Commit{payload.Refs[0].New, payload.Refs[1].Old} {
+		if !c.Signature.Verified {
+			t.Errorf("expected the signature of %s to be verified", c.Id)
+		}
+	}
+}
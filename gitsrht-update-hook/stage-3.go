@@ -84,37 +84,31 @@ func stage3() {
 	logger.Printf("Making %d deliveries and recording %d from stage 2",
 		len(subscriptions), len(deliveries))
 
-	deliveries = append(deliveries, deliverWebhooks(
-		subscriptions, payload, false)...)
-	for _, delivery := range deliveries {
-		if _, err := db.Exec(`
-			INSERT INTO repo_webhook_delivery (
-				uuid,
-				created,
-				event,
-				url,
-				payload,
-				payload_headers,
-				response,
-				response_status,
-				response_headers,
-				subscription_id
-			) VALUES (
-				$1, NOW() AT TIME ZONE 'UTC', 'repo:post-update',
-				$2, $3, $4, $5, $6, $7, $8
-			);
-		`, delivery.UUID, delivery.Url,
-			delivery.Payload, delivery.Headers,
-			delivery.Response, delivery.ResponseStatus, delivery.ResponseHeaders,
-			delivery.SubscriptionId); err != nil {
-
-			logger.Fatalf("Error inserting webhook delivery: %v", err)
+	// Stage 2 verified the signatures if it delivered any webhooks
+	if len(subscriptions) != 0 && len(deliveries) == 0 {
+		verifyPayloadSignatures(&decoded,
+			NewSignatureVerifier(db, context.User.Name))
+		if payload, err = json.Marshal(&decoded); err != nil {
+			logger.Fatalf("Failed to marshal webhook payload: %v", err)
 		}
 	}
 
+	deliveries = append(deliveries, deliverWebhooks(
+		subscriptions, "repo:post-update", payload, false)...)
+	if err := recordDeliveries(db, "repo:post-update", deliveries); err != nil {
+		logger.Fatalf("Error inserting webhook delivery: %v", err)
+	}
+
 	logger.Printf("Delivered %d webhooks, recorded %d deliveries",
 		len(subscriptions), len(deliveries))
 
+	if err := deliverSecretFoundWebhooks(db, context, pushUuid); err != nil {
+		logger.Printf("Error delivering secret-found webhooks: %v", err)
+	}
+
+	updatePushMirrors(&context, db, pushUuid, &decoded)
+	updateSearchIndex(&context, &decoded)
+
 	if _, ok := config.Get("objects", "s3-upstream"); ok {
 		deleteArtifacts(&context, db, &decoded)
 	}
@@ -67,6 +67,8 @@ type BuildSubmitter interface {
 	GetRepoName() string
 	// Get the name of the repository owner
 	GetOwnerName() string
+	// Get the name of the user on whose behalf builds are submitted
+	GetUsername() string
 }
 
 // SQL notes
@@ -85,6 +87,7 @@ type GitBuildSubmitter struct {
 	OwnerToken  *string
 	RepoName    string
 	Repository  *git.Repository
+	Username    string
 	Visibility  string
 }
 
@@ -258,6 +261,10 @@ func (submitter GitBuildSubmitter) GetOwnerName() string {
 	return submitter.OwnerName
 }
 
+func (submitter GitBuildSubmitter) GetUsername() string {
+	return submitter.Username
+}
+
 type BuildSubmission struct {
 	// TODO: Move errors into this struct and set up per-submission error
 	// tracking
@@ -272,7 +279,7 @@ func configureRequestAuthorization(submitter BuildSubmitter,
 	auth := InternalRequestAuthorization{
 		ClientID: clientId,
 		NodeID:   "git.sr.ht::update-hook",
-		Username: submitter.GetOwnerName(),
+		Username: submitter.GetUsername(),
 	}
 	authPayload, err := json.Marshal(&auth)
 	if err != nil {
@@ -380,7 +387,7 @@ func SubmitBuild(submitter BuildSubmitter) ([]BuildSubmission, error) {
 			Name: name,
 			Url: fmt.Sprintf("%s/~%s/job/%d",
 				submitter.GetBuildsOrigin(),
-				submitter.GetOwnerName(),
+				submitter.GetUsername(),
 				job.Id),
 			Response: string(respBytes),
 		})
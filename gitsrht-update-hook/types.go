@@ -1,10 +1,6 @@
 package main
 
 import (
-	"encoding/base64"
-	"io/ioutil"
-
-	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
@@ -12,6 +8,7 @@ type RepoContext struct {
 	Id           int    `json:"id"`
 	Name         string `json:"name"`
 	OwnerId      int    `json:"owner_id"`
+	OrgId        *int   `json:"org_id,omitempty"`
 	OwnerName    string `json:"owner_name"`
 	Path         string `json:"path"`
 	AbsolutePath string `json:"absolute_path"`
@@ -37,6 +34,8 @@ type AnnotatedTag struct {
 type CommitSignature struct {
 	Data      string `json:"data"`
 	Signature string `json:"signature"`
+	// Whether the signature was made by a key which a user has registered
+	Verified bool `json:"verified"`
 }
 
 type CommitAuthorship struct {
@@ -58,24 +57,13 @@ type Commit struct {
 	Signature *CommitSignature `json:"signature"`
 }
 
+// The commit's signature is added by addPayloadSignatures.
 func GitCommitToWebhookCommit(c *object.Commit) *Commit {
 	parents := make([]string, len(c.ParentHashes))
 	for i, p := range c.ParentHashes {
 		parents[i] = p.String()
 	}
 
-	var signature *CommitSignature = nil
-	if c.PGPSignature != "" {
-		encoded := &plumbing.MemoryObject{}
-		c.EncodeWithoutSignature(encoded)
-		reader, _ := encoded.Reader()
-		data, _ := ioutil.ReadAll(ioutil.NopCloser(reader))
-		signature = &CommitSignature{
-			Data:      base64.StdEncoding.EncodeToString(data),
-			Signature: base64.StdEncoding.EncodeToString([]byte(c.PGPSignature)),
-		}
-	}
-
 	return &Commit{
 		Id:        c.Hash.String(),
 		Message:   c.Message,
@@ -92,6 +80,5 @@ func GitCommitToWebhookCommit(c *object.Commit) *Commit {
 			Name:  c.Committer.Name,
 			Email: c.Committer.Email,
 		},
-		Signature: signature,
 	}
 }
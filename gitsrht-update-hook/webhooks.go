@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -53,7 +54,7 @@ type WebhookPayload struct {
 
 var ansi = regexp.MustCompile("\x1B\\[[0-?]*[ -/]*[@-~]")
 
-func deliverWebhooks(subs []WebhookSubscription,
+func deliverWebhooks(subs []WebhookSubscription, event string,
 	payload []byte, printResponse bool) []WebhookDelivery {
 
 	var deliveries []WebhookDelivery
@@ -66,7 +67,7 @@ func deliverWebhooks(subs []WebhookSubscription,
 		body := bytes.NewBuffer(payload)
 		req, err := http.NewRequest("POST", sub.Url, body)
 		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("X-Webhook-Event", "repo:post-update")
+		req.Header.Add("X-Webhook-Event", event)
 		req.Header.Add("X-Webhook-Delivery", deliveryUuid)
 		req.Header.Add("X-Payload-Nonce", nonce)
 		req.Header.Add("X-Payload-Signature", signature)
@@ -135,3 +136,32 @@ func deliverWebhooks(subs []WebhookSubscription,
 
 	return deliveries
 }
+
+func recordDeliveries(db *sql.DB, event string,
+	deliveries []WebhookDelivery) error {
+	for _, delivery := range deliveries {
+		if _, err := db.Exec(`
+			INSERT INTO repo_webhook_delivery (
+				uuid,
+				created,
+				event,
+				url,
+				payload,
+				payload_headers,
+				response,
+				response_status,
+				response_headers,
+				subscription_id
+			) VALUES (
+				$1, NOW() AT TIME ZONE 'UTC', $2,
+				$3, $4, $5, $6, $7, $8, $9
+			);
+		`, delivery.UUID, event, delivery.Url,
+			delivery.Payload, delivery.Headers,
+			delivery.Response, delivery.ResponseStatus, delivery.ResponseHeaders,
+			delivery.SubscriptionId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
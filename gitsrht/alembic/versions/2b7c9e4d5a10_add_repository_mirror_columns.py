@@ -0,0 +1,40 @@
+"""Add repository mirror columns
+
+Revision ID: 2b7c9e4d5a10
+Revises: 9a4e6d2b1f37
+Create Date: 2026-10-18 16:47:31.208664
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '2b7c9e4d5a10'
+down_revision = '9a4e6d2b1f37'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    ALTER TABLE repository
+        ADD COLUMN mirror_url varchar,
+        ADD COLUMN mirror_username varchar,
+        ADD COLUMN mirror_encrypted_password bytea,
+        ADD COLUMN mirror_last_sync timestamp,
+        ADD COLUMN mirror_error varchar;
+
+    CREATE INDEX ix_repository_mirror_last_sync
+        ON repository (mirror_last_sync) WHERE mirror_url IS NOT NULL;
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP INDEX ix_repository_mirror_last_sync;
+    ALTER TABLE repository
+        DROP COLUMN mirror_url,
+        DROP COLUMN mirror_username,
+        DROP COLUMN mirror_encrypted_password,
+        DROP COLUMN mirror_last_sync,
+        DROP COLUMN mirror_error;
+    """)
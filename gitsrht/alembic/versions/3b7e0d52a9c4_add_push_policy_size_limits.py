@@ -0,0 +1,32 @@
+"""Add push_policy size limits and forbidden paths
+
+Revision ID: 3b7e0d52a9c4
+Revises: 8f2a6c4e1b73
+Create Date: 2026-10-18 23:56:37.201846
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '3b7e0d52a9c4'
+down_revision = '8f2a6c4e1b73'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    ALTER TABLE push_policy
+        ADD COLUMN max_blob_size bigint,
+        ADD COLUMN max_repo_size bigint,
+        ADD COLUMN forbidden_paths varchar[] NOT NULL DEFAULT '{}';
+    """)
+
+
+def downgrade():
+    op.execute("""
+    ALTER TABLE push_policy
+        DROP COLUMN max_blob_size,
+        DROP COLUMN max_repo_size,
+        DROP COLUMN forbidden_paths;
+    """)
@@ -0,0 +1,36 @@
+"""Add protected_ref table
+
+Revision ID: 3e5b2f1c8d4a
+Revises: 38952f52f32d
+Create Date: 2026-10-18 09:12:40.318502
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '3e5b2f1c8d4a'
+down_revision = '38952f52f32d'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    CREATE TABLE protected_ref (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        updated timestamp NOT NULL,
+        repo_id integer NOT NULL REFERENCES repository(id) ON DELETE CASCADE,
+        pattern varchar NOT NULL,
+        allow_force_push boolean NOT NULL DEFAULT false,
+        allow_deletion boolean NOT NULL DEFAULT false,
+        allowed_users integer[] NOT NULL DEFAULT '{}',
+        CONSTRAINT uq_protected_ref_repo_id_pattern UNIQUE (repo_id, pattern)
+    );
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP TABLE protected_ref;
+    """)
@@ -0,0 +1,28 @@
+"""Add protected_ref.require_signatures
+
+Revision ID: 5c1d7e9a3f28
+Revises: e4f18a6c3b92
+Create Date: 2026-10-18 21:03:15.482907
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '5c1d7e9a3f28'
+down_revision = 'e4f18a6c3b92'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    ALTER TABLE protected_ref
+        ADD COLUMN require_signatures boolean NOT NULL DEFAULT false;
+    """)
+
+
+def downgrade():
+    op.execute("""
+    ALTER TABLE protected_ref
+        DROP COLUMN require_signatures;
+    """)
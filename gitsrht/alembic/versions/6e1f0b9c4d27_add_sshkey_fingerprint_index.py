@@ -0,0 +1,26 @@
+"""Add sshkey fingerprint index
+
+Revision ID: 6e1f0b9c4d27
+Revises: 9d4a2f61c8e5
+Create Date: 2026-10-19 00:41:05.118273
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '6e1f0b9c4d27'
+down_revision = '9d4a2f61c8e5'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    CREATE INDEX sshkey_fingerprint_idx ON sshkey (fingerprint);
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP INDEX sshkey_fingerprint_idx;
+    """)
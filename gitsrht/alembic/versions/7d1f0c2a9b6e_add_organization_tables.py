@@ -0,0 +1,72 @@
+"""Add organization tables
+
+Revision ID: 7d1f0c2a9b6e
+Revises: 3e5b2f1c8d4a
+Create Date: 2026-10-18 11:03:17.904215
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '7d1f0c2a9b6e'
+down_revision = '3e5b2f1c8d4a'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    CREATE TABLE organization (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        updated timestamp NOT NULL,
+        name varchar(256) NOT NULL UNIQUE,
+        description varchar(1024)
+    );
+
+    CREATE TYPE organization_role AS ENUM (
+        'admin',
+        'member',
+        'viewer'
+    );
+
+    CREATE TABLE organization_member (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        updated timestamp NOT NULL,
+        org_id integer NOT NULL
+            REFERENCES organization(id) ON DELETE CASCADE,
+        user_id integer NOT NULL
+            REFERENCES "user"(id) ON DELETE CASCADE,
+        role organization_role NOT NULL,
+        CONSTRAINT uq_organization_member_org_id_user_id
+            UNIQUE (org_id, user_id)
+    );
+
+    CREATE INDEX ix_organization_member_user_id
+        ON organization_member (user_id);
+
+    ALTER TABLE repository
+        ADD COLUMN org_id integer REFERENCES organization(id);
+
+    ALTER TABLE repository
+        DROP CONSTRAINT uq_repo_owner_id_name;
+    CREATE UNIQUE INDEX uq_repo_owner_id_name
+        ON repository (owner_id, name) WHERE org_id IS NULL;
+    CREATE UNIQUE INDEX uq_repo_org_id_name
+        ON repository (org_id, name) WHERE org_id IS NOT NULL;
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DELETE FROM repository WHERE org_id IS NOT NULL;
+    DROP INDEX uq_repo_org_id_name;
+    DROP INDEX uq_repo_owner_id_name;
+    ALTER TABLE repository
+        ADD CONSTRAINT uq_repo_owner_id_name UNIQUE (owner_id, name);
+    ALTER TABLE repository DROP COLUMN org_id;
+    DROP TABLE organization_member;
+    DROP TYPE organization_role;
+    DROP TABLE organization;
+    """)
@@ -0,0 +1,37 @@
+"""Add push_policy table
+
+Revision ID: 8f2a6c4e1b73
+Revises: 5c1d7e9a3f28
+Create Date: 2026-10-18 22:41:08.915336
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '8f2a6c4e1b73'
+down_revision = '5c1d7e9a3f28'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    CREATE TABLE push_policy (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        updated timestamp NOT NULL,
+        repo_id integer NOT NULL REFERENCES repository(id) ON DELETE CASCADE,
+        required_trailers varchar[] NOT NULL DEFAULT '{}',
+        message_pattern varchar,
+        max_subject_length integer,
+        committer_domains varchar[] NOT NULL DEFAULT '{}',
+        no_merge_refs varchar[] NOT NULL DEFAULT '{}',
+        CONSTRAINT uq_push_policy_repo_id UNIQUE (repo_id)
+    );
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP TABLE push_policy;
+    """)
@@ -0,0 +1,31 @@
+"""Add repository.forked_from
+
+Revision ID: 9a4e6d2b1f37
+Revises: c5a8e3f0d217
+Create Date: 2026-10-18 15:12:08.530714
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '9a4e6d2b1f37'
+down_revision = 'c5a8e3f0d217'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    ALTER TABLE repository
+        ADD COLUMN forked_from integer
+            REFERENCES repository(id) ON DELETE SET NULL;
+
+    CREATE INDEX ix_repository_forked_from ON repository (forked_from);
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP INDEX ix_repository_forked_from;
+    ALTER TABLE repository DROP COLUMN forked_from;
+    """)
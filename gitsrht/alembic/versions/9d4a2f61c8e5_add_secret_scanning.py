@@ -0,0 +1,55 @@
+"""Add secret scanning
+
+Revision ID: 9d4a2f61c8e5
+Revises: 3b7e0d52a9c4
+Create Date: 2026-10-18 23:58:12.530914
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = '9d4a2f61c8e5'
+down_revision = '3b7e0d52a9c4'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    CREATE TYPE secret_scanning_mode AS ENUM (
+        'disabled',
+        'warn',
+        'reject'
+    );
+
+    ALTER TABLE push_policy
+        ADD COLUMN secret_scanning secret_scanning_mode;
+
+    CREATE TABLE secret_finding (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        repo_id integer NOT NULL
+            REFERENCES repository(id) ON DELETE CASCADE,
+        pusher_id integer
+            REFERENCES "user"(id) ON DELETE SET NULL,
+        push_uuid uuid NOT NULL,
+        ref_name varchar NOT NULL,
+        blob_id varchar NOT NULL,
+        path varchar NOT NULL,
+        line integer NOT NULL,
+        rule varchar NOT NULL,
+        rejected boolean NOT NULL
+    );
+
+    CREATE INDEX ix_secret_finding_repo_id
+        ON secret_finding (repo_id);
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP TABLE secret_finding;
+    ALTER TABLE push_policy
+        DROP COLUMN secret_scanning;
+    DROP TYPE secret_scanning_mode;
+    """)
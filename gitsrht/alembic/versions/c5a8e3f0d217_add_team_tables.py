@@ -0,0 +1,63 @@
+"""Add team tables
+
+Revision ID: c5a8e3f0d217
+Revises: 7d1f0c2a9b6e
+Create Date: 2026-10-18 13:41:52.117368
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = 'c5a8e3f0d217'
+down_revision = '7d1f0c2a9b6e'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    CREATE TABLE team (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        updated timestamp NOT NULL,
+        org_id integer NOT NULL
+            REFERENCES organization(id) ON DELETE CASCADE,
+        name varchar(256) NOT NULL,
+        description varchar(1024),
+        CONSTRAINT uq_team_org_id_name UNIQUE (org_id, name)
+    );
+
+    CREATE TABLE team_member (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        team_id integer NOT NULL
+            REFERENCES team(id) ON DELETE CASCADE,
+        user_id integer NOT NULL
+            REFERENCES "user"(id) ON DELETE CASCADE,
+        CONSTRAINT uq_team_member_team_id_user_id UNIQUE (team_id, user_id)
+    );
+
+    CREATE INDEX ix_team_member_user_id ON team_member (user_id);
+
+    CREATE TABLE team_access (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        updated timestamp NOT NULL,
+        mode varchar NOT NULL,
+        team_id integer NOT NULL
+            REFERENCES team(id) ON DELETE CASCADE,
+        repo_id integer NOT NULL
+            REFERENCES repository(id) ON DELETE CASCADE,
+        CONSTRAINT uq_team_access_team_id_repo_id UNIQUE (team_id, repo_id)
+    );
+
+    CREATE INDEX ix_team_access_repo_id ON team_access (repo_id);
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP TABLE team_access;
+    DROP TABLE team_member;
+    DROP TABLE team;
+    """)
@@ -0,0 +1,56 @@
+"""Add push mirror tables
+
+Revision ID: e4f18a6c3b92
+Revises: 2b7c9e4d5a10
+Create Date: 2026-10-18 18:20:44.671239
+
+"""
+
+# revision identifiers, used by Alembic.
+revision = 'e4f18a6c3b92'
+down_revision = '2b7c9e4d5a10'
+
+from alembic import op
+import sqlalchemy as sa
+
+
+def upgrade():
+    op.execute("""
+    CREATE TABLE push_mirror (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        updated timestamp NOT NULL,
+        repo_id integer NOT NULL
+            REFERENCES repository(id) ON DELETE CASCADE,
+        url varchar NOT NULL,
+        username varchar,
+        encrypted_password bytea,
+        CONSTRAINT uq_push_mirror_repo_id_url UNIQUE (repo_id, url)
+    );
+
+    CREATE TYPE push_mirror_status AS ENUM (
+        'success',
+        'failure'
+    );
+
+    CREATE TABLE push_mirror_attempt (
+        id serial PRIMARY KEY,
+        created timestamp NOT NULL,
+        push_mirror_id integer NOT NULL
+            REFERENCES push_mirror(id) ON DELETE CASCADE,
+        push_uuid uuid NOT NULL,
+        status push_mirror_status NOT NULL,
+        output varchar
+    );
+
+    CREATE INDEX ix_push_mirror_attempt_push_mirror_id
+        ON push_mirror_attempt (push_mirror_id);
+    """)
+
+
+def downgrade():
+    op.execute("""
+    DROP TABLE push_mirror_attempt;
+    DROP TYPE push_mirror_status;
+    DROP TABLE push_mirror;
+    """)
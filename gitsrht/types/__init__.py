@@ -30,8 +30,10 @@ class Repository(Base):
     @declared_attr
     def __table_args__(cls):
         return (
-            sa.UniqueConstraint('owner_id', 'name',
-                name="uq_repo_owner_id_name"),
+            sa.Index('uq_repo_owner_id_name', 'owner_id', 'name',
+                unique=True, postgresql_where=sa.text('org_id IS NULL')),
+            sa.Index('uq_repo_org_id_name', 'org_id', 'name',
+                unique=True, postgresql_where=sa.text('org_id IS NOT NULL')),
         )
 
     _git_repo = None
@@ -49,6 +51,12 @@ class Repository(Base):
     clone_status = sa.Column(postgresql.ENUM(
         'NONE', 'IN_PROGRESS', 'COMPLETE', 'ERROR'), nullable=False)
     clone_error = sa.Column(sa.Unicode)
+    forked_from = sa.Column(sa.Integer)
+    mirror_url = sa.Column(sa.Unicode)
+    mirror_username = sa.Column(sa.Unicode)
+    mirror_encrypted_password = sa.Column(sa.LargeBinary)
+    mirror_last_sync = sa.Column(sa.DateTime)
+    mirror_error = sa.Column(sa.Unicode)
 
     @declared_attr
     def owner_id(cls):
@@ -58,6 +66,10 @@ class Repository(Base):
     def owner(cls):
         return sa.orm.relationship('User', backref=sa.orm.backref('repos'))
 
+    @declared_attr
+    def org_id(cls):
+        return sa.Column(sa.Integer)
+
     def to_dict(self):
         return {
             "id": self.id,
@@ -77,3 +89,4 @@ class Repository(Base):
 
 from gitsrht.types.artifact import Artifact
 from gitsrht.types.sshkey import SSHKey
+from gitsrht.types.team import Team, TeamMember, TeamAccess
@@ -9,7 +9,7 @@ class SSHKey(Base):
     user = sa.orm.relationship('User', backref=sa.orm.backref('ssh_keys'))
     meta_id = sa.Column(sa.Integer, nullable=False, unique=True, index=True)
     key = sa.Column(sa.String(4096), nullable=False, index=True)
-    fingerprint = sa.Column(sa.String(512), nullable=False)
+    fingerprint = sa.Column(sa.String(512), nullable=False, index=True)
 
     def __repr__(self):
         return '<SSHKey {} {}>'.format(self.id, self.fingerprint)
@@ -0,0 +1,58 @@
+import sqlalchemy as sa
+import sqlalchemy_utils as sau
+from srht.database import Base
+from scmsrht.repos.access import AccessMode
+
+class Team(Base):
+    __tablename__ = 'team'
+    id = sa.Column(sa.Integer, primary_key=True)
+    created = sa.Column(sa.DateTime, nullable=False)
+    updated = sa.Column(sa.DateTime, nullable=False)
+    org_id = sa.Column(sa.Integer, nullable=False)
+    name = sa.Column(sa.Unicode(256), nullable=False)
+    description = sa.Column(sa.Unicode(1024))
+
+    __table_args__ = (
+        sa.UniqueConstraint('org_id', 'name', name="uq_team_org_id_name"),
+    )
+
+    def __repr__(self):
+        return '<Team {} {}>'.format(self.id, self.name)
+
+class TeamMember(Base):
+    __tablename__ = 'team_member'
+    id = sa.Column(sa.Integer, primary_key=True)
+    created = sa.Column(sa.DateTime, nullable=False)
+    team_id = sa.Column(sa.Integer,
+            sa.ForeignKey('team.id', ondelete="CASCADE"), nullable=False)
+    team = sa.orm.relationship('Team', backref=sa.orm.backref('members'))
+    user_id = sa.Column(sa.Integer,
+            sa.ForeignKey('user.id', ondelete="CASCADE"),
+            nullable=False, index=True)
+    user = sa.orm.relationship('User')
+
+    __table_args__ = (
+        sa.UniqueConstraint('team_id', 'user_id',
+            name="uq_team_member_team_id_user_id"),
+    )
+
+class TeamAccess(Base):
+    """Grants all members of a team access to a repository."""
+    __tablename__ = 'team_access'
+    id = sa.Column(sa.Integer, primary_key=True)
+    created = sa.Column(sa.DateTime, nullable=False)
+    updated = sa.Column(sa.DateTime, nullable=False)
+    mode = sa.Column(sau.ChoiceType(AccessMode, impl=sa.String()),
+            nullable=False, default=AccessMode.ro)
+    team_id = sa.Column(sa.Integer,
+            sa.ForeignKey('team.id', ondelete="CASCADE"), nullable=False)
+    team = sa.orm.relationship('Team')
+    repo_id = sa.Column(sa.Integer,
+            sa.ForeignKey('repository.id', ondelete="CASCADE"),
+            nullable=False, index=True)
+    repo = sa.orm.relationship('Repository')
+
+    __table_args__ = (
+        sa.UniqueConstraint('team_id', 'repo_id',
+            name="uq_team_access_team_id_repo_id"),
+    )
@@ -24,6 +24,7 @@ class UserWebhook(CeleryWebhook):
 class RepoWebhook(CeleryWebhook):
     events = [
         Event("repo:post-update", "data:read"),
+        Event("repo:secret-found", "data:read"),
     ]
 
     sync = sa.Column(sa.Boolean, nullable=False, server_default="f")
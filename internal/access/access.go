@@ -0,0 +1,137 @@
+// Package access determines which users may read from and push to a
+// repository. It is shared by gitsrht-shell and the API's git over HTTP
+// backend, so that both enforce the same rules.
+//
+// Note: when updating push access logic, also update scm.sr.ht/access.py
+package access
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	NONE   = 0
+	READ   = 1
+	WRITE  = 2
+	MANAGE = 4
+)
+
+// Runs queries; satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string,
+		args ...interface{}) *sql.Row
+}
+
+type Repo struct {
+	ID      int
+	Name    string
+	OwnerID int
+	OrgID   *int
+	// The username of the user who created the repository
+	OwnerName string
+	// The name of the organization which owns the repository, if any, or of
+	// the owner
+	EntityName string
+	Path       string
+	Visibility string
+	MirrorURL  *string
+	// True if the repository was found by a redirect from its former path
+	Redirected bool
+
+	// The most permissive access grant which applies to the user, directly
+	// or through their teams: "ro", "rw" or nil
+	AccessGrant *string
+	// The user's role in the organization which owns the repository, if any
+	OrgRole *string
+}
+
+// Looks up the repository at the given path on disk, following redirects for
+// repositories which have been renamed, along with the access control
+// policies which apply to the given user. Returns nil if there is no such
+// repository.
+func LookupRepo(ctx context.Context, q Querier, userID int,
+	path string) (*Repo, error) {
+	var repo Repo
+	row := q.QueryRowContext(ctx, `
+		SELECT
+			repo.id,
+			repo.name,
+			repo.owner_id,
+			repo.org_id,
+			owner.username,
+			COALESCE(org.name, owner.username),
+			repo.path,
+			repo.visibility,
+			repo.mirror_url,
+			redirect.path IS NOT NULL,
+			(
+				SELECT max(grants.mode) FROM (
+					SELECT mode FROM access
+					WHERE repo_id = repo.id AND user_id = $1
+					UNION ALL
+					SELECT ta.mode FROM team_access ta
+					JOIN team_member tm ON tm.team_id = ta.team_id
+					WHERE ta.repo_id = repo.id AND tm.user_id = $1
+				) grants
+			),
+			member.role
+		FROM repository repo
+		JOIN "user" owner ON owner.id = repo.owner_id
+		LEFT JOIN organization org ON org.id = repo.org_id
+		LEFT JOIN organization_member member
+			ON (member.org_id = repo.org_id AND member.user_id = $1)
+		LEFT JOIN redirect
+			ON (redirect.new_repo_id = repo.id AND redirect.path = $2)
+		WHERE repo.path = $2 OR redirect.path = $2
+		-- A repository at the path takes precedence over a redirect from it
+		ORDER BY redirect.path NULLS FIRST
+		LIMIT 1;
+	`, userID, path)
+	if err := row.Scan(&repo.ID, &repo.Name, &repo.OwnerID, &repo.OrgID,
+		&repo.OwnerName, &repo.EntityName, &repo.Path, &repo.Visibility,
+		&repo.MirrorURL, &repo.Redirected, &repo.AccessGrant,
+		&repo.OrgRole); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// Returns the access bits which the given user has for this repository. The
+// repository must have been looked up for the same user.
+func (repo *Repo) Access(userID int) int {
+	// The creator of an organization's repository has no special access
+	if repo.OrgID == nil && userID == repo.OwnerID {
+		return READ | WRITE | MANAGE
+	}
+
+	hasAccess := NONE
+	if repo.AccessGrant == nil {
+		switch repo.Visibility {
+		case "public", "unlisted":
+			hasAccess = READ
+		}
+	} else {
+		switch *repo.AccessGrant {
+		case "ro":
+			hasAccess = READ
+		case "rw":
+			hasAccess = READ | WRITE
+		}
+	}
+
+	if repo.OrgRole != nil {
+		switch *repo.OrgRole {
+		case "admin":
+			hasAccess |= READ | WRITE | MANAGE
+		case "member":
+			hasAccess |= READ | WRITE
+		case "viewer":
+			hasAccess |= READ
+		}
+	}
+	return hasAccess
+}
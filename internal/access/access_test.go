@@ -0,0 +1,39 @@
+package access
+
+import "testing"
+
+func TestRepoAccess(t *testing.T) {
+	org := 10
+	str := func(s string) *string { return &s }
+	all := READ | WRITE | MANAGE
+	for _, tc := range []struct {
+		name   string
+		repo   Repo
+		userID int
+		want   int
+	}{
+		{"owner", Repo{OwnerID: 1, Visibility: "private"}, 1, all},
+		{"anonymous, public", Repo{OwnerID: 1, Visibility: "public"}, 0,
+			READ},
+		{"unlisted", Repo{OwnerID: 1, Visibility: "unlisted"}, 2, READ},
+		{"private", Repo{OwnerID: 1, Visibility: "private"}, 2, NONE},
+		{"read-only grant", Repo{OwnerID: 1, Visibility: "private",
+			AccessGrant: str("ro")}, 2, READ},
+		{"read-write grant", Repo{OwnerID: 1, Visibility: "public",
+			AccessGrant: str("rw")}, 2, READ | WRITE},
+		{"creator of an organization's repository", Repo{OwnerID: 1,
+			OrgID: &org, Visibility: "private"}, 1, NONE},
+		{"organization admin", Repo{OwnerID: 1, OrgID: &org,
+			Visibility: "private", OrgRole: str("admin")}, 2, all},
+		{"organization member", Repo{OwnerID: 1, OrgID: &org,
+			Visibility: "private", OrgRole: str("member")}, 2,
+			READ | WRITE},
+		{"organization viewer with a grant", Repo{OwnerID: 1, OrgID: &org,
+			Visibility: "private", OrgRole: str("viewer"),
+			AccessGrant: str("rw")}, 2, READ | WRITE},
+	} {
+		if got := tc.repo.Access(tc.userID); got != tc.want {
+			t.Errorf("%s: got access %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// Package codesearch implements the trigram index used for code search. The
+// index is written by gitsrht-update-hook after each push and read by the API.
+//
+// The index of a repository is stored in its search-index directory as a set
+// of segment files, each of which indexes the trigrams of some set of blobs,
+// with ASCII letters converted to lowercase:
+//
+//	"srhtidx1"
+//	uint32 number of blobs, followed by their 20-byte IDs in ascending order
+//	uint32 number of trigrams, followed by a (uint32 trigram, uint32 number
+//	  of postings) pair for each, sorted by trigram
+//	The postings, i.e. the ascending uint32 indices of the blobs which contain
+//	  each trigram, in the same order as the trigrams
+//
+// All integers are big endian. Segments are never modified once written. The
+// index is only used to rule out blobs which cannot match, so blobs which have
+// not been indexed are always searched.
+package codesearch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+)
+
+// The name of the directory of the repository which contains the index.
+const IndexDir = "search-index"
+
+// Blobs larger than this, and binary blobs, are not indexed or searched.
+const MaxBlobSize = 1024 * 1024
+
+const magic = "srhtidx1"
+
+var ErrInvalidSegment = errors.New("Invalid search index segment")
+
+// Uses the same heuristic as git: files with a NUL byte in the first 8000
+// bytes are binary.
+func IsBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) != -1
+}
+
+// Returns the trigram made of the first three bytes of b, in the form used by
+// the index. Trigrams are indexed case-insensitively for ASCII letters only,
+// so that multi-byte UTF-8 sequences are unaffected.
+func Trigram(b []byte) uint32 {
+	return uint32(toLower(b[0]))<<16 |
+		uint32(toLower(b[1]))<<8 |
+		uint32(toLower(b[2]))
+}
+
+func toLower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// Accumulates the trigrams of a set of blobs to be written as a segment.
+type SegmentWriter struct {
+	blobs    [][20]byte
+	postings map[uint32][]uint32
+	trigrams map[uint32]struct{}
+	size     int64
+}
+
+func NewSegmentWriter() *SegmentWriter {
+	return &SegmentWriter{
+		postings: make(map[uint32][]uint32),
+		trigrams: make(map[uint32]struct{}),
+	}
+}
+
+// Adds a blob to the segment. If content is nil, e.g. because the blob is too
+// large or binary, the blob is recorded as indexed, but never matches.
+func (w *SegmentWriter) Add(id [20]byte, content []byte) {
+	blob := uint32(len(w.blobs))
+	w.blobs = append(w.blobs, id)
+	if content == nil || IsBinary(content) {
+		return
+	}
+	w.size += int64(len(content))
+
+	for t := range w.trigrams {
+		delete(w.trigrams, t)
+	}
+	for i := 0; i+3 <= len(content); i++ {
+		w.trigrams[Trigram(content[i:])] = struct{}{}
+	}
+	for t := range w.trigrams {
+		w.postings[t] = append(w.postings[t], blob)
+	}
+}
+
+// Returns the number of blobs added to the segment.
+func (w *SegmentWriter) Len() int {
+	return len(w.blobs)
+}
+
+// Returns the total size of the content of the blobs added to the segment.
+func (w *SegmentWriter) Size() int64 {
+	return w.size
+}
+
+// Writes the segment to out. The writer may not be used afterwards.
+func (w *SegmentWriter) WriteTo(out io.Writer) (int64, error) {
+	// Blobs are stored in ascending order so that readers can look them up
+	// without building a table of their own
+	order := make([]uint32, len(w.blobs))
+	for i := range order {
+		order[i] = uint32(i)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return bytes.Compare(w.blobs[order[i]][:], w.blobs[order[j]][:]) < 0
+	})
+	index := make([]uint32, len(w.blobs))
+	for i, blob := range order {
+		index[blob] = uint32(i)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(magic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(w.blobs)))
+	for _, blob := range order {
+		buf.Write(w.blobs[blob][:])
+	}
+	keys := make([]uint32, 0, len(w.postings))
+	for t := range w.postings {
+		keys = append(keys, t)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	binary.Write(&buf, binary.BigEndian, uint32(len(keys)))
+	for _, t := range keys {
+		binary.Write(&buf, binary.BigEndian, t)
+		binary.Write(&buf, binary.BigEndian, uint32(len(w.postings[t])))
+	}
+	for _, t := range keys {
+		list := w.postings[t]
+		for i, blob := range list {
+			list[i] = index[blob]
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		binary.Write(&buf, binary.BigEndian, list)
+	}
+	return buf.WriteTo(out)
+}
+
+// A segment read into memory.
+type Segment struct {
+	nblobs    int
+	blobs     []byte
+	ntrigrams int
+	table     []byte
+	offsets   []uint32
+	postings  []byte
+	size      int
+}
+
+// Parses a segment. The segment refers to data, which must not be modified.
+func ParseSegment(data []byte) (*Segment, error) {
+	seg := &Segment{size: len(data)}
+	readUint32 := func() (int, error) {
+		if len(data) < 4 {
+			return 0, ErrInvalidSegment
+		}
+		v := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		return int(v), nil
+	}
+
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return nil, ErrInvalidSegment
+	}
+	data = data[len(magic):]
+
+	var err error
+	seg.nblobs, err = readUint32()
+	if err != nil || uint64(len(data)) < uint64(seg.nblobs)*20 {
+		return nil, ErrInvalidSegment
+	}
+	seg.blobs, data = data[:seg.nblobs*20], data[seg.nblobs*20:]
+
+	seg.ntrigrams, err = readUint32()
+	if err != nil || uint64(len(data)) < uint64(seg.ntrigrams)*8 {
+		return nil, ErrInvalidSegment
+	}
+	seg.table, data = data[:seg.ntrigrams*8], data[seg.ntrigrams*8:]
+	seg.offsets = make([]uint32, seg.ntrigrams+1)
+	for i := 0; i < seg.ntrigrams; i++ {
+		n := uint64(seg.offsets[i]) +
+			uint64(binary.BigEndian.Uint32(seg.table[i*8+4:]))
+		if n*4 > uint64(len(data)) {
+			return nil, ErrInvalidSegment
+		}
+		seg.offsets[i+1] = uint32(n)
+	}
+	seg.postings = data
+	return seg, nil
+}
+
+// Returns the size of the segment in bytes.
+func (seg *Segment) Size() int {
+	return seg.size
+}
+
+// Returns the index of the given blob within the segment, or false if the
+// segment does not include the blob.
+func (seg *Segment) Lookup(id [20]byte) (int, bool) {
+	i := sort.Search(seg.nblobs, func(i int) bool {
+		return bytes.Compare(seg.blobs[i*20:i*20+20], id[:]) >= 0
+	})
+	if i < seg.nblobs && bytes.Equal(seg.blobs[i*20:i*20+20], id[:]) {
+		return i, true
+	}
+	return 0, false
+}
+
+// Returns the ascending indices of the blobs in the segment which contain all
+// of the given trigrams.
+func (seg *Segment) Candidates(trigrams []uint32) []uint32 {
+	var lists [][]byte
+	for _, t := range trigrams {
+		i := sort.Search(seg.ntrigrams, func(i int) bool {
+			return binary.BigEndian.Uint32(seg.table[i*8:]) >= t
+		})
+		if i == seg.ntrigrams || binary.BigEndian.Uint32(seg.table[i*8:]) != t {
+			// No blobs in this segment can match
+			return nil
+		}
+		lists = append(lists,
+			seg.postings[seg.offsets[i]*4:seg.offsets[i+1]*4])
+	}
+	if len(lists) == 0 {
+		return nil
+	}
+
+	// Intersects the postings, starting from the shortest
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	var candidates []uint32
+next:
+	for i := 0; i < len(lists[0]); i += 4 {
+		blob := binary.BigEndian.Uint32(lists[0][i:])
+		for _, list := range lists[1:] {
+			if !containsPosting(list, blob) {
+				continue next
+			}
+		}
+		candidates = append(candidates, blob)
+	}
+	return candidates
+}
+
+func containsPosting(list []byte, blob uint32) bool {
+	n := len(list) / 4
+	i := sort.Search(n, func(i int) bool {
+		return binary.BigEndian.Uint32(list[i*4:]) >= blob
+	})
+	return i < n && binary.BigEndian.Uint32(list[i*4:]) == blob
+}
@@ -0,0 +1,77 @@
+package codesearch
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func blobID(b byte) [20]byte {
+	var id [20]byte
+	id[0] = b
+	return id
+}
+
+func TestSegment(t *testing.T) {
+	w := NewSegmentWriter()
+	// Added out of order, to check that the IDs are sorted
+	w.Add(blobID(3), []byte("func main() {}\n"))
+	w.Add(blobID(1), []byte("package MAIN\n"))
+	w.Add(blobID(2), nil)
+	w.Add(blobID(4), []byte("main\x00binary"))
+	if w.Len() != 4 {
+		t.Fatalf("expected 4 blobs, got %d", w.Len())
+	}
+
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	seg, err := ParseSegment(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := byte(1); i <= 4; i++ {
+		if idx, ok := seg.Lookup(blobID(i)); !ok || idx != int(i-1) {
+			t.Errorf("blob %d: got index %d, %v", i, idx, ok)
+		}
+	}
+	if _, ok := seg.Lookup(blobID(5)); ok {
+		t.Error("found a blob which was not indexed")
+	}
+
+	trigrams := func(s string) []uint32 {
+		var ts []uint32
+		for i := 0; i+3 <= len(s); i++ {
+			ts = append(ts, Trigram([]byte(s[i:])))
+		}
+		return ts
+	}
+	for query, want := range map[string][]uint32{
+		// Case-insensitive, and never matching the unindexed or binary blobs
+		"main":    {0, 2},
+		"Package": {0},
+		"func":    {2},
+		"xyz":     nil,
+	} {
+		if got := seg.Candidates(trigrams(query)); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got candidates %v, want %v", query, got, want)
+		}
+	}
+}
+
+func TestParseSegmentInvalid(t *testing.T) {
+	w := NewSegmentWriter()
+	w.Add(blobID(1), []byte("hello, world"))
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	for _, n := range []int{0, 8, 12, 20, len(data) - 1} {
+		if _, err := ParseSegment(data[:n]); err != ErrInvalidSegment {
+			t.Errorf("truncated to %d bytes: expected ErrInvalidSegment, got %v", n, err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+module git.sr.ht/~sircmpwn/git.sr.ht/internal
+
+go 1.13
+
+require (
+	github.com/ProtonMail/go-crypto v0.0.0-20211112122917-428f8eabeeb3
+	golang.org/x/crypto v0.0.0-20211202192323-5770296d904e
+)
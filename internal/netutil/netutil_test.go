@@ -0,0 +1,29 @@
+package netutil
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	for addr, private := range map[string]bool{
+		"127.0.0.1":            true,
+		"10.1.2.3":             true,
+		"172.16.0.1":           true,
+		"172.32.0.1":           false,
+		"192.168.1.1":          true,
+		"169.254.169.254":      true,
+		"100.64.0.1":           true,
+		"0.0.0.0":              true,
+		"8.8.8.8":              false,
+		"::1":                  true,
+		"fe80::1":              true,
+		"fd00::1":              true,
+		"::ffff:127.0.0.1":     true,
+		"2001:4860:4860::8888": false,
+	} {
+		if got := IsPrivateIP(net.ParseIP(addr)); got != private {
+			t.Errorf("IsPrivateIP(%s) = %v, want %v", addr, got, private)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package sigverify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Executes a GraphQL query against meta.sr.ht, as the user on whose behalf
+// keys are looked up, and decodes the JSON response into resp.
+type MetaQuery func(ctx context.Context, query string,
+	variables map[string]interface{}, resp interface{}) error
+
+// Runs queries; satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string,
+		args ...interface{}) *sql.Row
+}
+
+type metaError struct {
+	Message string `json:"message"`
+}
+
+// Looks up PGP keys on meta.sr.ht, and SSH keys in the git.sr.ht database.
+type SourceHutKeys struct {
+	Context context.Context
+	Query   MetaQuery
+	DB      Querier
+}
+
+func (k *SourceHutKeys) PGPKeyByFingerprint(
+	fingerprint string) (string, string, error) {
+	var resp struct {
+		Data struct {
+			Key *struct {
+				Key  string `json:"key"`
+				User struct {
+					Username string `json:"username"`
+				} `json:"user"`
+			} `json:"pgpKeyByFingerprint"`
+		} `json:"data"`
+		Errors []metaError `json:"errors"`
+	}
+	if err := k.Query(k.Context, `
+		query PGPKey($fingerprint: String!) {
+			pgpKeyByFingerprint(fingerprint: $fingerprint) {
+				key
+				user { username }
+			}
+		}`, map[string]interface{}{
+		"fingerprint": fingerprint,
+	}, &resp); err != nil {
+		return "", "", err
+	} else if len(resp.Errors) > 0 {
+		return "", "", fmt.Errorf("Failed to look up PGP key: %s",
+			resp.Errors[0].Message)
+	}
+	if resp.Data.Key == nil {
+		return "", "", nil
+	}
+	return resp.Data.Key.Key, resp.Data.Key.User.Username, nil
+}
+
+func (k *SourceHutKeys) PGPKeysByEmail(email string) ([]string, string, error) {
+	var resp struct {
+		Data struct {
+			User *struct {
+				Username string `json:"username"`
+				PGPKeys  struct {
+					Results []struct {
+						Key string `json:"key"`
+					} `json:"results"`
+				} `json:"pgpKeys"`
+			} `json:"userByEmail"`
+		} `json:"data"`
+		Errors []metaError `json:"errors"`
+	}
+	if err := k.Query(k.Context, `
+		query PGPKeys($email: String!) {
+			userByEmail(email: $email) {
+				username
+				pgpKeys { results { key } }
+			}
+		}`, map[string]interface{}{
+		"email": email,
+	}, &resp); err != nil {
+		return nil, "", err
+	} else if len(resp.Errors) > 0 {
+		return nil, "", fmt.Errorf("Failed to look up PGP keys: %s",
+			resp.Errors[0].Message)
+	}
+	if resp.Data.User == nil {
+		return nil, "", nil
+	}
+	keys := make([]string, len(resp.Data.User.PGPKeys.Results))
+	for i, key := range resp.Data.User.PGPKeys.Results {
+		keys[i] = key.Key
+	}
+	return keys, resp.Data.User.Username, nil
+}
+
+func (k *SourceHutKeys) SSHKeyByFingerprint(fingerprint string) (string, error) {
+	var username string
+	err := k.DB.QueryRowContext(k.Context, `
+		SELECT "user".username
+		FROM sshkey
+		JOIN "user" ON "user".id = sshkey.user_id
+		WHERE sshkey.fingerprint = $1
+	`, fingerprint).Scan(&username)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return username, nil
+}
@@ -0,0 +1,56 @@
+package sigverify
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func metaStub(t *testing.T, responses map[string]string) MetaQuery {
+	return func(ctx context.Context, query string,
+		variables map[string]interface{}, resp interface{}) error {
+		for name, body := range responses {
+			if strings.Contains(query, name) {
+				return json.Unmarshal([]byte(body), resp)
+			}
+		}
+		t.Fatalf("unexpected query %s", query)
+		return nil
+	}
+}
+
+func TestSourceHutKeysPGP(t *testing.T) {
+	keys := &SourceHutKeys{
+		Context: context.Background(),
+		Query: metaStub(t, map[string]string{
+			"pgpKeyByFingerprint": `{"data": {"pgpKeyByFingerprint":
+				{"key": "KEY", "user": {"username": "alice"}}}}`,
+			"userByEmail": `{"data": {"userByEmail": {"username": "alice",
+				"pgpKeys": {"results": [{"key": "A"}, {"key": "B"}]}}}}`,
+		}),
+	}
+	key, username, err := keys.PGPKeyByFingerprint("ABCD")
+	if err != nil || key != "KEY" || username != "alice" {
+		t.Errorf("got %q, %q, %v", key, username, err)
+	}
+	list, username, err := keys.PGPKeysByEmail("alice@example.org")
+	if err != nil || !reflect.DeepEqual(list, []string{"A", "B"}) ||
+		username != "alice" {
+		t.Errorf("got %q, %q, %v", list, username, err)
+	}
+
+	keys.Query = metaStub(t, map[string]string{
+		"pgpKeyByFingerprint": `{"data": {"pgpKeyByFingerprint": null}}`,
+		"userByEmail":         `{"errors": [{"message": "Access denied"}]}`,
+	})
+	if key, username, err := keys.PGPKeyByFingerprint("ABCD"); err != nil ||
+		key != "" || username != "" {
+		t.Errorf("expected no key, got %q, %q, %v", key, username, err)
+	}
+	if _, _, err := keys.PGPKeysByEmail("alice@example.org"); err == nil ||
+		!strings.Contains(err.Error(), "Access denied") {
+		t.Errorf("expected the error to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package sigverify
+
+import (
+	"bytes"
+)
+
+// Splits a raw commit object, without the "commit <size>" header, into the
+// data which was signed, i.e. the commit without its gpgsig header, and the
+// armored signature. Other headers, such as mergetag and encoding, are signed
+// too, so the data is taken from the raw object rather than re-encoded.
+// Returns an empty signature if the commit is not signed.
+func SplitCommit(raw []byte) ([]byte, string) {
+	var (
+		data      bytes.Buffer
+		signature bytes.Buffer
+		inSig     bool
+	)
+	rest := raw
+	for len(rest) != 0 {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i != -1 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+
+		if inSig && line[0] == ' ' {
+			signature.Write(line[1:])
+			continue
+		}
+		inSig = false
+		if bytes.HasPrefix(line, []byte("gpgsig ")) {
+			inSig = true
+			signature.Write(line[len("gpgsig "):])
+			continue
+		}
+		data.Write(line)
+		if len(line) == 1 && line[0] == '\n' {
+			// The end of the headers
+			data.Write(rest)
+			break
+		}
+	}
+	armored := signature.String()
+	if armored != "" && armored[len(armored)-1] != '\n' {
+		armored += "\n"
+	}
+	return data.Bytes(), armored
+}
+
+// Splits a raw tag object, without the "tag <size>" header, into the data
+// which was signed and the armored signature, which git appends to the
+// message. Returns an empty signature if the tag is not signed.
+func SplitTag(raw []byte) ([]byte, string) {
+	// Like git, use the last line which begins a signature
+	start := -1
+	for _, f := range formats {
+		i := bytes.LastIndex(raw, []byte("\n"+f.begin+"\n"))
+		if i > start {
+			start = i
+		}
+	}
+	if start == -1 {
+		return raw, ""
+	}
+	return raw[:start+1], string(raw[start+1:])
+}
@@ -0,0 +1,69 @@
+package sigverify
+
+import (
+	"testing"
+)
+
+const testSignature = "-----BEGIN SSH SIGNATURE-----\n" +
+	"U1NIU0lHAAAAAQ==\n" +
+	"-----END SSH SIGNATURE-----\n"
+
+func TestSplitCommit(t *testing.T) {
+	raw := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 5c7b2a0e4d3e4d6f1c6e3e8c9b0a1d2e3f4a5b6c\n" +
+		"author Example <example@example.org> 1600000000 +0000\n" +
+		"committer Example <example@example.org> 1600000000 +0000\n" +
+		"encoding ISO-8859-1\n" +
+		"mergetag object 5c7b2a0e4d3e4d6f1c6e3e8c9b0a1d2e3f4a5b6c\n" +
+		" type commit\n" +
+		" tag v1.0\n" +
+		"gpgsig -----BEGIN SSH SIGNATURE-----\n" +
+		" U1NIU0lHAAAAAQ==\n" +
+		" -----END SSH SIGNATURE-----\n" +
+		"\n" +
+		"Merge tag 'v1.0'\n" +
+		"\n" +
+		"gpgsig in the message is not a header\n"
+	want := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 5c7b2a0e4d3e4d6f1c6e3e8c9b0a1d2e3f4a5b6c\n" +
+		"author Example <example@example.org> 1600000000 +0000\n" +
+		"committer Example <example@example.org> 1600000000 +0000\n" +
+		"encoding ISO-8859-1\n" +
+		"mergetag object 5c7b2a0e4d3e4d6f1c6e3e8c9b0a1d2e3f4a5b6c\n" +
+		" type commit\n" +
+		" tag v1.0\n" +
+		"\n" +
+		"Merge tag 'v1.0'\n" +
+		"\n" +
+		"gpgsig in the message is not a header\n"
+	data, armored := SplitCommit([]byte(raw))
+	if string(data) != want {
+		t.Errorf("got signed data:\n%s\nwant:\n%s", data, want)
+	}
+	if armored != testSignature {
+		t.Errorf("got signature:\n%s\nwant:\n%s", armored, testSignature)
+	}
+
+	unsigned := "tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nCommit\n"
+	if data, armored := SplitCommit([]byte(unsigned)); string(data) !=
+		unsigned || armored != "" {
+		t.Errorf("expected an unsigned commit to be unchanged")
+	}
+}
+
+func TestSplitTag(t *testing.T) {
+	signed := "object 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"type commit\n" +
+		"tag v1.0\n" +
+		"tagger Example <example@example.org> 1600000000 +0000\n" +
+		"\n" +
+		"Version 1.0\n"
+	data, armored := SplitTag([]byte(signed + testSignature))
+	if string(data) != signed || armored != testSignature {
+		t.Errorf("got %q and %q", data, armored)
+	}
+	if data, armored := SplitTag([]byte(signed)); string(data) != signed ||
+		armored != "" {
+		t.Errorf("expected an unsigned tag to be unchanged")
+	}
+}
@@ -0,0 +1,400 @@
+// Package sigverify verifies the PGP and SSH signatures of commits and tags
+// against the keys which users have registered. It is shared by the API and
+// gitsrht-update-hook, and works on raw object data so that it does not
+// depend on either's version of go-git.
+package sigverify
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"golang.org/x/crypto/ssh"
+)
+
+type Format string
+
+const (
+	FormatPGP Format = "PGP"
+	FormatSSH Format = "SSH"
+)
+
+type Status string
+
+const (
+	// The signature is valid and was made with a key registered by a user.
+	StatusVerified Status = "VERIFIED"
+	// The signature was made with a key which no user has registered.
+	StatusUnknownKey Status = "UNKNOWN_KEY"
+	// The signature is malformed, or does not match the signed data.
+	StatusInvalid Status = "INVALID"
+)
+
+var formats = []struct {
+	format Format
+	begin  string
+}{
+	{FormatPGP, "-----BEGIN PGP SIGNATURE-----"},
+	{FormatSSH, "-----BEGIN SSH SIGNATURE-----"},
+}
+
+var ErrUnknownFormat = errors.New("Unknown signature format")
+
+// Looks up the keys which users have registered.
+type Keys interface {
+	// Returns the armored PGP key whose primary key has the given
+	// fingerprint, in upper case hexadecimal, and the username of the user
+	// who registered it, or empty strings if no user has.
+	PGPKeyByFingerprint(fingerprint string) (key, username string, err error)
+	// Returns the armored PGP keys registered by the user with the given
+	// email address, and their username, or nil and an empty string if there
+	// is no such user.
+	PGPKeysByEmail(email string) (keys []string, username string, err error)
+	// Returns the username of the user who registered the SSH key with the
+	// given fingerprint, as formatted by ssh.FingerprintLegacyMD5, or an
+	// empty string if no user has.
+	SSHKeyByFingerprint(fingerprint string) (username string, err error)
+}
+
+type cache struct {
+	keys Keys
+
+	mu         sync.Mutex
+	pgpKeys    map[string]pgpKey
+	pgpByEmail map[string]pgpKeys
+	sshKeys    map[string]string
+}
+
+type pgpKey struct {
+	key, username string
+}
+
+type pgpKeys struct {
+	keys     []string
+	username string
+}
+
+// Returns Keys which remember the results of each lookup. Errors are not
+// remembered.
+func NewCache(keys Keys) Keys {
+	return &cache{
+		keys:       keys,
+		pgpKeys:    make(map[string]pgpKey),
+		pgpByEmail: make(map[string]pgpKeys),
+		sshKeys:    make(map[string]string),
+	}
+}
+
+func (c *cache) PGPKeyByFingerprint(fingerprint string) (string, string, error) {
+	c.mu.Lock()
+	k, ok := c.pgpKeys[fingerprint]
+	c.mu.Unlock()
+	if ok {
+		return k.key, k.username, nil
+	}
+	key, username, err := c.keys.PGPKeyByFingerprint(fingerprint)
+	if err != nil {
+		return "", "", err
+	}
+	c.mu.Lock()
+	c.pgpKeys[fingerprint] = pgpKey{key, username}
+	c.mu.Unlock()
+	return key, username, nil
+}
+
+func (c *cache) PGPKeysByEmail(email string) ([]string, string, error) {
+	c.mu.Lock()
+	k, ok := c.pgpByEmail[email]
+	c.mu.Unlock()
+	if ok {
+		return k.keys, k.username, nil
+	}
+	keys, username, err := c.keys.PGPKeysByEmail(email)
+	if err != nil {
+		return nil, "", err
+	}
+	c.mu.Lock()
+	c.pgpByEmail[email] = pgpKeys{keys, username}
+	c.mu.Unlock()
+	return keys, username, nil
+}
+
+func (c *cache) SSHKeyByFingerprint(fingerprint string) (string, error) {
+	c.mu.Lock()
+	username, ok := c.sshKeys[fingerprint]
+	c.mu.Unlock()
+	if ok {
+		return username, nil
+	}
+	username, err := c.keys.SSHKeyByFingerprint(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.sshKeys[fingerprint] = username
+	c.mu.Unlock()
+	return username, nil
+}
+
+// An ASCII-armored signature.
+type Signature struct {
+	Format  Format
+	Armored string
+
+	pgp *packet.Signature
+	ssh *sshSignature
+}
+
+// Returns the format of the armored signature, or an empty string if it is
+// not in a known format.
+func DetectFormat(armored string) Format {
+	for _, f := range formats {
+		if strings.HasPrefix(armored, f.begin) {
+			return f.format
+		}
+	}
+	return ""
+}
+
+// Parses an armored signature. Returns ErrUnknownFormat if it is not a PGP or
+// SSH signature, or another error if it is malformed.
+func Parse(armored string) (*Signature, error) {
+	sig := &Signature{Format: DetectFormat(armored), Armored: armored}
+	var err error
+	switch sig.Format {
+	case FormatPGP:
+		sig.pgp, err = parsePGPSignature(armored)
+	case FormatSSH:
+		sig.ssh, err = parseSSHSignature(armored)
+	default:
+		err = ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Returns the fingerprint of the signing key, in hexadecimal for PGP keys (or
+// the key ID, if the signature does not include the fingerprint), or as
+// "SHA256:<base64>" for SSH keys.
+func (sig *Signature) KeyID() string {
+	switch sig.Format {
+	case FormatPGP:
+		if sig.pgp.IssuerFingerprint != nil {
+			return fmt.Sprintf("%X", sig.pgp.IssuerFingerprint)
+		} else if sig.pgp.IssuerKeyId != nil {
+			return fmt.Sprintf("%016X", *sig.pgp.IssuerKeyId)
+		}
+		return ""
+	case FormatSSH:
+		return ssh.FingerprintSHA256(sig.ssh.publicKey)
+	}
+	return ""
+}
+
+// Verifies that this is a signature of data, made with a key which a user has
+// registered, and returns their username if so. The email address is that of
+// the committer or tagger: PGP keys are looked up by the fingerprint in the
+// signature, but signatures which only include a key ID, or which were made
+// with a subkey, are checked against the PGP keys of the user with that email
+// address.
+func (sig *Signature) Verify(keys Keys, data []byte,
+	email string) (Status, string, error) {
+	switch sig.Format {
+	case FormatPGP:
+		return sig.verifyPGP(keys, data, email)
+	case FormatSSH:
+		return sig.verifySSH(keys, data)
+	}
+	return StatusInvalid, "", nil
+}
+
+func (sig *Signature) verifyPGP(keys Keys, data []byte,
+	email string) (Status, string, error) {
+	var keyID uint64
+	switch {
+	case sig.pgp.IssuerKeyId != nil:
+		keyID = *sig.pgp.IssuerKeyId
+	case len(sig.pgp.IssuerFingerprint) == 20:
+		// The key ID of a v4 key is the end of its fingerprint
+		for _, b := range sig.pgp.IssuerFingerprint[12:] {
+			keyID = keyID<<8 | uint64(b)
+		}
+	default:
+		return StatusUnknownKey, "", nil
+	}
+
+	var (
+		keyring  openpgp.EntityList
+		username string
+	)
+	if sig.pgp.IssuerFingerprint != nil {
+		key, user, err := keys.PGPKeyByFingerprint(
+			fmt.Sprintf("%X", sig.pgp.IssuerFingerprint))
+		if err != nil {
+			return "", "", err
+		}
+		if key != "" {
+			if keyring, err = readPGPKey(key); err != nil {
+				return "", "", err
+			}
+			username = user
+		}
+	}
+	if keyring == nil && email != "" {
+		// Registered keys are looked up by the fingerprint of their primary
+		// key, so find the key which includes this one among the signer's
+		armored, user, err := keys.PGPKeysByEmail(email)
+		if err != nil {
+			return "", "", err
+		}
+		for _, key := range armored {
+			entities, err := readPGPKey(key)
+			if err != nil {
+				return "", "", err
+			}
+			if len(entities.KeysById(keyID)) != 0 {
+				keyring, username = entities, user
+				break
+			}
+		}
+	}
+	if keyring == nil {
+		return StatusUnknownKey, "", nil
+	}
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring,
+		bytes.NewReader(data), strings.NewReader(sig.Armored),
+		nil); err != nil {
+		return StatusInvalid, "", nil
+	}
+	return StatusVerified, username, nil
+}
+
+func readPGPKey(armored string) (openpgp.EntityList, error) {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read PGP key: %v", err)
+	}
+	return keyring, nil
+}
+
+func (sig *Signature) verifySSH(keys Keys, data []byte) (Status, string, error) {
+	if err := sig.ssh.verify(data); err != nil {
+		return StatusInvalid, "", nil
+	}
+	username, err := keys.SSHKeyByFingerprint(
+		ssh.FingerprintLegacyMD5(sig.ssh.publicKey))
+	if err != nil {
+		return "", "", err
+	} else if username == "" {
+		return StatusUnknownKey, "", nil
+	}
+	return StatusVerified, username, nil
+}
+
+func parsePGPSignature(armored string) (*packet.Signature, error) {
+	block, err := armor.Decode(strings.NewReader(armored))
+	if err != nil {
+		return nil, err
+	}
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return nil, err
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return nil, fmt.Errorf("Expected PGP signature packet, got %T", p)
+	}
+	return sig, nil
+}
+
+// The namespace in which git signs objects with SSH keys
+const sshSignatureNamespace = "git"
+
+// An SSH signature, as made by ssh-keygen -Y sign. See PROTOCOL.sshsig in the
+// OpenSSH source tree.
+type sshSignature struct {
+	publicKey     ssh.PublicKey
+	namespace     string
+	hashAlgorithm string
+	signature     *ssh.Signature
+}
+
+func parseSSHSignature(armored string) (*sshSignature, error) {
+	lines := strings.Split(strings.TrimSpace(armored), "\n")
+	if len(lines) < 2 || lines[len(lines)-1] != "-----END SSH SIGNATURE-----" {
+		return nil, fmt.Errorf("Invalid SSH signature armor")
+	}
+	b, err := base64.StdEncoding.DecodeString(
+		strings.Join(lines[1:len(lines)-1], ""))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(b, []byte("SSHSIG")) {
+		return nil, fmt.Errorf("Invalid SSH signature magic")
+	}
+	var blob struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      []byte
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := ssh.Unmarshal(b[len("SSHSIG"):], &blob); err != nil {
+		return nil, err
+	}
+	if blob.Version != 1 {
+		return nil, fmt.Errorf("Unsupported SSH signature version %d",
+			blob.Version)
+	}
+	key, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &signature); err != nil {
+		return nil, err
+	}
+	return &sshSignature{
+		publicKey:     key,
+		namespace:     blob.Namespace,
+		hashAlgorithm: blob.HashAlgorithm,
+		signature:     &signature,
+	}, nil
+}
+
+func (s *sshSignature) verify(data []byte) error {
+	if s.namespace != sshSignatureNamespace {
+		return fmt.Errorf("Unexpected SSH signature namespace %q", s.namespace)
+	}
+	var h hash.Hash
+	switch s.hashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("Unsupported SSH signature hash algorithm %q",
+			s.hashAlgorithm)
+	}
+	h.Write(data)
+	signed := ssh.Marshal(struct {
+		Namespace     string
+		Reserved      []byte
+		HashAlgorithm string
+		Hash          []byte
+	}{s.namespace, nil, s.hashAlgorithm, h.Sum(nil)})
+	return s.publicKey.Verify(append([]byte("SSHSIG"), signed...), s.signature)
+}
@@ -0,0 +1,313 @@
+package sigverify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"golang.org/x/crypto/ssh"
+)
+
+type testKeys struct {
+	pgp     map[string]string
+	byEmail map[string][]string
+	ssh     map[string]string
+	lookups int
+}
+
+func (k *testKeys) PGPKeyByFingerprint(fingerprint string) (string, string, error) {
+	k.lookups++
+	if key, ok := k.pgp[fingerprint]; ok {
+		return key, "alice", nil
+	}
+	return "", "", nil
+}
+
+func (k *testKeys) PGPKeysByEmail(email string) ([]string, string, error) {
+	k.lookups++
+	if keys, ok := k.byEmail[email]; ok {
+		return keys, "alice", nil
+	}
+	return nil, "", nil
+}
+
+func (k *testKeys) SSHKeyByFingerprint(fingerprint string) (string, error) {
+	k.lookups++
+	return k.ssh[fingerprint], nil
+}
+
+func armoredPublicKey(t *testing.T, e *openpgp.Entity) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return buf.String()
+}
+
+func newPGPEntity(t *testing.T) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity("Alice", "", "alice@example.org",
+		&packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func verify(t *testing.T, armored string, keys Keys, data []byte,
+	email string) (Status, string) {
+	t.Helper()
+	sig, err := Parse(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, username, err := sig.Verify(keys, data, email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status, username
+}
+
+func TestVerifyPGP(t *testing.T) {
+	e := newPGPEntity(t)
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nCommit\n")
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, e, bytes.NewReader(data),
+		nil); err != nil {
+		t.Fatal(err)
+	}
+	armored := buf.String()
+
+	fingerprint := fmt.Sprintf("%X", e.PrimaryKey.Fingerprint)
+	keys := &testKeys{pgp: map[string]string{
+		fingerprint: armoredPublicKey(t, e),
+	}}
+	sig, err := Parse(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Format != FormatPGP || sig.KeyID() != fingerprint {
+		t.Errorf("got %s signature by %s, want PGP by %s",
+			sig.Format, sig.KeyID(), fingerprint)
+	}
+	if status, username := verify(t, armored, keys, data, ""); status !=
+		StatusVerified || username != "alice" {
+		t.Errorf("got %s by %q, want VERIFIED by alice", status, username)
+	}
+	if status, _ := verify(t, armored, keys, []byte("tampered"),
+		""); status != StatusInvalid {
+		t.Errorf("got %s for tampered data, want INVALID", status)
+	}
+	if status, _ := verify(t, armored, &testKeys{}, data,
+		""); status != StatusUnknownKey {
+		t.Errorf("got %s for an unregistered key, want UNKNOWN_KEY", status)
+	}
+}
+
+func TestVerifyPGPSubkey(t *testing.T) {
+	e := newPGPEntity(t)
+	if err := e.AddSigningSubkey(&packet.Config{
+		Algorithm: packet.PubKeyAlgoRSA,
+		RSABits:   1024,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("Signed with a subkey\n")
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, e, bytes.NewReader(data),
+		nil); err != nil {
+		t.Fatal(err)
+	}
+	armored := buf.String()
+
+	sig, err := Parse(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *sig.pgp.IssuerKeyId == e.PrimaryKey.KeyId {
+		t.Fatal("expected the signature to be made with the subkey")
+	}
+	// Only the fingerprint of the primary key is registered
+	key := armoredPublicKey(t, e)
+	keys := &testKeys{
+		pgp: map[string]string{
+			fmt.Sprintf("%X", e.PrimaryKey.Fingerprint): key,
+		},
+		byEmail: map[string][]string{"alice@example.org": {key}},
+	}
+	if status, username := verify(t, armored, keys, data,
+		"alice@example.org"); status != StatusVerified || username != "alice" {
+		t.Errorf("got %s by %q, want VERIFIED by alice", status, username)
+	}
+	if status, _ := verify(t, armored, keys, data,
+		"bob@example.org"); status != StatusUnknownKey {
+		t.Errorf("got %s for another committer, want UNKNOWN_KEY", status)
+	}
+}
+
+// Signs data with a v4 signature which only names the issuer by its key ID,
+// as older versions of GnuPG do.
+func signWithKeyID(t *testing.T, e *openpgp.Entity, data []byte) string {
+	t.Helper()
+	hashed := []byte{5, 2, 0, 0, 0, 0} // Creation time
+	binary.BigEndian.PutUint32(hashed[2:], uint32(time.Now().Unix()))
+	header := []byte{4, byte(packet.SigTypeBinary),
+		byte(packet.PubKeyAlgoRSA), 8, 0, byte(len(hashed))}
+	header = append(header, hashed...)
+
+	h := sha256.New()
+	h.Write(data)
+	h.Write(header)
+	trailer := []byte{4, 0xff, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(trailer[2:], uint32(len(header)))
+	h.Write(trailer)
+	digest := h.Sum(nil)
+	signature, err := e.PrivateKey.PrivateKey.(crypto.Signer).Sign(nil,
+		digest, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(signature) > 0 && signature[0] == 0 {
+		signature = signature[1:]
+	}
+
+	body := append([]byte{}, header...)
+	unhashed := []byte{9, 16, 0, 0, 0, 0, 0, 0, 0, 0} // Issuer key ID
+	binary.BigEndian.PutUint64(unhashed[2:], e.PrimaryKey.KeyId)
+	body = append(body, 0, byte(len(unhashed)))
+	body = append(body, unhashed...)
+	body = append(body, digest[:2]...)
+	bits := len(signature)*8 - 8
+	for b := signature[0]; b != 0; b >>= 1 {
+		bits++
+	}
+	body = append(body, byte(bits>>8), byte(bits))
+	body = append(body, signature...)
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, "PGP SIGNATURE", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A new format signature packet
+	if n := len(body); n < 192 {
+		w.Write([]byte{0xc0 | 2, byte(n)})
+	} else {
+		n -= 192
+		w.Write([]byte{0xc0 | 2, byte(n>>8) + 192, byte(n)})
+	}
+	w.Write(body)
+	w.Close()
+	return buf.String()
+}
+
+func TestVerifyPGPKeyID(t *testing.T) {
+	e := newPGPEntity(t)
+	data := []byte("Signed without a fingerprint\n")
+	armored := signWithKeyID(t, e, data)
+
+	sig, err := Parse(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%016X", e.PrimaryKey.KeyId); sig.KeyID() != want {
+		t.Errorf("got key ID %s, want %s", sig.KeyID(), want)
+	}
+	keys := &testKeys{byEmail: map[string][]string{
+		"alice@example.org": {armoredPublicKey(t, e)},
+	}}
+	if status, username := verify(t, armored, keys, data,
+		"alice@example.org"); status != StatusVerified || username != "alice" {
+		t.Errorf("got %s by %q, want VERIFIED by alice", status, username)
+	}
+}
+
+func TestVerifySSH(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sigverify-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	key := path.Join(dir, "key")
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519",
+		"-N", "", "-f", key).CombinedOutput(); err != nil {
+		t.Skipf("ssh-keygen: %v: %s", err, out)
+	}
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nCommit\n")
+	sign := exec.Command("ssh-keygen", "-Y", "sign", "-n", "git", "-f", key)
+	sign.Stdin = bytes.NewReader(data)
+	out, err := sign.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	armored := string(out)
+
+	pub, err := ioutil.ReadFile(key + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Parse(armored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Format != FormatSSH ||
+		sig.KeyID() != ssh.FingerprintSHA256(publicKey) {
+		t.Errorf("got %s signature by %s", sig.Format, sig.KeyID())
+	}
+
+	keys := &testKeys{ssh: map[string]string{
+		ssh.FingerprintLegacyMD5(publicKey): "alice",
+	}}
+	cached := NewCache(keys)
+	for i := 0; i < 2; i++ {
+		if status, username := verify(t, armored, cached, data,
+			""); status != StatusVerified || username != "alice" {
+			t.Errorf("got %s by %q, want VERIFIED by alice", status, username)
+		}
+	}
+	if keys.lookups != 1 {
+		t.Errorf("expected the key to be looked up once, got %d", keys.lookups)
+	}
+	if status, _ := verify(t, armored, cached, append(data, '\n'),
+		""); status != StatusInvalid {
+		t.Errorf("got %s for tampered data, want INVALID", status)
+	}
+	if status, _ := verify(t, armored, &testKeys{}, data,
+		""); status != StatusUnknownKey {
+		t.Errorf("got %s for an unregistered key, want UNKNOWN_KEY", status)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse("not a signature"); err != ErrUnknownFormat {
+		t.Errorf("got %v, want ErrUnknownFormat", err)
+	}
+	malformed := "-----BEGIN SSH SIGNATURE-----\nAAAA\n-----END SSH SIGNATURE-----\n"
+	if _, err := Parse(malformed); err == nil || err == ErrUnknownFormat {
+		t.Errorf("expected a malformed signature error, got %v", err)
+	}
+	if f := DetectFormat("-----BEGIN PGP SIGNATURE-----\n"); f != FormatPGP {
+		t.Errorf("got format %q, want PGP", f)
+	}
+}